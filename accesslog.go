@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency
+// histograms.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+// AccessLogEntry is one line of the serve access log.
+type AccessLogEntry struct {
+	Time   string `json:"time"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Route is the endpoint pattern that served the request, such as
+	// "GET /epg/{channel}", so requests can be grouped by endpoint.
+	Route     string  `json:"route"`
+	Channel   string  `json:"channel,omitempty"`
+	Group     string  `json:"group,omitempty"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	LatencyMS float64 `json:"latency_ms"`
+	Client    string  `json:"client"`
+}
+
+// accessLog writes one JSON line per request and keeps the request metrics
+// served at /metrics: a latency histogram per endpoint, request counts by
+// endpoint and status, and request counts per channel.
+type accessLog struct {
+	mu       sync.Mutex
+	out      io.Writer
+	routes   map[string]*latencyHistogram
+	requests map[[2]string]int
+	channels map[string]int
+}
+
+type latencyHistogram struct {
+	buckets []int
+	sum     float64
+	count   int
+}
+
+// openAccessLog logs to target: a file appended to, or - for standard
+// output. An empty target keeps the metrics but writes no log lines.
+func openAccessLog(target string) (*accessLog, error) {
+	log := &accessLog{
+		routes:   make(map[string]*latencyHistogram),
+		requests: make(map[[2]string]int),
+		channels: make(map[string]int),
+	}
+	switch target {
+	case "":
+	case "-":
+		log.out = os.Stdout
+	default:
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		log.out = file
+	}
+	return log, nil
+}
+
+// statusRecorder remembers the status and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
+
+// withAccessLog wraps the server's routes, logging and measuring every
+// request. Channels are counted under their slug, and only when the guide
+// has them, so mistyped names do not grow the metrics.
+func (s *guideServer) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		latency := time.Since(started)
+
+		entry := AccessLogEntry{
+			Time:      started.Format(time.RFC3339Nano),
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			Route:     r.Pattern,
+			Group:     r.PathValue("name"),
+			Status:    recorder.status,
+			Bytes:     recorder.bytes,
+			LatencyMS: float64(latency.Microseconds()) / 1000,
+			Client:    r.RemoteAddr,
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			entry.Client = host
+		}
+		if forwarded, _, _ := strings.Cut(r.Header.Get("X-Forwarded-For"), ","); strings.TrimSpace(forwarded) != "" {
+			entry.Client = strings.TrimSpace(forwarded)
+		}
+		if entry.Route == "" {
+			entry.Route = "unmatched"
+		}
+		if channel, _ := cutScheduleFormat(r.PathValue("channel")); channel != "" {
+			if slug, _ := s.guide.Load().lookup(channel); slug != "" {
+				entry.Channel = slug
+			}
+		}
+		s.access.record(entry, latency)
+	})
+}
+
+// record adds a request to the metrics and writes its log line.
+func (l *accessLog) record(entry AccessLogEntry, latency time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	histogram := l.routes[entry.Route]
+	if histogram == nil {
+		histogram = &latencyHistogram{buckets: make([]int, len(latencyBuckets))}
+		l.routes[entry.Route] = histogram
+	}
+	seconds := latency.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			histogram.buckets[i]++
+		}
+	}
+	histogram.sum += seconds
+	histogram.count++
+	l.requests[[2]string{entry.Route, strconv.Itoa(entry.Status)}]++
+	if entry.Channel != "" {
+		l.channels[entry.Channel]++
+	}
+
+	if l.out != nil {
+		if data, err := json.Marshal(entry); err == nil {
+			l.out.Write(append(data, '\n'))
+		}
+	}
+}
+
+// families returns the request metrics.
+func (l *accessLog) families() []metricFamily {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	latency := metricFamily{Name: "epg_http_request_duration_seconds", Help: "Request latency by endpoint.", Type: "histogram"}
+	for _, route := range sortedKeys(l.routes) {
+		histogram := l.routes[route]
+		for i, bound := range latencyBuckets {
+			latency.Samples = append(latency.Samples, sample(latency.Name+"_bucket", float64(histogram.buckets[i]), "route", route, "le", strconv.FormatFloat(bound, 'f', -1, 64)))
+		}
+		latency.Samples = append(latency.Samples,
+			sample(latency.Name+"_bucket", float64(histogram.count), "route", route, "le", "+Inf"),
+			sample(latency.Name+"_sum", histogram.sum, "route", route),
+			sample(latency.Name+"_count", float64(histogram.count), "route", route))
+	}
+
+	requests := metricFamily{Name: "epg_http_requests_total", Help: "Requests by endpoint and status.", Type: "counter"}
+	keys := make([][2]string, 0, len(l.requests))
+	for key := range l.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		requests.Samples = append(requests.Samples, sample(requests.Name, float64(l.requests[key]), "route", key[0], "status", key[1]))
+	}
+
+	channels := metricFamily{Name: "epg_channel_requests_total", Help: "Requests naming each channel.", Type: "counter"}
+	for _, channel := range sortedKeys(l.channels) {
+		channels.Samples = append(channels.Samples, sample(channels.Name, float64(l.channels[channel]), "channel", channel))
+	}
+
+	families := make([]metricFamily, 0, 3)
+	for _, family := range []metricFamily{latency, requests, channels} {
+		if len(family.Samples) > 0 {
+			families = append(families, family)
+		}
+	}
+	return families
+}
+
+// sortedKeys returns a map's keys in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String describes where the log goes, for the startup message.
+func (l *accessLog) String() string {
+	switch l.out {
+	case nil:
+		return "off"
+	case os.Stdout:
+		return "standard output"
+	}
+	return l.out.(*os.File).Name()
+}
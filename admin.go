@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxAliasFileSize bounds the body of PUT /admin/aliases.
+const maxAliasFileSize = 1 << 20
+
+// adminRoutes registers the admin endpoints when an admin token is
+// configured; without one they do not exist.
+func (s *guideServer) adminRoutes(mux *http.ServeMux) {
+	if s.adminToken == "" {
+		return
+	}
+	mux.HandleFunc("GET /admin/aliases", s.requireAdmin(s.handleGetAliases))
+	mux.HandleFunc("PUT /admin/aliases", s.requireAdmin(s.handlePutAliases))
+	mux.HandleFunc("POST /admin/refresh", s.requireAdmin(s.handleAdminRefresh))
+}
+
+// requireAdmin rejects requests without `Authorization: Bearer <token>`.
+func (s *guideServer) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="epg admin"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *guideServer) handleGetAliases(w http.ResponseWriter, r *http.Request) {
+	data, err := os.ReadFile(s.aliasFile)
+	if err != nil && !os.IsNotExist(err) {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(data)
+}
+
+// handlePutAliases replaces the alias file with the request body, in the
+// aliases.txt format, and starts a regeneration so the new mappings are
+// used right away. When the daemon watches the file, it re-publishes the
+// affected channels itself. When --match has no alias strategy the aliases
+// would change nothing, so the file is left alone and 409 says why.
+func (s *guideServer) handlePutAliases(w http.ResponseWriter, r *http.Request) {
+	if !s.aliasMatch {
+		writeError(w, http.StatusConflict, "--match has no alias strategy, so aliases are not used; add alias to --match, e.g. chno,alias,name,partial")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAliasFileSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	count, err := validateAliases(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := writeFileAtomic(s.aliasFile, body); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logMessage(fmt.Sprintf("✏️  %s replaced via the admin API: %d aliases", s.aliasFile, count))
+	refresh := "none"
+	switch {
+	case s.aliasWatch:
+		refresh = "watched"
+	case s.requestRefresh():
+		refresh = "queued"
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"aliases": count,
+		"refresh": refresh,
+	})
+}
+
+// handleAdminRefresh regenerates the outputs when running as a daemon, or
+// reloads the output folders from disk otherwise.
+func (s *guideServer) handleAdminRefresh(w http.ResponseWriter, r *http.Request) {
+	if s.requestRefresh() {
+		writeJSON(w, http.StatusAccepted, map[string]any{"refresh": "queued"})
+		return
+	}
+	if err := s.refresh(); err != nil {
+		writeError(w, http.StatusInternalServerError, "reloading outputs: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"refresh":  "reloaded",
+		"channels": len(s.guide.Load().Schedules),
+	})
+}
+
+// requestRefresh asks the daemon for a full run now, reporting false when
+// there is no daemon. A request made while one is already pending is folded
+// into it.
+func (s *guideServer) requestRefresh() bool {
+	if s.wake == nil {
+		return false
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// validateAliases checks that every line of an alias file is a comment or
+// `alias = provider display name`, and returns the number of aliases.
+func validateAliases(data string) (int, error) {
+	count := 0
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		alias, name, found := strings.Cut(line, "=")
+		if !found || strings.TrimSpace(alias) == "" || strings.TrimSpace(name) == "" {
+			return 0, fmt.Errorf("line %d: expected `alias = provider display name`, got %q", i+1, line)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// writeFileAtomic replaces filename so readers see the old or the new
+// contents, never a partial write. Each write goes through its own temp
+// file, so concurrent writers cannot overwrite each other's before the
+// rename.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// watchAliases polls filename every interval and sends the names of the
+// rules whose alias was added, changed or removed, so the daemon can
+// re-publish just those channels. A change is sent once the file has stayed
+// the same for a whole interval, so an editor's several writes make one
+// batch; changes that arrive while the daemon is busy are merged into the
+// next one.
+func watchAliases(filename string, interval time.Duration, changes chan<- []string) {
+	current, err := loadAliases(filename)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error loading %s: %v", filename, err))
+		current = make(map[string]string)
+	}
+	stamp := aliasFileStamp(filename)
+	settled := true
+	pending := make(map[string]bool)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var send chan<- []string
+		if len(pending) > 0 {
+			send = changes
+		}
+		select {
+		case <-ticker.C:
+			if latest := aliasFileStamp(filename); latest != stamp {
+				stamp, settled = latest, false
+				continue
+			}
+			if settled {
+				continue
+			}
+			settled = true
+			aliases, err := loadAliases(filename)
+			if err != nil {
+				logMessage(fmt.Sprintf("❌ Error loading %s: %v", filename, err))
+				continue
+			}
+			for _, name := range changedAliases(current, aliases) {
+				pending[name] = true
+			}
+			current = aliases
+		case send <- sortedKeys(pending):
+			pending = make(map[string]bool)
+		}
+	}
+}
+
+// aliasFileStamp identifies a version of the alias file by its size and
+// modification time; a missing file has the zero stamp.
+func aliasFileStamp(filename string) string {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// changedAliases returns the aliases, as normalized rule names, that differ
+// between before and after.
+func changedAliases(before, after map[string]string) []string {
+	changed := make(map[string]bool)
+	for alias, target := range after {
+		if before[alias] != target {
+			changed[alias] = true
+		}
+	}
+	for alias := range before {
+		if _, kept := after[alias]; !kept {
+			changed[alias] = true
+		}
+	}
+	return sortedKeys(changed)
+}
+
+// runAliasChange re-publishes only the channels whose rules an alias change
+// touched, matching them again with the new aliases.
+func runAliasChange(server *guideServer, opts *GenerateOptions, names []string) {
+	logMessage(fmt.Sprintf("✏️  %s changed for %d rules: %s", opts.AliasFile, len(names), strings.Join(names, ", ")))
+	aliasOpts := *opts
+	aliasOpts.Only = strings.Join(names, ",")
+	aliasOpts.Skip = ""
+	if err := runGenerate(&aliasOpts); err == nil || errors.Is(err, errCriticalChannels) {
+		server.reload(fmt.Sprintf("Aliased channels refreshed (%d)", len(names)))
+	}
+}
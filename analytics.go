@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Analytics aggregates airtime statistics over the published schedules,
+// written to analytics.json for editorial curation.
+type Analytics struct {
+	GeneratedAt string                   `json:"generated_at,omitempty"`
+	Days        map[string]*DayAnalytics `json:"days"`
+}
+
+type DayAnalytics struct {
+	Genres       []GenreStat   `json:"genres"`
+	Hours        []HourStat    `json:"hours"`
+	BusiestHours []int         `json:"busiest_hours"`
+	Channels     []ChannelStat `json:"channels"`
+	genreIndex   map[string]*GenreStat
+}
+
+type GenreStat struct {
+	Genre      string `json:"genre"`
+	Minutes    int    `json:"minutes"`
+	Programmes int    `json:"programmes"`
+}
+
+type HourStat struct {
+	Hour        int `json:"hour"`
+	Starts      int `json:"starts"`
+	MovieStarts int `json:"movie_starts"`
+}
+
+type ChannelStat struct {
+	ChannelID  string `json:"channel_id"`
+	File       string `json:"file"`
+	Programmes int    `json:"programmes"`
+	Movies     int    `json:"movies"`
+}
+
+func newAnalytics() *Analytics {
+	return &Analytics{Days: make(map[string]*DayAnalytics)}
+}
+
+// add accounts one channel's programmes for the day starting at date.
+// Airtime is clipped to the day so midnight-spanning shows are not counted twice.
+func (a *Analytics) add(identity ChannelIdentity, programmes []Programme, date time.Time, loc *time.Location) {
+	key := date.Format("2006-01-02")
+	day, exists := a.Days[key]
+	if !exists {
+		day = &DayAnalytics{
+			Genres:     make([]GenreStat, 0),
+			Hours:      make([]HourStat, 24),
+			Channels:   make([]ChannelStat, 0),
+			genreIndex: make(map[string]*GenreStat),
+		}
+		for h := range day.Hours {
+			day.Hours[h].Hour = h
+		}
+		a.Days[key] = day
+	}
+
+	dayEnd := date.AddDate(0, 0, 1)
+	stat := ChannelStat{ChannelID: identity.ID, File: identity.File}
+	for _, prog := range programmes {
+		start, err := parseEPGTime(prog.Start, loc)
+		if err != nil {
+			continue
+		}
+		stop, err := parseEPGTime(prog.Stop, loc)
+		if err != nil {
+			continue
+		}
+
+		movie := isMovie(prog)
+		stat.Programmes++
+		if movie {
+			stat.Movies++
+		}
+		if !start.Before(date) {
+			day.Hours[start.Hour()].Starts++
+			if movie {
+				day.Hours[start.Hour()].MovieStarts++
+			}
+		}
+
+		clippedStart, clippedStop := start, stop
+		if clippedStart.Before(date) {
+			clippedStart = date
+		}
+		if clippedStop.After(dayEnd) {
+			clippedStop = dayEnd
+		}
+		minutes := int(clippedStop.Sub(clippedStart).Minutes())
+
+		genres := prog.Categories
+		if len(genres) == 0 {
+			genres = []string{"Uncategorized"}
+		}
+		for _, genre := range genres {
+			genre = strings.TrimSpace(genre)
+			g, exists := day.genreIndex[genre]
+			if !exists {
+				g = &GenreStat{Genre: genre}
+				day.genreIndex[genre] = g
+			}
+			g.Minutes += minutes
+			g.Programmes++
+		}
+	}
+	day.Channels = append(day.Channels, stat)
+}
+
+// Save finalizes the rankings and writes the analytics file.
+func (a *Analytics) Save(out OutputFS, filename string, generatedAt string) error {
+	a.GeneratedAt = generatedAt
+	for _, day := range a.Days {
+		day.Genres = day.Genres[:0]
+		for _, g := range day.genreIndex {
+			day.Genres = append(day.Genres, *g)
+		}
+		sort.Slice(day.Genres, func(i, j int) bool {
+			if day.Genres[i].Minutes != day.Genres[j].Minutes {
+				return day.Genres[i].Minutes > day.Genres[j].Minutes
+			}
+			return day.Genres[i].Genre < day.Genres[j].Genre
+		})
+
+		ranked := make([]HourStat, len(day.Hours))
+		copy(ranked, day.Hours)
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return ranked[i].Starts > ranked[j].Starts
+		})
+		day.BusiestHours = make([]int, 0, 3)
+		for _, h := range ranked[:3] {
+			day.BusiestHours = append(day.BusiestHours, h.Hour)
+		}
+
+		sort.Slice(day.Channels, func(i, j int) bool {
+			return day.Channels[i].ChannelID < day.Channels[j].ChannelID
+		})
+	}
+
+	jsonData, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	return out.WriteFile(filename, jsonData)
+}
+
+// isMovie reports whether any category marks the programme as a film.
+func isMovie(prog Programme) bool {
+	for _, category := range prog.Categories {
+		c := strings.ToLower(category)
+		if strings.Contains(c, "movie") || strings.Contains(c, "film") {
+			return true
+		}
+	}
+	return false
+}
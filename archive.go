@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveDir holds a copy of each day's channel files, one folder per date,
+// so catch-up clients can still fetch a schedule once it has left
+// output-today.
+const archiveDir = "archive"
+
+// archiveIndexFile lists the archived days still retained.
+const archiveIndexFile = "archive-index.json"
+
+// ArchiveIndex is archive-index.json.
+type ArchiveIndex struct {
+	GeneratedAt string       `json:"generated_at,omitempty"`
+	Days        []ArchiveDay `json:"days"`
+}
+
+// ArchiveDay is one archived date and the channel slugs it has files for,
+// under Path.
+type ArchiveDay struct {
+	Date     string   `json:"date"`
+	Path     string   `json:"path"`
+	Channels []string `json:"channels"`
+}
+
+// archiveFS copies every channel file written to today's folder into the
+// day's archive folder too. Patches are not archived, nor the files in
+// except: the kept copies of removed channels, which are not today's.
+type archiveFS struct {
+	OutputFS
+	from, to string
+	except   map[string]*ChannelJSON
+}
+
+func (a archiveFS) WriteFile(name string, data []byte) error {
+	if err := a.OutputFS.WriteFile(name, data); err != nil {
+		return err
+	}
+	if _, kept := a.except[name]; kept {
+		return nil
+	}
+	if file, found := strings.CutPrefix(name, a.from+"/"); found && !strings.Contains(file, "/") && !strings.HasSuffix(file, patchSuffix) {
+		return a.OutputFS.WriteFile(a.to+"/"+file, data)
+	}
+	return nil
+}
+
+// loadArchiveIndex reads the previous archive index from out, where the
+// backend can read files back; otherwise the archive starts afresh.
+func loadArchiveIndex(out OutputFS) ArchiveIndex {
+	var index ArchiveIndex
+	reader, ok := out.(interface {
+		ReadFile(name string) ([]byte, error)
+	})
+	if !ok {
+		return index
+	}
+	if data, err := reader.ReadFile(archiveIndexFile); err == nil {
+		json.Unmarshal(data, &index)
+	}
+	return index
+}
+
+// updateArchive records today's channels in the archive index, drops days
+// older than keepDays from both the index and the archive folder, and saves
+// the index. A partial run adds its channels to today's entry; a full run
+// replaces it.
+func updateArchive(out OutputFS, previous ArchiveIndex, today time.Time, channels []string, keepDays int, partial bool, generatedAt string) (ArchiveIndex, error) {
+	date := today.Format("2006-01-02")
+	cutoff := today.AddDate(0, 0, -keepDays).Format("2006-01-02")
+
+	index := ArchiveIndex{GeneratedAt: generatedAt, Days: make([]ArchiveDay, 0, len(previous.Days)+1)}
+	current := ArchiveDay{Date: date, Path: archiveDir + "/" + date, Channels: channels}
+	for _, day := range previous.Days {
+		switch {
+		case day.Date == date:
+			if partial {
+				current.Channels = append(current.Channels, day.Channels...)
+			}
+		case day.Date < cutoff:
+			out.RemoveAll(day.Path)
+		default:
+			index.Days = append(index.Days, day)
+		}
+	}
+
+	sort.Strings(current.Channels)
+	current.Channels = compactStrings(current.Channels)
+	if len(current.Channels) > 0 {
+		index.Days = append(index.Days, current)
+	}
+	sort.Slice(index.Days, func(i, j int) bool { return index.Days[i].Date > index.Days[j].Date })
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return index, err
+	}
+	return index, out.WriteFile(archiveIndexFile, data)
+}
+
+// compactStrings drops adjacent duplicates from a sorted slice.
+func compactStrings(values []string) []string {
+	result := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// handleArchive serves archive-index.json: the past days catch-up clients
+// can still fetch, newest first.
+func (s *guideServer) handleArchive(w http.ResponseWriter, r *http.Request) {
+	data, err := os.ReadFile(filepath.Join(s.outputRoot, archiveIndexFile))
+	if os.IsNotExist(err) {
+		writeJSON(w, http.StatusOK, ArchiveIndex{Days: []ArchiveDay{}})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// handleArchiveSchedule serves one channel's archived schedule for a date.
+func (s *guideServer) handleArchiveSchedule(w http.ResponseWriter, r *http.Request) {
+	date, channel := r.PathValue("date"), strings.TrimSuffix(r.PathValue("channel"), ".json")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid date: expected YYYY-MM-DD")
+		return
+	}
+	if channel == "" || path.Base(channel) != channel || strings.HasPrefix(channel, ".") {
+		writeError(w, http.StatusNotFound, "unknown channel")
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(s.outputRoot, archiveDir, date, channel+".json"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "no archived schedule for "+channel+" on "+date)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
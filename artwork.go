@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Artwork types, from an image's aspect ratio.
+const (
+	artworkPoster    = "poster"
+	artworkBanner    = "banner"
+	artworkThumbnail = "thumbnail"
+	artworkUnknown   = "unknown"
+)
+
+// Artwork is one programme image, emitted with --artwork.
+type Artwork struct {
+	URL    string `json:"url"`
+	Type   string `json:"type"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// logo is the programme's show logo. Feeds with several icons used to give
+// the last one, so that stays the logo; enrichment appends its image.
+func (p Programme) logo() string {
+	if len(p.Icons) == 0 {
+		return ""
+	}
+	return p.Icons[len(p.Icons)-1].Src
+}
+
+// artwork lists the programme's distinct images in feed order, typed by
+// their declared size.
+func (p Programme) artwork() []Artwork {
+	artwork := make([]Artwork, 0, len(p.Icons))
+	seen := make(map[string]bool)
+	for _, icon := range p.Icons {
+		src := strings.TrimSpace(icon.Src)
+		if src == "" || seen[src] {
+			continue
+		}
+		seen[src] = true
+		width, _ := strconv.Atoi(strings.TrimSpace(icon.Width))
+		height, _ := strconv.Atoi(strings.TrimSpace(icon.Height))
+		artwork = append(artwork, Artwork{URL: src, Type: artworkType(width, height), Width: width, Height: height})
+	}
+	if len(artwork) == 0 {
+		return nil
+	}
+	return artwork
+}
+
+// artworkType classifies an image by aspect ratio: portrait images are
+// posters, images at least twice as wide as tall are banners, and the rest,
+// square to 16:9, thumbnails. Images without a declared size are unknown.
+func artworkType(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return artworkUnknown
+	}
+	ratio := float64(width) / float64(height)
+	switch {
+	case ratio < 0.85:
+		return artworkPoster
+	case ratio >= 2:
+		return artworkBanner
+	default:
+		return artworkThumbnail
+	}
+}
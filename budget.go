@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// descriptionTruncateLength is how long descriptions may stay in the first
+// trimming step, before they are dropped entirely.
+const descriptionTruncateLength = 160
+
+// budgetSteps progressively remove optional data from a schedule, least
+// valuable first. Each step reports whether it changed anything.
+var budgetSteps = []struct {
+	name  string
+	apply func(*ChannelJSON) bool
+}{
+	{"debug fields dropped", func(c *ChannelJSON) bool {
+		changed := false
+		for i := range c.Programs {
+			if c.Programs[i].Debug != nil {
+				c.Programs[i].Debug = nil
+				changed = true
+			}
+		}
+		return changed
+	}},
+	{"artwork dropped", func(c *ChannelJSON) bool {
+		changed := false
+		for i := range c.Programs {
+			if c.Programs[i].Artwork != nil {
+				c.Programs[i].Artwork = nil
+				changed = true
+			}
+		}
+		return changed
+	}},
+	{"external ids dropped", func(c *ChannelJSON) bool {
+		changed := false
+		for i := range c.Programs {
+			if c.Programs[i].URL != "" || c.Programs[i].ExternalIDs != nil {
+				c.Programs[i].URL, c.Programs[i].ExternalIDs = "", nil
+				changed = true
+			}
+		}
+		return changed
+	}},
+	{"credits dropped", func(c *ChannelJSON) bool {
+		changed := false
+		for i := range c.Programs {
+			if c.Programs[i].Credits != nil {
+				c.Programs[i].Credits = nil
+				changed = true
+			}
+		}
+		return changed
+	}},
+	{"descriptions truncated", func(c *ChannelJSON) bool {
+		changed := false
+		truncate := func(desc string) string {
+			if runes := []rune(desc); len(runes) > descriptionTruncateLength {
+				changed = true
+				return strings.TrimSpace(string(runes[:descriptionTruncateLength-1])) + "…"
+			}
+			return desc
+		}
+		for i := range c.Programs {
+			c.Programs[i].Description = truncate(c.Programs[i].Description)
+		}
+		for key, desc := range c.Descriptions {
+			c.Descriptions[key] = truncate(desc)
+		}
+		return changed
+	}},
+	{"descriptions dropped", func(c *ChannelJSON) bool {
+		changed := len(c.Descriptions) > 0
+		c.Descriptions = nil
+		for i := range c.Programs {
+			if c.Programs[i].Description != "" || c.Programs[i].DescriptionRef != "" {
+				c.Programs[i].Description, c.Programs[i].DescriptionRef = "", ""
+				changed = true
+			}
+		}
+		return changed
+	}},
+	{"show logos dropped", func(c *ChannelJSON) bool {
+		changed := false
+		for i := range c.Programs {
+			if c.Programs[i].ShowLogo != "" {
+				c.Programs[i].ShowLogo = ""
+				changed = true
+			}
+		}
+		return changed
+	}},
+}
+
+// marshalWithinBudget encodes the schedule, applying trimming steps until it
+// fits in budget bytes (0 disables the budget). It returns the encoded JSON,
+// the steps that were applied, and whether the result fits.
+func marshalWithinBudget(channelJSON *ChannelJSON, budget int) ([]byte, []string, bool, error) {
+	jsonData, err := json.MarshalIndent(channelJSON, "", "  ")
+	if err != nil || budget <= 0 || len(jsonData) <= budget {
+		return jsonData, nil, true, err
+	}
+
+	trimmed := make([]string, 0)
+	for _, step := range budgetSteps {
+		if !step.apply(channelJSON) {
+			continue
+		}
+		trimmed = append(trimmed, step.name)
+		if jsonData, err = json.MarshalIndent(channelJSON, "", "  "); err != nil {
+			return nil, trimmed, false, err
+		}
+		if len(jsonData) <= budget {
+			return jsonData, trimmed, true, nil
+		}
+	}
+	return jsonData, trimmed, false, nil
+}
+
+// parseByteSize parses sizes such as "200KB", "1.5MB", "2GB" or "51200".
+func parseByteSize(value string) (int, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		factor float64
+	}{{"KB", 1024}, {"MB", 1024 * 1024}, {"GB", 1024 * 1024 * 1024}, {"K", 1024}, {"M", 1024 * 1024}, {"G", 1024 * 1024 * 1024}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			multiplier = unit.factor
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int(n * multiplier), nil
+}
+
+// formatByteSize renders a byte count for log messages.
+func formatByteSize(n int) string {
+	if n >= 1024*1024*1024 {
+		return fmt.Sprintf("%.1fGB", float64(n)/(1024*1024*1024))
+	}
+	if n >= 1024*1024 {
+		return fmt.Sprintf("%.1fMB", float64(n)/(1024*1024))
+	}
+	if n >= 1024 {
+		return fmt.Sprintf("%.1fKB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%dB", n)
+}
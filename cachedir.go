@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// What --cache-dir holds when the paths of the caches are left relative:
+// the feed cache, the state database (--state), serve's Let's Encrypt
+// certificates (--tls-cache) and the temp files downloads are read through.
+// Logos are only ever linked, never downloaded, so none are cached.
+const (
+	cacheFeedsDir   = "feeds"
+	cacheTempDir    = "tmp"
+	defaultTLSCache = "tls-cache"
+)
+
+// feedCacheLock is the lock file in the feed cache that downloads hold
+// shared and pruning exclusively, so a run never evicts a feed another run
+// is downloading into the cache.
+const feedCacheLock = ".lock"
+
+// Modes lockFile takes a lock in.
+type lockMode int
+
+const (
+	lockShared lockMode = iota
+	lockExclusive
+)
+
+// errCacheBusy is a lock another process holds, when lockFile is not to
+// wait for it.
+var errCacheBusy = errors.New("in use by another process")
+
+// staleTempAge is how old a leftover temp file must be before pruning
+// removes it; younger ones may belong to a download in progress.
+const staleTempAge = 24 * time.Hour
+
+// feedTempDir is where readFeedBody keeps downloads in progress, set by
+// startWatchdog: the cache's tmp folder, or the system's temp directory.
+var feedTempDir string
+
+// cachePath returns where a cache setting points: name as given, or inside
+// --cache-dir when one is set and name is relative.
+func (o *GenerateOptions) cachePath(name string) string {
+	if o.CacheDir == "" || name == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(o.CacheDir, name)
+}
+
+// statePath is where the state database is.
+func (o *GenerateOptions) statePath() string {
+	return o.cachePath(o.StateFile)
+}
+
+// feedCache is the feed cache of --feed-cache, which --cache-dir turns on
+// in its feeds folder when not given.
+func (o *GenerateOptions) feedCache() feedDiskCache {
+	dir := o.FeedCache
+	if dir == "" && o.CacheDir != "" {
+		dir = cacheFeedsDir
+	}
+	return feedDiskCache{dir: o.cachePath(dir)}
+}
+
+// tempDir is where downloads in progress are kept, "" for the system's
+// temp directory.
+func (o *GenerateOptions) tempDir() string {
+	if o.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(o.CacheDir, cacheTempDir)
+}
+
+// lock takes url's turn at the feed cache, so two runs sharing it do not
+// write the same feed's files at once: the second waits for the first's
+// download, whose copy it can then be answered from. It returns the
+// function that releases the turn.
+func (c feedDiskCache) lock(url string) (func(), error) {
+	if c.dir == "" {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, err
+	}
+	unlockCache, err := lockFile(filepath.Join(c.dir, feedCacheLock), lockShared, true)
+	if err != nil {
+		return nil, err
+	}
+	feed, _ := c.paths(url)
+	name := strings.TrimSuffix(feed, ".feed") + ".lock"
+	unlockFeed, err := lockFile(name, lockExclusive, false)
+	if errors.Is(err, errCacheBusy) {
+		logMessage("   ⏳ Another run is downloading this feed into the cache, waiting for it")
+		unlockFeed, err = lockFile(name, lockExclusive, true)
+	}
+	if err != nil {
+		unlockCache()
+		return nil, err
+	}
+	return func() {
+		unlockFeed()
+		unlockCache()
+	}, nil
+}
+
+// feedFiles are the files of one feed in the feed cache.
+type feedFiles struct {
+	files    []string
+	size     int64
+	used     time.Time
+	partial  bool
+	complete bool
+}
+
+// scanFeedCache groups the files in dir by feed, for info and pruning.
+func scanFeedCache(dir string) (map[string]*feedFiles, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string]*feedFiles{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	feeds := make(map[string]*feedFiles)
+	for _, entry := range entries {
+		name := entry.Name()
+		key, suffix, found := strings.Cut(name, ".")
+		info, err := entry.Info()
+		if !found || key == "" || err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		feed := feeds[key]
+		if feed == nil {
+			feed = &feedFiles{}
+			feeds[key] = feed
+		}
+		feed.files = append(feed.files, filepath.Join(dir, name))
+		feed.size += info.Size()
+		if info.ModTime().After(feed.used) {
+			feed.used = info.ModTime()
+		}
+		switch suffix {
+		case "feed":
+			feed.complete = true
+		case "partial":
+			feed.partial = true
+		}
+	}
+	return feeds, nil
+}
+
+// pruneFeedCache evicts the feeds used longest ago from the cache in dir
+// until it fits in maxBytes, and removes temp files left in tempDir by
+// downloads that were killed. It returns how many feeds it evicted and the
+// bytes freed. Feeds are evicted whole, with any unfinished download. When
+// another run is downloading into the cache nothing is evicted, and
+// errCacheBusy says so.
+func pruneFeedCache(dir, tempDir string, maxBytes int) (int, int64, error) {
+	var freed int64
+	if tempDir != "" {
+		leftovers, _ := filepath.Glob(filepath.Join(tempDir, "epg-feed-*.partial"))
+		for _, file := range leftovers {
+			if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > staleTempAge && os.Remove(file) == nil {
+				freed += info.Size()
+			}
+		}
+	}
+	if dir == "" || maxBytes <= 0 {
+		return 0, freed, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, freed, err
+	}
+	unlock, err := lockFile(filepath.Join(dir, feedCacheLock), lockExclusive, false)
+	if err != nil {
+		return 0, freed, err
+	}
+	defer unlock()
+	feeds, err := scanFeedCache(dir)
+	if err != nil {
+		return 0, freed, err
+	}
+	var total int64
+	order := make([]*feedFiles, 0, len(feeds))
+	for _, feed := range feeds {
+		total += feed.size
+		// Lock files alone take no space
+		if feed.complete || feed.partial {
+			order = append(order, feed)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].used.Before(order[j].used) })
+	evicted := 0
+	for _, feed := range order {
+		if total <= int64(maxBytes) {
+			break
+		}
+		for _, file := range feed.files {
+			os.Remove(file)
+		}
+		total -= feed.size
+		freed += feed.size
+		evicted++
+	}
+	return evicted, freed, nil
+}
+
+// dirSize returns how many files are under dir and their bytes.
+func dirSize(dir string) (int, int64) {
+	files := 0
+	var bytes int64
+	filepath.WalkDir(dir, func(_ string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			files++
+			bytes += info.Size()
+		}
+		return nil
+	})
+	return files, bytes
+}
+
+// runCache implements `epg cache info`: where each cache is, how much it
+// holds, and whether a run is using the feed cache.
+func runCache(args []string) error {
+	if len(args) == 0 || args[0] != "info" {
+		return fmt.Errorf("usage: epg cache info [--cache-dir DIR] [flags]")
+	}
+	fs := flag.NewFlagSet("cache info", flag.ContinueOnError)
+	tlsCache := fs.String("tls-cache", defaultTLSCache, "serve's Let's Encrypt certificate directory, as given to `epg serve`")
+	opts := registerGenerateFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if opts.envErr != nil {
+		return opts.envErr
+	}
+	maxBytes, err := parseByteSize(opts.CacheMaxSize)
+	if err != nil {
+		return fmt.Errorf("invalid --cache-max-size: %v", err)
+	}
+
+	if opts.CacheDir == "" {
+		fmt.Println("🗃️  No --cache-dir; the caches are where their own flags put them")
+	} else {
+		fmt.Printf("🗃️  Cache directory %s\n", opts.CacheDir)
+	}
+	var total int64
+
+	cache := opts.feedCache()
+	if cache.dir == "" {
+		fmt.Println("   📡 Feed cache: disabled (--feed-cache or --cache-dir turns it on)")
+	} else {
+		feeds, err := scanFeedCache(cache.dir)
+		if err != nil {
+			return err
+		}
+		complete, partial := 0, 0
+		var size int64
+		var oldest, newest time.Time
+		for _, feed := range feeds {
+			size += feed.size
+			if feed.complete {
+				complete++
+			}
+			if feed.partial {
+				partial++
+			}
+			if oldest.IsZero() || feed.used.Before(oldest) {
+				oldest = feed.used
+			}
+			if feed.used.After(newest) {
+				newest = feed.used
+			}
+		}
+		total += size
+		fmt.Printf("   📡 Feed cache %s: %d feeds, %s", cache.dir, complete, formatByteSize(int(size)))
+		if partial > 0 {
+			fmt.Printf(", %d unfinished downloads", partial)
+		}
+		if len(feeds) > 0 {
+			fmt.Printf(", used %s to %s", oldest.Format("2006-01-02 15:04"), newest.Format("2006-01-02 15:04"))
+		}
+		fmt.Println()
+		if unlock, err := lockFile(filepath.Join(cache.dir, feedCacheLock), lockExclusive, false); err == nil {
+			unlock()
+		} else if errors.Is(err, errCacheBusy) {
+			fmt.Println("   🔒 A run is downloading into the feed cache right now")
+		}
+		if maxBytes > 0 {
+			fmt.Printf("   📏 Capped at %s (%.0f%% used)\n", formatByteSize(maxBytes), 100*float64(size)/float64(maxBytes))
+		}
+	}
+
+	if state := opts.statePath(); state == "" {
+		fmt.Println("   🗄️  State database: disabled")
+	} else if info, err := os.Stat(state); err == nil {
+		total += info.Size()
+		fmt.Printf("   🗄️  State database %s: %s\n", state, formatByteSize(int(info.Size())))
+	} else {
+		fmt.Printf("   🗄️  State database %s: not created yet\n", state)
+	}
+
+	if dir := opts.cachePath(*tlsCache); dir != "" {
+		if files, size := dirSize(dir); files > 0 {
+			total += size
+			fmt.Printf("   🔐 TLS certificates %s: %d files, %s\n", dir, files, formatByteSize(int(size)))
+		}
+	}
+	if dir := opts.tempDir(); dir != "" {
+		if files, size := dirSize(dir); files > 0 {
+			total += size
+			fmt.Printf("   🧺 Downloads in progress or left by killed runs %s: %d files, %s\n", dir, files, formatByteSize(int(size)))
+		}
+	}
+	fmt.Printf("\n📦 %s in all\n", formatByteSize(int(total)))
+	return nil
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+// lockFile does not lock on this platform: runs sharing a cache directory
+// are not kept apart.
+func lockFile(path string, mode lockMode, wait bool) (func(), error) {
+	return func() {}, nil
+}
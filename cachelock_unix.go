@@ -0,0 +1,40 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an flock on path, creating it, and returns the function
+// that releases it. Without wait, a lock held elsewhere is errCacheBusy.
+// The lock goes with the process, so a killed run never leaves one behind.
+func lockFile(path string, mode lockMode, wait bool) (func(), error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_EX
+	if mode == lockShared {
+		how = syscall.LOCK_SH
+	}
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	for {
+		err = syscall.Flock(int(file.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errCacheBusy
+		}
+		return nil, err
+	}
+	return func() { file.Close() }, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ProviderRef points at a channel inside one provider's feed.
+type ProviderRef struct {
+	Source string `json:"source"`
+	ID     string `json:"id"`
+}
+
+// ChannelIdentity ties a provider-independent channel ID to the output file
+// and to the provider channels it was built from.
+type ChannelIdentity struct {
+	ID        string        `json:"channel_id"`
+	Name      string        `json:"channel_name"`
+	File      string        `json:"file"`
+	Providers []ProviderRef `json:"provider_ids"`
+	// Deprecated marks a channel removed from the filter whose last files
+	// are still published; see softdelete.go.
+	Deprecated bool `json:"deprecated,omitempty"`
+}
+
+// canonicalChannelID derives an iptv-org style ID from an output name, e.g.
+// "star-plus.json" -> "StarPlus.in". overrides (keyed by file name without
+// extension) take precedence.
+func canonicalChannelID(outputName string, overrides map[string]string) string {
+	slug := strings.TrimSuffix(formatFilename(outputName), ".json")
+	if id, exists := overrides[slug]; exists {
+		return id
+	}
+
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(slug, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return b.String() + ".in"
+}
+
+// loadCanonicalIDs reads `output-name = CanonicalID` overrides. A missing
+// file yields no overrides.
+func loadCanonicalIDs(filename string) (map[string]string, error) {
+	overrides := make(map[string]string)
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return overrides, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		slug := strings.TrimSuffix(formatFilename(strings.TrimSpace(parts[0])), ".json")
+		overrides[slug] = strings.TrimSpace(parts[1])
+	}
+	return overrides, nil
+}
+
+// saveChannelIndex writes channels.json, listing every published channel by
+// canonical ID so consumers can key on it instead of file names.
+func saveChannelIndex(out OutputFS, filename string, identities []ChannelIdentity) error {
+	sorted := make([]ChannelIdentity, len(identities))
+	copy(sorted, identities)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	jsonData, err := json.MarshalIndent(sorted, "", "  ")
+	if err != nil {
+		return err
+	}
+	return out.WriteFile(filename, jsonData)
+}
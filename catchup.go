@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadCatchupWindows reads catchup.txt: `channel = window` lines giving how
+// long a channel's programmes stay available for replay after they start,
+// as a duration such as 72h or a number of days such as 7d. A missing file
+// configures no catch-up.
+func loadCatchupWindows(filename string) (map[string]time.Duration, error) {
+	windows := make(map[string]time.Duration)
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return windows, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %q: expected `channel = window`", line)
+		}
+		window, err := parseCatchupWindow(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", strings.TrimSpace(parts[0]), err)
+		}
+		windows[normalizeChannelName(strings.TrimSpace(parts[0]))] = window
+	}
+	return windows, nil
+}
+
+// parseCatchupWindow parses a window such as 7d, 36h or 90m.
+func parseCatchupWindow(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	var window time.Duration
+	var err error
+	if days, found := strings.CutSuffix(value, "d"); found {
+		var n int
+		n, err = strconv.Atoi(days)
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		window, err = time.ParseDuration(value)
+	}
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid catch-up window %q: expected e.g. 7d or 72h", value)
+	}
+	return window, nil
+}
+
+// catchupWindowFor returns rule's catch-up window, 0 when its channel has
+// none.
+func catchupWindowFor(rule FilterRule, windows map[string]time.Duration) time.Duration {
+	if window, exists := windows[normalizeChannelName(rule.OriginalName)]; exists {
+		return window
+	}
+	return windows[normalizeChannelName(rule.OutputName)]
+}
+
+// catchupAvailable tells whether a programme that ended by now can still be
+// replayed: it started within window of now. Programmes still to end, and
+// channels without a window, get nil, which leaves the field out.
+func catchupAvailable(start, end, now time.Time, window time.Duration) *bool {
+	if window <= 0 || end.After(now) {
+		return nil
+	}
+	available := now.Sub(start) <= window
+	return &available
+}
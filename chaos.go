@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chaosConfig is a parsed --chaos spec: the probability of each fault per
+// feed request (per programme for malformed), and the seed that makes a run
+// repeatable.
+type chaosConfig struct {
+	Fail      float64
+	Status    float64
+	Slow      float64
+	Delay     time.Duration
+	Truncate  float64
+	Malformed float64
+	Seed      int64
+}
+
+// parseChaos reads a --chaos spec such as "fail=0.2,slow=0.5,delay=3s,seed=7".
+func parseChaos(spec string) (*chaosConfig, error) {
+	config := &chaosConfig{Delay: 5 * time.Second, Seed: time.Now().UnixNano()}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return nil, fmt.Errorf("invalid --chaos %q: expected key=value", part)
+		}
+		var err error
+		switch key {
+		case "fail":
+			config.Fail, err = parseProbability(value)
+		case "status":
+			config.Status, err = parseProbability(value)
+		case "slow":
+			config.Slow, err = parseProbability(value)
+		case "truncate":
+			config.Truncate, err = parseProbability(value)
+		case "malformed":
+			config.Malformed, err = parseProbability(value)
+		case "delay":
+			config.Delay, err = time.ParseDuration(value)
+		case "seed":
+			config.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return nil, fmt.Errorf("unknown --chaos fault %q (want fail, status, slow, delay, truncate, malformed or seed)", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid --chaos %s: %v", key, err)
+		}
+	}
+	return config, nil
+}
+
+func parseProbability(value string) (float64, error) {
+	p, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 1 {
+		return 0, fmt.Errorf("%v is not a probability between 0 and 1", p)
+	}
+	return p, nil
+}
+
+// chaosTransport injects faults into feed downloads, standing between the
+// parser and the feed servers like a misbehaving proxy would. It exists so
+// operators can check that retries, optional-source fallbacks and alerting
+// behave before a real outage tests them.
+type chaosTransport struct {
+	config *chaosConfig
+	next   http.RoundTripper
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+// startChaos routes feed downloads through a chaosTransport for spec and
+// returns the function that restores normal downloads.
+func startChaos(spec string) (func(), error) {
+	config, err := parseChaos(spec)
+	if err != nil {
+		return nil, err
+	}
+	previous := feedClient
+	next := previous.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	feedClient = &http.Client{Transport: &chaosTransport{
+		config: config,
+		next:   next,
+		random: rand.New(rand.NewSource(config.Seed)),
+	}}
+	logMessage(fmt.Sprintf("🐒 Chaos mode: injecting faults into feed downloads (seed %d)", config.Seed))
+	return func() { feedClient = previous }, nil
+}
+
+func (t *chaosTransport) chance(p float64) bool {
+	if p == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.random.Float64() < p
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	if t.chance(t.config.Fail) {
+		logMessage(fmt.Sprintf("   🐒 chaos: connection to %s failed", url))
+		return nil, fmt.Errorf("chaos: injected connection failure")
+	}
+	if t.chance(t.config.Status) {
+		logMessage(fmt.Sprintf("   🐒 chaos: %s answered 503", url))
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Retry-After": []string{"1"}},
+			Body:       io.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	}
+	if t.chance(t.config.Slow) {
+		logMessage(fmt.Sprintf("   🐒 chaos: delaying %s by %s", url, t.config.Delay))
+		select {
+		case <-time.After(t.config.Delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	if t.config.Malformed > 0 {
+		if err := t.malform(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	if t.chance(t.config.Truncate) {
+		cut := resp.ContentLength / 2
+		if cut <= 0 {
+			cut = 64 * 1024
+		}
+		logMessage(fmt.Sprintf("   🐒 chaos: cutting %s off after %d bytes", url, cut))
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: cut}
+	}
+	return resp, nil
+}
+
+// chaosAttr matches the attributes malform damages.
+var chaosAttr = regexp.MustCompile(`(<programme\b[^>]*?\b(?:start|stop|channel)=")[^"]*(")`)
+
+// malform damages the start, stop or channel attributes of a share of the
+// programmes in a (possibly gzipped) feed, leaving the document well-formed
+// so the parser's per-programme handling is what gets tested.
+func (t *chaosTransport) malform(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	gzipped := bytes.HasPrefix(body, []byte{0x1f, 0x8b})
+	if gzipped {
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if body, err = io.ReadAll(reader); err != nil {
+			return err
+		}
+	}
+
+	damaged := 0
+	body = chaosAttr.ReplaceAllFunc(body, func(match []byte) []byte {
+		if !t.chance(t.config.Malformed) {
+			return match
+		}
+		damaged++
+		parts := chaosAttr.FindSubmatch(match)
+		return append(append(append([]byte{}, parts[1]...), "chaos"...), parts[2]...)
+	})
+	logMessage(fmt.Sprintf("   🐒 chaos: damaged %d programme attributes in %s", damaged, resp.Request.URL))
+
+	if gzipped {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		writer.Write(body)
+		writer.Close()
+		body = buf.Bytes()
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return nil
+}
+
+// truncatedBody ends a response part-way as a dropped connection would.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// hideFlags leaves the named flags out of fs's usage message; they still
+// work when given.
+func hideFlags(fs *flag.FlagSet, hidden ...string) {
+	fs.Usage = func() {
+		visible := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+		visible.SetOutput(fs.Output())
+		fs.VisitAll(func(f *flag.Flag) {
+			for _, name := range hidden {
+				if f.Name == name {
+					return
+				}
+			}
+			visible.Var(f.Value, f.Name, f.Usage)
+		})
+		fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+		visible.PrintDefaults()
+	}
+}
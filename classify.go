@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Programme kinds emitted with --kind.
+const (
+	kindMovie  = "movie"
+	kindSeries = "series"
+	kindSports = "sports"
+	kindNews   = "news"
+	kindOther  = "other"
+)
+
+// kindEvidence is the score at which a kind is fully trusted; weaker
+// evidence lowers the confidence proportionally.
+const kindEvidence = 5.0
+
+// kindCategories map feed category keywords to kinds. Strong keywords name
+// the kind outright; weak ones ("drama", "comedy") also describe films.
+var kindCategories = []struct {
+	keyword string
+	kind    string
+	weight  float64
+}{
+	{"movie", kindMovie, 4}, {"film", kindMovie, 4}, {"cinema", kindMovie, 4},
+	{"sport", kindSports, 4}, {"cricket", kindSports, 4}, {"football", kindSports, 4},
+	{"kabaddi", kindSports, 4}, {"tennis", kindSports, 4}, {"wrestling", kindSports, 4},
+	{"news", kindNews, 4}, {"current affairs", kindNews, 4},
+	{"series", kindSeries, 4}, {"serial", kindSeries, 4}, {"soap", kindSeries, 4},
+	{"episodic", kindSeries, 4}, {"reality", kindSeries, 2}, {"talk", kindSeries, 1},
+	{"drama", kindSeries, 1}, {"comedy", kindSeries, 1}, {"kids", kindSeries, 1},
+}
+
+var (
+	newsTitle   = regexp.MustCompile(`(?i)\b(news|samachar|bulletin|headlines|khabar|khabrein)\b`)
+	sportsTitle = regexp.MustCompile(`(?i)\b(vs\.?|v/s|highlights|ipl|t20|odi|test match|world cup|league|grand prix)\b`)
+	liveTitle   = regexp.MustCompile(`(?i)\blive\b`)
+	movieTitle  = regexp.MustCompile(`(?i)\b(movie|film|cinema|blockbuster)\b`)
+)
+
+// classifyProgramme guesses what kind of programme prog is from its
+// categories, duration, episode numbering and title, returning the kind and
+// a confidence between 0 and 1. Programmes without any evidence are "other"
+// with confidence 0.
+func classifyProgramme(prog Programme, start, end time.Time) (string, float64) {
+	scores := make(map[string]float64)
+
+	for _, category := range prog.Categories {
+		category = strings.ToLower(category)
+		for _, rule := range kindCategories {
+			if strings.Contains(category, rule.keyword) {
+				scores[rule.kind] += rule.weight
+			}
+		}
+	}
+
+	// Films run long; episodes fill half-hour and hour slots
+	switch duration := end.Sub(start); {
+	case duration >= 90*time.Minute:
+		scores[kindMovie] += 2
+	case duration >= 20*time.Minute && duration <= 65*time.Minute:
+		scores[kindSeries] += 1
+	}
+	if prog.episode() != "" {
+		scores[kindSeries] += 1.5
+	}
+
+	if newsTitle.MatchString(prog.Title) {
+		scores[kindNews] += 2
+	}
+	if sportsTitle.MatchString(prog.Title) {
+		scores[kindSports] += 2
+	}
+	if liveTitle.MatchString(prog.Title) {
+		scores[kindSports] += 0.5
+		scores[kindNews] += 0.5
+	}
+	if movieTitle.MatchString(prog.Title) {
+		scores[kindMovie] += 1
+	}
+
+	best, bestScore, total := kindOther, 0.0, 0.0
+	for _, kind := range []string{kindMovie, kindSeries, kindSports, kindNews} {
+		total += scores[kind]
+		if scores[kind] > bestScore {
+			best, bestScore = kind, scores[kind]
+		}
+	}
+	if bestScore == 0 {
+		return kindOther, 0
+	}
+	confidence := bestScore / total * math.Min(1, bestScore/kindEvidence)
+	return best, math.Round(confidence*100) / 100
+}
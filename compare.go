@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ChannelComparison is one filter rule and what each source lists for it
+// over the generated days. Best is the source with the most airtime, ties
+// going to the one with more descriptions and then to provider priority.
+type ChannelComparison struct {
+	Rule    string           `json:"rule"`
+	Pinned  string           `json:"pinned,omitempty"`
+	Best    string           `json:"best,omitempty"`
+	Sources []SourceCoverage `json:"sources"`
+}
+
+// SourceCoverage is one source's copy of a channel. Coverage is the share of
+// the generated days its programmes cover; WithDescription and WithIcon are
+// the shares of its programmes that have one.
+type SourceCoverage struct {
+	Source          string  `json:"source"`
+	ChannelID       string  `json:"channel_id"`
+	Name            string  `json:"channel_name"`
+	Programmes      int     `json:"programmes"`
+	Hours           float64 `json:"hours"`
+	Coverage        float64 `json:"coverage"`
+	WithDescription float64 `json:"with_description"`
+	WithIcon        float64 `json:"with_icon"`
+}
+
+// runCompare implements `epg compare`: it looks every filter rule up in each
+// source on its own, rather than stopping at the first that has it, and
+// reports what each one lists, so a rule can be pinned to the provider that
+// serves it best.
+func runCompare(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	jsonFile := fs.String("json", "", "also write the report as JSON to this file")
+	setup, err := prepareMatch(fs, args)
+	if err != nil {
+		return err
+	}
+	defer setup.store.Close()
+
+	report := make([]ChannelComparison, 0, len(setup.rules))
+	missing := 0
+	for _, rule := range setup.rules {
+		comparison := compareSources(setup, rule)
+		if len(comparison.Sources) == 0 {
+			missing++
+		}
+		report = append(report, comparison)
+	}
+
+	fmt.Printf("\n📊 %d rules compared across %d sources; %d found in none\n", len(report), len(setup.sources), missing)
+	for _, comparison := range report {
+		if len(comparison.Sources) == 0 {
+			fmt.Printf("\n❌ %s: in no source\n", comparison.Rule)
+			continue
+		}
+		pinned := ""
+		if comparison.Pinned != "" {
+			pinned = ", pinned to " + comparison.Pinned
+		}
+		fmt.Printf("\n📺 %s: best %s%s\n", comparison.Rule, comparison.Best, pinned)
+		for _, s := range comparison.Sources {
+			fmt.Printf("   %-10s %-30s %5d programmes %6.1fh %5.1f%% coverage %5.1f%% desc %5.1f%% icons\n",
+				s.Source, truncate(s.Name+" ("+s.ChannelID+")", 30), s.Programmes, s.Hours, s.Coverage*100, s.WithDescription*100, s.WithIcon*100)
+		}
+	}
+
+	if *jsonFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*jsonFile, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("\n💾 Report written to %s\n", *jsonFile)
+	}
+	return nil
+}
+
+// compareSources matches rule against each source separately and measures
+// the copy each one has for the generated days.
+func compareSources(setup *matchSetup, rule FilterRule) ChannelComparison {
+	loc, today := setup.ruleDays(rule)
+	start, end := today, today.AddDate(0, 0, setup.opts.Days)
+	window := end.Sub(start)
+
+	comparison := ChannelComparison{Rule: rule.OriginalName, Pinned: rule.Source, Sources: make([]SourceCoverage, 0)}
+	best := -1
+	for _, src := range setup.sources {
+		match := setup.matcher.Match(rule, []*EPGSource{src})
+		if match == nil {
+			continue
+		}
+		listed := airtime(match.Programmes, start, end, loc)
+		coverage := SourceCoverage{
+			Source:    src.Name,
+			ChannelID: match.Channel.ID,
+			Name:      match.Channel.DisplayName,
+			Hours:     listed.Hours(),
+		}
+		if window > 0 {
+			coverage.Coverage = float64(listed) / float64(window)
+		}
+		coverage.Programmes, coverage.WithDescription, coverage.WithIcon = programmeDetails(match.Programmes, start, end, loc)
+		comparison.Sources = append(comparison.Sources, coverage)
+
+		if i := len(comparison.Sources) - 1; best < 0 || betterCoverage(coverage, comparison.Sources[best]) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		comparison.Best = comparison.Sources[best].Source
+	}
+	return comparison
+}
+
+// betterCoverage reports whether a lists more airtime than b, or as much
+// with more descriptions.
+func betterCoverage(a, b SourceCoverage) bool {
+	if a.Coverage != b.Coverage {
+		return a.Coverage > b.Coverage
+	}
+	return a.WithDescription > b.WithDescription
+}
+
+// programmeDetails counts the programmes airing in [start, end) and the
+// shares of them with a description and with an image.
+func programmeDetails(programmes []Programme, start, end time.Time, loc *time.Location) (count int, withDesc, withIcon float64) {
+	described, illustrated := 0, 0
+	for _, prog := range programmes {
+		progStart, errStart := parseEPGTime(prog.Start, loc)
+		progEnd, errEnd := parseEPGTime(prog.Stop, loc)
+		if errStart != nil || errEnd != nil || !progStart.Before(end) || !progEnd.After(start) {
+			continue
+		}
+		count++
+		if prog.Desc != "" {
+			described++
+		}
+		if len(prog.Icons) > 0 {
+			illustrated++
+		}
+	}
+	if count == 0 {
+		return 0, 0, 0
+	}
+	return count, float64(described) / float64(count), float64(illustrated) / float64(count)
+}
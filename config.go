@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// runConfig is the configuration a generation run reads from files: the
+// filter rules and the feeds to download. One-off runs load it as they start;
+// long-running processes hold one in a configHolder and reload it on SIGHUP,
+// so an edit takes effect on the next cycle and a broken or half-saved file
+// never reaches a run.
+type runConfig struct {
+	Rules     []FilterRule
+	Providers []Provider
+	LoadedAt  time.Time
+}
+
+// loadRunConfig reads the filter and sources files opts names. With
+// --all-channels there is no filter to read; the rules come from the feeds.
+func loadRunConfig(opts *GenerateOptions) (*runConfig, error) {
+	var rules []FilterRule
+	if !opts.AllChannels {
+		var err error
+		if rules, err = loadFilterRules(opts.FilterFile); err != nil {
+			return nil, fmt.Errorf("loading %s: %v", opts.FilterFile, err)
+		}
+	}
+	providers, err := opts.providers()
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %v", opts.SourcesFile, err)
+	}
+	return &runConfig{Rules: rules, Providers: providers, LoadedAt: time.Now()}, nil
+}
+
+// configHolder is the current runConfig of a long-running process. Reload
+// swaps in a new one only when it loads cleanly.
+type configHolder struct {
+	opts    *GenerateOptions
+	mu      sync.RWMutex
+	current *runConfig
+}
+
+// newConfigHolder loads the initial configuration; an error here stops the
+// process from starting with a broken one.
+func newConfigHolder(opts *GenerateOptions) (*configHolder, error) {
+	config, err := loadRunConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &configHolder{opts: opts, current: config}, nil
+}
+
+// Get returns the configuration for the next run.
+func (h *configHolder) Get() *runConfig {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.current
+}
+
+// Reload reads the files again. On failure the previous configuration stays
+// in use and the error is returned.
+func (h *configHolder) Reload() error {
+	config, err := loadRunConfig(h.opts)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.current = config
+	h.mu.Unlock()
+	return nil
+}
+
+// reloadOnSignal reloads the configuration each time the process receives
+// SIGHUP (where the platform has one), logging the outcome.
+func (h *configHolder) reloadOnSignal() {
+	for range notifyReload() {
+		if err := h.Reload(); err != nil {
+			logMessage(fmt.Sprintf("❌ SIGHUP: keeping the previous configuration: %v", err))
+			continue
+		}
+		config := h.Get()
+		logMessage(fmt.Sprintf("🔃 SIGHUP: reloaded %s and %s (%d rules, %d feeds); used from the next run", h.opts.FilterFile, h.opts.SourcesFile, len(config.Rules), len(config.Providers)))
+	}
+}
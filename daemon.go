@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// daemonSchedule says how often `epg serve` regenerates outputs. Volatile
+// channels (news, sports) are re-published every VolatileEvery from the
+// cached feeds, refreshed with conditional requests; everything is
+// regenerated every FullEvery. Batches of rule names on AliasChanges are
+// re-published as they arrive; a nil channel never delivers.
+type daemonSchedule struct {
+	FullEvery     time.Duration
+	VolatileEvery time.Duration
+	VolatileFile  string
+	AliasChanges  <-chan []string
+}
+
+// loadVolatileChannels reads one channel name per line, as written in
+// filter.txt. A missing file means no channel is volatile.
+func loadVolatileChannels(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	channels := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		channels = append(channels, line)
+	}
+	return channels, nil
+}
+
+// runDaemon regenerates outputs on schedule and swaps each result into the
+// server. Runs happen one at a time; a volatile run that falls due together
+// with a full run is folded into it. A request on server.wake starts a full
+// run early, and an alias change re-publishes the channels it touched.
+// Each run uses the configuration config holds at its start.
+func runDaemon(server *guideServer, opts *GenerateOptions, schedule daemonSchedule, config *configHolder) {
+	opts.feeds = newFeedCache()
+	nextFull := time.Now()
+	nextVolatile := time.Time{}
+
+	for {
+		now := time.Now()
+		opts.config = config.Get()
+		if !now.Before(nextFull) {
+			if err := runGenerate(opts); err == nil || errors.Is(err, errCriticalChannels) {
+				server.reload("Guide refreshed")
+			}
+			nextFull = now.Add(schedule.FullEvery)
+			if schedule.VolatileEvery > 0 {
+				nextVolatile = now.Add(schedule.VolatileEvery)
+			}
+		} else if schedule.VolatileEvery > 0 && !now.Before(nextVolatile) {
+			runVolatile(server, opts, schedule.VolatileFile)
+			nextVolatile = now.Add(schedule.VolatileEvery)
+		}
+
+		wake := nextFull
+		if schedule.VolatileEvery > 0 && nextVolatile.Before(wake) {
+			wake = nextVolatile
+		}
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-timer.C:
+		case <-server.wake:
+			logMessage("🛎️  Refresh requested via the admin API")
+			nextFull = time.Now()
+		case names := <-schedule.AliasChanges:
+			runAliasChange(server, opts, names)
+		}
+		timer.Stop()
+	}
+}
+
+// runVolatile re-publishes only the channels listed in the volatile file.
+func runVolatile(server *guideServer, opts *GenerateOptions, volatileFile string) {
+	channels, err := loadVolatileChannels(volatileFile)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error loading %s: %v", volatileFile, err))
+		return
+	}
+	if len(channels) == 0 {
+		return
+	}
+
+	volatileOpts := *opts
+	volatileOpts.Only = strings.Join(channels, ",")
+	volatileOpts.Skip = ""
+	if err := runGenerate(&volatileOpts); err == nil || errors.Is(err, errCriticalChannels) {
+		server.reload(fmt.Sprintf("Volatile channels refreshed (%d)", len(channels)))
+	}
+}
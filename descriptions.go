@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// descriptionKeyLength is how many hex digits of a description's SHA-256
+// make its key in the descriptions table.
+const descriptionKeyLength = 12
+
+// descriptionKey is the key of desc in a schedule's descriptions table. It
+// depends on the text alone, so the same description has the same key in
+// every file and run.
+func descriptionKey(desc string) string {
+	sum := sha256.Sum256([]byte(desc))
+	return hex.EncodeToString(sum[:])[:descriptionKeyLength]
+}
+
+// dedupeDescriptions moves the schedule's programme descriptions into its
+// descriptions table, for --dedupe-descriptions, leaving each programme a
+// description_ref. Repeated descriptions are then written once per file.
+func dedupeDescriptions(c *ChannelJSON) {
+	for i := range c.Programs {
+		desc := c.Programs[i].Description
+		if desc == "" {
+			continue
+		}
+		key := descriptionKey(desc)
+		if existing, exists := c.Descriptions[key]; exists && existing != desc {
+			// A key collision keeps the description inline
+			continue
+		}
+		if c.Descriptions == nil {
+			c.Descriptions = make(map[string]string)
+		}
+		c.Descriptions[key] = desc
+		c.Programs[i].Description, c.Programs[i].DescriptionRef = "", key
+	}
+}
+
+// description returns the programme's description, looked up in the
+// schedule's table when it has a description_ref.
+func (c *ChannelJSON) description(prog ProgramJSON) string {
+	if prog.DescriptionRef != "" {
+		return c.Descriptions[prog.DescriptionRef]
+	}
+	return prog.Description
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// slugSeparators are the runs of characters a discovered channel's slug
+// replaces with a dash.
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// discoverRules makes a filter rule for every channel the sources carry, for
+// --all-channels. Sources are in priority order; a channel found under the
+// same name in a later source becomes the same rule, so the overlap strategy
+// decides between the copies as it does for a curated filter. Each rule
+// matches the provider's cleaned display name and writes to a slug of it.
+// Names without Latin letters or digits cannot be matched by name; they are
+// left out and counted in skipped.
+func discoverRules(providers []Provider, sources []*EPGSource) (rules []FilterRule, skipped int) {
+	cleaners := make(map[string]Provider, len(providers))
+	for _, provider := range providers {
+		cleaners[provider.Name] = provider
+	}
+
+	rules = make([]FilterRule, 0)
+	seen := make(map[string]bool)
+	for _, src := range sources {
+		provider := cleaners[src.Name]
+		for _, ch := range src.TV.Channels {
+			name := strings.TrimSpace(ch.DisplayName)
+			if provider.CleanName != nil {
+				name = strings.TrimSpace(provider.CleanName(name))
+			}
+			slug := channelSlug(name)
+			if slug == "" {
+				skipped++
+				continue
+			}
+			key := normalizeChannelName(name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			rules = append(rules, FilterRule{OriginalName: name, OutputName: slug})
+		}
+	}
+	return rules, skipped
+}
+
+// channelSlug lowercases name and joins its words with dashes:
+// "Star Plus HD" becomes "star-plus-hd".
+func channelSlug(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes the serve endpoints; keep it in step with routes.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// docsPage is a self-contained explorer that renders openAPISpec and lets
+// readers call each endpoint from the browser.
+//
+//go:embed docs.html
+var docsPage []byte
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(openAPISpec)
+}
+
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
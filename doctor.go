@@ -0,0 +1,410 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// minFreeDisk is the free space below which `epg doctor` fails the disk
+// check. A full run writes a few megabytes of JSON plus logs and state.
+const minFreeDisk = 100 * 1024 * 1024
+
+// maxClockSkew is how far the local clock may drift from a source's Date
+// header before schedules are likely to be cut on the wrong day.
+const maxClockSkew = 5 * time.Minute
+
+// doctorCheck is the outcome of one pre-flight check. Fix says what to do
+// when the check did not pass.
+type doctorCheck struct {
+	Name   string
+	OK     bool
+	Warn   bool
+	Detail string
+	Fix    string
+}
+
+// runDoctor implements `epg doctor`: it checks everything a generation run
+// depends on and prints a fix for each problem, so a scheduled job can be
+// trusted before it first fails at night. It accepts the generate flags and
+// checks the configuration they select.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	opts := registerGenerateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Println("🩺 Running pre-flight checks...")
+	checks := []doctorCheck{checkEnvironment(opts.envErr), checkTimezone(opts.Timezone, opts.TimezoneFallback)}
+	providers, err := opts.providers()
+	if err != nil {
+		checks = append(checks, doctorCheck{
+			Name:   "Sources",
+			Detail: err.Error(),
+			Fix:    "fix " + opts.SourcesFile + ": one `name = URL` per line",
+		})
+		if isSourcesConfig(opts.SourcesFile) {
+			checks[len(checks)-1].Fix = "fix " + opts.SourcesFile + ": a `sources` list of entries with a name, url and optional priority"
+		}
+	}
+	proxy, err := feedProxy(opts.Proxy)
+	if err != nil {
+		checks = append(checks, doctorCheck{Name: "Proxy", Detail: err.Error(), Fix: "fix --proxy or $EPG_PROXY"})
+		proxy = http.ProxyFromEnvironment
+	}
+	var roots *x509.CertPool
+	if opts.CACert != "" {
+		if roots, err = loadCAPool(opts.CACert); err != nil {
+			checks = append(checks, doctorCheck{Name: "CA certificate", Detail: err.Error(), Fix: "give --ca-cert a PEM file of CA certificates"})
+		}
+	}
+	sourceChecks, serverDate := checkSources(providers, proxy, roots)
+	checks = append(checks, sourceChecks...)
+	checks = append(checks,
+		checkClock(time.Now(), serverDate),
+		checkFilterFile(opts.FilterFile),
+		checkAliasFile(opts.AliasFile),
+		checkLogoFile(opts.LogoFile),
+		checkLineups(opts.LineupDir),
+		checkOutput(opts.Output),
+		checkDiskSpace(opts.Output),
+		checkStateFile(opts.statePath()),
+	)
+
+	failed := printChecks(checks)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	fmt.Println("\n🎉 All checks passed")
+	return nil
+}
+
+// checkEnvironment reports EPG_* variables that are not valid flag values.
+func checkEnvironment(envErr error) doctorCheck {
+	check := doctorCheck{Name: "Environment"}
+	if envErr != nil {
+		check.Detail = envErr.Error()
+		check.Fix = "correct or unset the variable; command-line flags override the environment"
+		return check
+	}
+	check.OK = true
+	check.Detail = "EPG_* variables are valid"
+	return check
+}
+
+// printChecks prints each check with its fix and returns how many failed.
+func printChecks(checks []doctorCheck) int {
+	failed := 0
+	for _, check := range checks {
+		switch {
+		case check.OK:
+			fmt.Printf("✅ %s: %s\n", check.Name, check.Detail)
+		case check.Warn:
+			fmt.Printf("⚠️  %s: %s\n   👉 %s\n", check.Name, check.Detail, check.Fix)
+		default:
+			failed++
+			fmt.Printf("❌ %s: %s\n   👉 %s\n", check.Name, check.Detail, check.Fix)
+		}
+	}
+	return failed
+}
+
+func checkTimezone(name, fallback string) doctorCheck {
+	check := doctorCheck{Name: "Timezone"}
+	loc, fellBack, err := loadTimezone(name, fallback)
+	if err != nil {
+		check.Detail = err.Error()
+		check.Fix = "install the tzdata package (e.g. apt-get install tzdata) or set ZONEINFO to a zoneinfo.zip"
+		return check
+	}
+	if fellBack {
+		check.Warn = true
+		check.Detail = fmt.Sprintf("%s not available; runs fall back to the fixed offset %s", name, loc)
+		check.Fix = "install the tzdata package (e.g. apt-get install tzdata) or set ZONEINFO to a zoneinfo.zip"
+		return check
+	}
+	check.OK = true
+	check.Detail = name + " loaded, now " + time.Now().In(loc).Format("2006-01-02 15:04 MST")
+	return check
+}
+
+// checkSources sends a HEAD request to every feed through proxy, trusting
+// roots besides the system's CAs and each feed's TLS settings (see
+// feedTLS), or checks that a local feed file exists; failures of optional
+// providers are only warnings. It also returns the most recent server Date
+// header seen, for the clock check.
+func checkSources(feeds []Provider, proxy func(*http.Request) (*url.URL, error), roots *x509.CertPool) ([]doctorCheck, time.Time) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	if roots != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	base := &http.Client{Timeout: 20 * time.Second, Transport: transport}
+	var serverDate time.Time
+	checks := make([]doctorCheck, 0, len(feeds))
+
+	for _, feed := range feeds {
+		url := feed.URL
+		check := doctorCheck{Name: feed.Name + " source"}
+		if !feed.isXMLTV() {
+			check.OK = true
+			check.Detail = fmt.Sprintf("%s source, checked when it is fetched", feed.Type)
+			checks = append(checks, check)
+			continue
+		}
+		if path, local := localFeedPath(url); local {
+			if info, err := os.Stat(path); err != nil {
+				check.Warn = !feed.Required
+				check.Detail = err.Error()
+				check.Fix = "download the feed to " + path + " first, or fix the path in the sources file"
+			} else {
+				check.OK = true
+				check.Detail = fmt.Sprintf("%s readable (%s, modified %s)", path, formatByteSize(int(info.Size())), info.ModTime().Format(time.RFC3339))
+			}
+			checks = append(checks, check)
+			continue
+		}
+		client := base
+		if config, found := feedTLS[url]; found {
+			own := transport.Clone()
+			own.TLSClientConfig = config
+			client = &http.Client{Timeout: base.Timeout, Transport: own}
+		}
+		resp, err := client.Head(url)
+		if err != nil {
+			check.Warn = !feed.Required
+			check.Detail = err.Error()
+			check.Fix = "check network access and DNS for " + url + ", or the proxy (--proxy, HTTPS_PROXY)"
+			if errors.As(err, new(*tls.CertificateVerificationError)) {
+				check.Fix = "trust the CA that signed " + url + "'s certificate with --ca-cert or ca_cert in sources.yaml, or as a last resort --insecure-skip-verify " + feed.Name
+			}
+			checks = append(checks, check)
+			continue
+		}
+		resp.Body.Close()
+
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			serverDate = date
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			check.OK = true
+			check.Detail = fmt.Sprintf("%s reachable (%s)", url, resp.Status)
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+			check.Warn = true
+			check.Detail = fmt.Sprintf("%s is throttling (%s)", url, resp.Status)
+			check.Fix = "runs will wait and retry; schedule the job away from the top of the hour"
+		default:
+			check.Detail = fmt.Sprintf("%s returned %s", url, resp.Status)
+			check.Warn = !feed.Required
+			check.Fix = "the feed may have moved; check the upstream provider for the current URL"
+		}
+		checks = append(checks, check)
+	}
+	return checks, serverDate
+}
+
+func checkClock(now, serverDate time.Time) doctorCheck {
+	check := doctorCheck{Name: "Clock"}
+	if now.Year() < 2024 {
+		check.Detail = "local clock reads " + now.Format(time.RFC3339)
+		check.Fix = "enable NTP (e.g. timedatectl set-ntp true)"
+		return check
+	}
+	if serverDate.IsZero() {
+		check.Warn = true
+		check.Detail = "no source returned a Date header to compare against"
+		check.Fix = "verify the system clock is synchronised with NTP"
+		return check
+	}
+
+	skew := now.Sub(serverDate)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		check.Detail = fmt.Sprintf("local clock is %s away from the source servers", skew.Round(time.Second))
+		check.Fix = "enable NTP (e.g. timedatectl set-ntp true); a skewed clock cuts schedules on the wrong day"
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("within %s of the source servers", skew.Round(time.Second))
+	return check
+}
+
+func checkFilterFile(filename string) doctorCheck {
+	check := doctorCheck{Name: "Filter"}
+	rules, err := loadFilterRules(filename)
+	if err != nil {
+		check.Detail = err.Error()
+		check.Fix = "create " + filename + " with one channel name per line (optional `Source Name = output-name`)"
+		if isYAMLFilter(filename) {
+			check.Fix = "fix " + filename + ": a `channels:` list of entries with a `name` and the options in the README"
+		}
+		return check
+	}
+	if len(rules) == 0 {
+		check.Detail = filename + " has no channel rules"
+		check.Fix = "add one channel name per line to " + filename
+		return check
+	}
+
+	outputs := make(map[string]string)
+	for _, rule := range rules {
+		file := formatFilename(rule.OutputName)
+		if previous, exists := outputs[file]; exists {
+			check.Warn = true
+			check.Detail = fmt.Sprintf("%q and %q both write %s", previous, rule.OriginalName, file)
+			check.Fix = "give one of them a different output name with `Source Name = output-name`"
+			return check
+		}
+		outputs[file] = rule.OriginalName
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%s parsed, %d channel rules", filename, len(rules))
+	return check
+}
+
+func checkAliasFile(filename string) doctorCheck {
+	check := doctorCheck{Name: "Aliases"}
+	aliases, err := loadAliases(filename)
+	if err != nil {
+		check.Detail = err.Error()
+		check.Fix = "fix the permissions on " + filename + " or pass --aliases with a readable file"
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%d aliases", len(aliases))
+	return check
+}
+
+func checkLogoFile(filename string) doctorCheck {
+	check := doctorCheck{Name: "Logos"}
+	logos, err := loadLogoCatalog(filename)
+	if err != nil {
+		check.Detail = err.Error()
+		check.Fix = "fix " + filename + ": one `channel = https://... .png` per line"
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%d catalog logos", len(logos))
+	return check
+}
+
+func checkLineups(dir string) doctorCheck {
+	check := doctorCheck{Name: "Lineups"}
+	lineups, err := loadLineups(dir)
+	if err != nil {
+		check.Detail = err.Error()
+		check.Fix = "fix the lineup file: one `number = channel ID or name` per line"
+		return check
+	}
+	numbers := 0
+	for _, lineup := range lineups {
+		numbers += len(lineup)
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%d channel numbers from %d providers", numbers, len(lineups))
+	return check
+}
+
+// checkOutput validates the selected backend and writes and removes a probe
+// file in the local directory it writes to. Zip archives are not opened, as
+// that would truncate an existing one.
+func checkOutput(target string) doctorCheck {
+	check := doctorCheck{Name: "Output"}
+	dir, create := target, true
+	switch {
+	case strings.HasPrefix(target, "zip://"):
+		// The archive's directory must already exist.
+		dir, create = filepath.Dir(strings.TrimPrefix(target, "zip://")), false
+	case strings.Contains(target, "://"):
+		out, err := openOutput(target)
+		if err != nil {
+			check.Detail = err.Error()
+			check.Fix = "pass --output with a directory, zip://file.zip, s3://bucket/prefix or mem://"
+			return check
+		}
+		out.Close()
+		check.OK = true
+		check.Detail = target + " configured"
+		return check
+	}
+
+	probe := filepath.Join(dir, ".epg-doctor-probe")
+	var err error
+	if create {
+		err = os.MkdirAll(dir, 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(probe, []byte("ok"), 0644)
+	}
+	if err != nil {
+		check.Detail = err.Error()
+		check.Fix = "make " + dir + " writable by this user, or choose another --output"
+		return check
+	}
+	os.Remove(probe)
+	check.OK = true
+	check.Detail = dir + " is writable"
+	return check
+}
+
+func checkDiskSpace(target string) doctorCheck {
+	check := doctorCheck{Name: "Disk space"}
+	if strings.HasPrefix(target, "zip://") {
+		target = filepath.Dir(strings.TrimPrefix(target, "zip://"))
+	} else if strings.Contains(target, "://") {
+		target = "."
+	}
+	free, err := freeDiskSpace(target)
+	if err != nil {
+		check.Warn = true
+		check.Detail = "could not determine free space: " + err.Error()
+		check.Fix = fmt.Sprintf("make sure at least %s is free", formatByteSize(minFreeDisk))
+		return check
+	}
+	if free < minFreeDisk {
+		check.Detail = fmt.Sprintf("only %s free", formatByteSize(int(free)))
+		check.Fix = fmt.Sprintf("free at least %s, e.g. by removing old logs", formatByteSize(minFreeDisk))
+		return check
+	}
+	check.OK = true
+	check.Detail = formatByteSize(int(free)) + " free"
+	return check
+}
+
+func checkStateFile(filename string) doctorCheck {
+	check := doctorCheck{Name: "State database"}
+	if filename == "" {
+		check.OK = true
+		check.Detail = "disabled"
+		return check
+	}
+	store, err := openStateStore(filename)
+	if err != nil {
+		check.Detail = err.Error()
+		check.Fix = "stop any other run or `epg serve` using " + filename + ", or delete it to start fresh"
+		return check
+	}
+	defer store.Close()
+
+	run, found := store.LastRun()
+	if !found {
+		check.OK = true
+		check.Detail = filename + " opened, no previous runs"
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%s opened, last run finished %s", filename, run.FinishedAt)
+	return check
+}
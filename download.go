@@ -0,0 +1,310 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxThrottleRetries is how many times a rate-limited request is retried.
+	maxThrottleRetries = 3
+	// maxRetryAfterWait caps how long we honour a Retry-After; longer waits fail fast.
+	maxRetryAfterWait = 2 * time.Minute
+	// defaultRetryAfterWait is used when a 429/503 carries no usable Retry-After.
+	defaultRetryAfterWait = 15 * time.Second
+	// maxResumeAttempts is how many times an interrupted feed download is
+	// resumed with a Range request before giving up.
+	maxResumeAttempts = 5
+)
+
+// ThrottleEvent records one rate-limited response from a source.
+type ThrottleEvent struct {
+	Timestamp  string
+	URL        string
+	Status     int
+	RetryAfter string
+	Waited     time.Duration
+	GaveUp     bool
+}
+
+var throttleEvents []ThrottleEvent
+
+// feedClient makes the feed requests; --chaos swaps it for one that injects
+// faults.
+var feedClient = http.DefaultClient
+
+// httpGet fetches url, waiting out HTTP 429 and 503 responses according to
+// their Retry-After header within a bounded budget. header is added to each
+// request; when it makes the request conditional, 304 Not Modified is
+// returned like 200, and when it asks for a Range, so are 206 Partial Content
+// and 416 Range Not Satisfiable. Connection failures and 500, 502 and 504
+// responses are retried with backoff (see feedRetries); any other status is
+// an error. The feed's configured headers (see feedHeaders) are sent first,
+// and each request waits its turn at the host (see awaitHostTurn), over the
+// feed's own TLS settings if it has any (see feedTLS). A local file (see
+// localFeedPath) is read as if it were served over HTTP. Errors are
+// feedErrors of the request stage.
+func httpGet(url string, header http.Header) (resp *http.Response, err error) {
+	defer func() {
+		if err != nil {
+			err = feedFailure(url, stageRequest, -1, err)
+		}
+	}()
+	conditional := header.Get("If-None-Match") != "" || header.Get("If-Modified-Since") != ""
+	ranged := header.Get("Range") != ""
+	client, target := feedClientFor(url), url
+	if path, local := localFeedPath(url); local {
+		if target, err = localFeedRequest(path); err != nil {
+			return nil, err
+		}
+		client = localFeedClient
+	}
+	failures := 0
+	retry := func(reason error) error {
+		if failures >= retries.Attempts || !retryable(reason) {
+			return reason
+		}
+		wait := retryDelay(failures)
+		failures++
+		logMessage(fmt.Sprintf("   🔁 %s: %v, retrying in %s (%d of %d)", url, reason, wait.Round(time.Millisecond), failures, retries.Attempts))
+		return sleepFeed(wait)
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(feedContext, http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range feedHeaders[url] {
+			req.Header[key] = values
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if err := awaitHostTurn(url); err != nil {
+			return nil, err
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			if err := retry(requestTimeout(url, err)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode == http.StatusOK || (conditional && resp.StatusCode == http.StatusNotModified) {
+			return resp, nil
+		}
+		if ranged && (resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable) {
+			return resp, nil
+		}
+		resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+			if err := retry(&statusError{Status: resp.Status, Code: resp.StatusCode}); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			return nil, &statusError{Status: resp.Status, Code: resp.StatusCode}
+		}
+
+		header := resp.Header.Get("Retry-After")
+		wait, ok := parseRetryAfter(header, time.Now())
+		if !ok {
+			wait = defaultRetryAfterWait
+		}
+
+		event := ThrottleEvent{
+			Timestamp:  time.Now().Format("15:04:05"),
+			URL:        url,
+			Status:     resp.StatusCode,
+			RetryAfter: header,
+		}
+		if attempt >= maxThrottleRetries || wait > maxRetryAfterWait {
+			event.GaveUp = true
+			runMu.Lock()
+			throttleEvents = append(throttleEvents, event)
+			runMu.Unlock()
+			return nil, fmt.Errorf("rate limited (%s, Retry-After %q) after %d attempts", resp.Status, header, attempt+1)
+		}
+
+		event.Waited = wait
+		runMu.Lock()
+		throttleEvents = append(throttleEvents, event)
+		runMu.Unlock()
+		warn(warnThrottled, url, fmt.Sprintf("   ⏳ %s from %s, waiting %s before retrying", resp.Status, url, wait))
+		if err := sleepFeed(wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseRetryAfter accepts either delay-seconds or an HTTP-date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		wait := t.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// readFeedBody reads the body of a 200 response for url into memory, by way
+// of a partial temp file in feedTempDir (see finishFeedBody), and verifies
+// it (see verifyFeed). The temp file is removed once the body is read or the
+// download given up; feedDiskCache.readBody keeps it for the next run
+// instead.
+func readFeedBody(url string, resp *http.Response) ([]byte, error) {
+	if feedTempDir != "" {
+		if err := os.MkdirAll(feedTempDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	partial, err := os.CreateTemp(feedTempDir, "epg-feed-*.partial")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(partial.Name())
+	defer partial.Close()
+	body, _, err := finishFeedBody(url, resp, partial, 0, rangeValidator(resp.Header))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyFeed(url, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// rangeValidator returns what If-Range can name the feed by: its ETag unless
+// weak, or else its Last-Modified. Empty means a download cannot be resumed
+// safely across requests.
+func rangeValidator(header http.Header) string {
+	validator := header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = header.Get("Last-Modified")
+	}
+	return validator
+}
+
+// finishFeedBody copies resp into partial, which already holds the first
+// written bytes of url, and returns the whole feed. When the connection drops
+// part-way, the download is resumed from the end of the partial file with a
+// Range request instead of starting again; If-Range makes the server send the
+// whole feed instead if it changed meanwhile, validator then becoming the new
+// copy's. The whole body, resumes included, must arrive within the download
+// timeout. A download given up on is a feedError at the byte it reached.
+func finishFeedBody(url string, resp *http.Response, partial *os.File, written int64, validator string) ([]byte, string, error) {
+	if _, err := partial.Seek(written, io.SeekStart); err != nil {
+		resp.Body.Close()
+		return nil, validator, err
+	}
+	var deadline time.Time
+	if timeouts.Download > 0 {
+		deadline = time.Now().Add(timeouts.Download)
+	}
+	timedOut := func() error {
+		err := &stageTimeoutError{Stage: "download", URL: url, Limit: timeouts.Download}
+		logMessage(fmt.Sprintf("   ⏱️  %s: %v, %d bytes in", url, err, written))
+		return feedFailure(url, stageDownload, written, err)
+	}
+
+	stop := watchBody(resp, deadline)
+	n, err := io.Copy(partial, throttle(url, resp.Body))
+	resp.Body.Close()
+	written += n
+	if stop() {
+		return nil, validator, timedOut()
+	}
+	for attempt := 1; err != nil; attempt++ {
+		if attempt > maxResumeAttempts {
+			// The resume request's error names the feed already
+			var failure *feedError
+			if errors.As(err, &failure) {
+				err = failure.Err
+			}
+			return nil, validator, feedFailure(url, stageDownload, written, fmt.Errorf("interrupted %d times: %w", attempt, err))
+		}
+		logMessage(fmt.Sprintf("   🔁 Download interrupted at %d bytes (%v), resuming (attempt %d of %d)", written, err, attempt, maxResumeAttempts))
+		if err := sleepFeed(time.Duration(attempt) * time.Second); err != nil {
+			return nil, validator, err
+		}
+
+		header := make(http.Header)
+		header.Set("Range", fmt.Sprintf("bytes=%d-", written))
+		if validator != "" {
+			header.Set("If-Range", validator)
+		}
+		var next *http.Response
+		next, err = httpGet(url, header)
+		if err != nil {
+			continue
+		}
+		if next.StatusCode != http.StatusPartialContent || contentRangeStart(next.Header.Get("Content-Range")) != written {
+			// The server ignored the range, the feed changed or the range no
+			// longer fits: start over from the first byte
+			next.Body.Close()
+			if next, err = httpGet(url, nil); err != nil {
+				continue
+			}
+			if err = partial.Truncate(0); err == nil {
+				_, err = partial.Seek(0, io.SeekStart)
+			}
+			if err != nil {
+				next.Body.Close()
+				return nil, validator, err
+			}
+			written, validator = 0, rangeValidator(next.Header)
+		}
+		stop := watchBody(next, deadline)
+		n, err = io.Copy(partial, throttle(url, next.Body))
+		next.Body.Close()
+		written += n
+		if stop() {
+			return nil, validator, timedOut()
+		}
+	}
+
+	if _, err := partial.Seek(0, io.SeekStart); err != nil {
+		return nil, validator, err
+	}
+	body, err := io.ReadAll(partial)
+	return body, validator, err
+}
+
+// contentRangeStart returns the first byte of a "bytes 100-199/200"
+// Content-Range, or -1.
+func contentRangeStart(value string) int64 {
+	value, found := strings.CutPrefix(value, "bytes ")
+	if !found {
+		return -1
+	}
+	first, _, found := strings.Cut(value, "-")
+	if !found {
+		return -1
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return start
+}
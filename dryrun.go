@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DryRunReport is what a --dry-run would have written.
+type DryRunReport struct {
+	Output     string       `json:"output"`
+	Files      []DryRunFile `json:"files"`
+	Channels   int          `json:"channels"`
+	Programmes int          `json:"programmes"`
+	Unmatched  []string     `json:"unmatched"`
+}
+
+// DryRunFile is one file a --dry-run would have written. Channel files also
+// name their channel and date and count their programmes.
+type DryRunFile struct {
+	Path       string `json:"path"`
+	Bytes      int    `json:"bytes"`
+	Channel    string `json:"channel,omitempty"`
+	Date       string `json:"date,omitempty"`
+	Programmes int    `json:"programmes,omitempty"`
+}
+
+// openStateStoreReadOnly opens the store at path for a dry run: it is read
+// as usual, but nothing is written back. A missing database reads as empty.
+func openStateStoreReadOnly(path string) (*StateStore, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	version := 0
+	db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(bucketMeta); meta != nil {
+			version, _ = strconv.Atoi(string(meta.Get(keySchemaVersion)))
+		}
+		return nil
+	})
+	if version != len(stateMigrations) {
+		db.Close()
+		return nil, fmt.Errorf("state schema version %d differs from this binary's (%d); run once without --dry-run to migrate it", version, len(stateMigrations))
+	}
+	return &StateStore{db: db, readOnly: true}, nil
+}
+
+// dryRunReport lists the files out holds after a dry run, with the channel,
+// date and programme count of the channel files among them.
+func dryRunReport(output string, out *MemFS, published []publishedFile, unmatched []string) DryRunReport {
+	channels := make(map[string]publishedFile, len(published))
+	for _, file := range published {
+		channels[file.Path] = file
+	}
+	report := DryRunReport{Output: output, Files: make([]DryRunFile, 0), Unmatched: unmatched}
+	seen := make(map[string]bool)
+	for _, name := range out.Files() {
+		data, _ := out.ReadFile(name)
+		file := DryRunFile{Path: name, Bytes: len(data)}
+		if channel, exists := channels[name]; exists {
+			file.Channel, file.Date, file.Programmes = channel.Channel, channel.Date, channel.Programmes
+			report.Programmes += channel.Programmes
+			if !seen[channel.Channel] {
+				seen[channel.Channel] = true
+				report.Channels++
+			}
+		}
+		report.Files = append(report.Files, file)
+	}
+	return report
+}
+
+// logDryRun prints the dry-run report and, when jsonFile is set, writes it
+// there as JSON, the one file a dry run writes.
+func logDryRun(report DryRunReport, jsonFile string) error {
+	logMessage(fmt.Sprintf("\n🧪 Dry run: %d files would be written to %s, %d channels with %d programmes", len(report.Files), report.Output, report.Channels, report.Programmes))
+	for _, file := range report.Files {
+		line := fmt.Sprintf("   %-50s %8s", file.Path, formatByteSize(file.Bytes))
+		if file.Programmes > 0 {
+			line += fmt.Sprintf("  %4d programmes", file.Programmes)
+		}
+		logMessage(line)
+	}
+	if len(report.Unmatched) > 0 {
+		logMessage(fmt.Sprintf("   ❌ No file for %d unmatched rules", len(report.Unmatched)))
+	}
+	if jsonFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(jsonFile, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	logMessage(fmt.Sprintf("💾 Dry-run report written to %s", jsonFile))
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DuplicateChannel is a filter rule whose channel more than one provider
+// carries, with what each provider lists for the generated days.
+type DuplicateChannel struct {
+	Rule      string              `json:"rule"`
+	Strategy  string              `json:"strategy"`
+	Pinned    string              `json:"pinned,omitempty"`
+	Published string              `json:"published"`
+	Providers []DuplicateProvider `json:"providers"`
+}
+
+// DuplicateProvider is one provider's copy of a duplicated channel. Coverage
+// is the share of the generated days its programmes cover.
+type DuplicateProvider struct {
+	Source     string  `json:"source"`
+	ChannelID  string  `json:"channel_id"`
+	Name       string  `json:"channel_name"`
+	Programmes int     `json:"programmes"`
+	Coverage   float64 `json:"coverage"`
+}
+
+// runDuplicates implements `epg duplicates`: it lists the filter rules found
+// in more than one provider, with each provider's programme count and
+// coverage, so a rule can be pinned to a source or given an overlap strategy
+// deliberately instead of falling to provider priority.
+func runDuplicates(args []string) error {
+	fs := flag.NewFlagSet("duplicates", flag.ContinueOnError)
+	jsonFile := fs.String("json", "", "also write the report as JSON to this file")
+	setup, err := prepareMatch(fs, args)
+	if err != nil {
+		return err
+	}
+	defer setup.store.Close()
+
+	report := make([]DuplicateChannel, 0)
+	for _, rule := range setup.rules {
+		if duplicate, found := findDuplicate(setup, rule); found {
+			report = append(report, duplicate)
+		}
+	}
+
+	fmt.Printf("\n🔁 %d of %d rules are carried by more than one provider\n", len(report), len(setup.rules))
+	for _, duplicate := range report {
+		sources := make([]string, 0, len(duplicate.Providers))
+		for _, p := range duplicate.Providers {
+			sources = append(sources, p.Source)
+		}
+		how := duplicate.Strategy + " publishes " + duplicate.Published
+		if duplicate.Pinned != "" {
+			how = "pinned to " + duplicate.Pinned
+		}
+		fmt.Printf("\n📺 %s: in %s (%s)\n", duplicate.Rule, strings.Join(sources, ", "), how)
+		for _, p := range duplicate.Providers {
+			fmt.Printf("   %-10s %-30s %5d programmes  %5.1f%% coverage\n", p.Source, truncate(p.Name+" ("+p.ChannelID+")", 30), p.Programmes, p.Coverage*100)
+		}
+	}
+
+	if *jsonFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*jsonFile, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("\n💾 Report written to %s\n", *jsonFile)
+	}
+	return nil
+}
+
+// findDuplicate looks rule up in every source on its own and reports it when
+// more than one has the channel, with the source a run would publish.
+func findDuplicate(setup *matchSetup, rule FilterRule) (DuplicateChannel, bool) {
+	loc, today := setup.ruleDays(rule)
+	start, end := today, today.AddDate(0, 0, setup.opts.Days)
+	window := end.Sub(start)
+
+	duplicate := DuplicateChannel{
+		Rule:     rule.OriginalName,
+		Strategy: overlapStrategyFor(rule, setup.overlap, setup.overlapRules),
+		Pinned:   rule.Source,
+	}
+	best := -1.0
+	for _, src := range setup.sources {
+		match := setup.matcher.Match(rule, []*EPGSource{src})
+		if match == nil {
+			continue
+		}
+		coverage := 0.0
+		if window > 0 {
+			coverage = float64(airtime(match.Programmes, start, end, loc)) / float64(window)
+		}
+		duplicate.Providers = append(duplicate.Providers, DuplicateProvider{
+			Source:     src.Name,
+			ChannelID:  match.Channel.ID,
+			Name:       match.Channel.DisplayName,
+			Programmes: programmesInWindow(match.Programmes, start, end, loc),
+			Coverage:   coverage,
+		})
+		if duplicate.Strategy == overlapPreferCoverage && coverage > best {
+			best = coverage
+			duplicate.Published = src.Name
+		}
+	}
+	if len(duplicate.Providers) < 2 {
+		return duplicate, false
+	}
+
+	switch {
+	case duplicate.Pinned != "":
+		duplicate.Published = duplicate.Pinned
+	case duplicate.Strategy == overlapPreferCoverage:
+	default:
+		// prefer-priority publishes the first match; merge combines them all
+		if primary := setup.matcher.Match(rule, setup.sources); primary != nil {
+			duplicate.Published = primary.Source
+		}
+		if duplicate.Strategy == overlapMerge {
+			duplicate.Published = "all, each day from the fullest"
+		}
+	}
+	return duplicate, true
+}
+
+// programmesInWindow counts the programmes airing at some point in
+// [start, end).
+func programmesInWindow(programmes []Programme, start, end time.Time, loc *time.Location) int {
+	count := 0
+	for _, prog := range programmes {
+		progStart, errStart := parseEPGTime(prog.Start, loc)
+		progEnd, errEnd := parseEPGTime(prog.Stop, loc)
+		if errStart == nil && errEnd == nil && progStart.Before(end) && progEnd.After(start) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// enrichSlotTolerance is how far an API programme's start may be from the
+// feed programme's start and still be taken as the same slot.
+const enrichSlotTolerance = 2 * time.Minute
+
+// EnrichedProgramme is one slot from a provider's own API.
+type EnrichedProgramme struct {
+	Start       time.Time
+	Description string
+	Image       string
+}
+
+// Enricher fetches a provider's schedule from its own JSON API, which often
+// has longer descriptions and better artwork than its XMLTV dump.
+type Enricher interface {
+	// Schedule returns the programmes of one provider channel, offset days
+	// from today.
+	Schedule(channelID string, offset int) ([]EnrichedProgramme, error)
+}
+
+// enricherAdapters are the providers with a usable API, keyed by provider
+// name. Each takes an optional URL template overriding the default. Tata
+// Play's API requires a logged-in session, so it has no adapter.
+var enricherAdapters = map[string]func(template string) Enricher{
+	"Jio": func(template string) Enricher {
+		if template == "" {
+			template = jioAPIURL
+		}
+		return jioAPI{URLTemplate: template}
+	},
+}
+
+// parseEnrichers parses --enrich: comma-separated provider names, each
+// optionally followed by `=URL template`.
+func parseEnrichers(list string) (map[string]Enricher, error) {
+	enrichers := make(map[string]Enricher)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, template, _ := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		found := false
+		for provider, adapter := range enricherAdapters {
+			if strings.EqualFold(provider, name) {
+				enrichers[provider] = adapter(strings.TrimSpace(template))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no API adapter for provider %q", name)
+		}
+	}
+	return enrichers, nil
+}
+
+// enrichProgrammes fetches today's and tomorrow's API schedule for every
+// provider channel behind a match that has an enricher, and fills in the
+// description and image of each programme whose start lines up with an API
+// slot. The API description is used when it is longer than the feed's. It
+// returns the programmes (a copy when anything changed) and how many were
+// enriched.
+func enrichProgrammes(programmes []Programme, providers []ProviderRef, enrichers map[string]Enricher, loc *time.Location) ([]Programme, int) {
+	if len(enrichers) == 0 {
+		return programmes, 0
+	}
+
+	var result []Programme
+	enriched := 0
+	for _, ref := range providers {
+		enricher, exists := enrichers[ref.Source]
+		if !exists {
+			continue
+		}
+		slots := make([]EnrichedProgramme, 0)
+		for offset := 0; offset <= 1; offset++ {
+			schedule, err := enricher.Schedule(ref.ID, offset)
+			if err != nil {
+				logMessage(fmt.Sprintf("   ⚠️  %s API for channel %s: %v", ref.Source, ref.ID, err))
+				continue
+			}
+			slots = append(slots, schedule...)
+		}
+		if len(slots) == 0 {
+			continue
+		}
+
+		if result == nil {
+			result = append([]Programme(nil), programmes...)
+		}
+		for i := range result {
+			prog := &result[i]
+			if prog.Channel != ref.ID {
+				continue
+			}
+			start, err := parseEPGTime(prog.Start, loc)
+			if err != nil {
+				continue
+			}
+			slot, found := matchingSlot(slots, start)
+			if !found {
+				continue
+			}
+			changed := false
+			if len(strings.TrimSpace(slot.Description)) > len(strings.TrimSpace(prog.Desc)) {
+				prog.Desc = strings.TrimSpace(slot.Description)
+				changed = true
+			}
+			if slot.Image != "" && slot.Image != prog.logo() {
+				prog.Icons = append(prog.Icons[:len(prog.Icons):len(prog.Icons)], Icon{Src: slot.Image})
+				changed = true
+			}
+			if changed {
+				enriched++
+			}
+		}
+	}
+	if result == nil {
+		return programmes, 0
+	}
+	return result, enriched
+}
+
+func matchingSlot(slots []EnrichedProgramme, start time.Time) (EnrichedProgramme, bool) {
+	for _, slot := range slots {
+		diff := slot.Start.Sub(start)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= enrichSlotTolerance {
+			return slot, true
+		}
+	}
+	return EnrichedProgramme{}, false
+}
+
+// JioTV's public schedule API and the CDN its posters are served from.
+const (
+	jioAPIURL       = "https://jiotv.data.cdn.jio.com/apis/v1.3/getepg/get?channel_id={channel}&offset={offset}"
+	jioPosterPrefix = "https://jiotv.catchup.cdn.jio.com/dare_images/shows/"
+)
+
+// jioAPI reads JioTV's getepg API. {channel} and {offset} in URLTemplate are
+// replaced by the Jio channel ID and the day offset.
+type jioAPI struct {
+	URLTemplate string
+}
+
+func (j jioAPI) Schedule(channelID string, offset int) ([]EnrichedProgramme, error) {
+	url := strings.NewReplacer("{channel}", channelID, "{offset}", strconv.Itoa(offset)).Replace(j.URLTemplate)
+	resp, err := httpGet(url, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		EPG []struct {
+			Description   string `json:"description"`
+			EpisodePoster string `json:"episodePoster"`
+			StartEpoch    int64  `json:"startEpoch"`
+		} `json:"epg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", url, err)
+	}
+
+	schedule := make([]EnrichedProgramme, 0, len(body.EPG))
+	for _, item := range body.EPG {
+		if item.StartEpoch <= 0 {
+			continue
+		}
+		image := item.EpisodePoster
+		if image != "" && !strings.Contains(image, "://") {
+			image = jioPosterPrefix + strings.TrimPrefix(image, "/")
+		}
+		schedule = append(schedule, EnrichedProgramme{
+			Start:       time.UnixMilli(item.StartEpoch),
+			Description: item.Description,
+			Image:       image,
+		})
+	}
+	return schedule, nil
+}
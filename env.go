@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// envPrefix starts every environment variable the generate flags read.
+const envPrefix = "EPG_"
+
+// sourceEnvPrefix starts the variables that set one feed's URL, as a
+// `name = URL` line in sources.txt would: EPG_SOURCE_JIO=https://...
+const sourceEnvPrefix = envPrefix + "SOURCE_"
+
+// envAliases are shorter names accepted for some flags. The flag's own
+// variable wins when both are set.
+var envAliases = map[string]string{
+	"timezone": "EPG_TZ",
+	"output":   "EPG_OUTPUT_DIR",
+}
+
+// flagEnvName is the variable for a flag: --output-today reads
+// EPG_OUTPUT_TODAY.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnvDefaults makes environment variables the defaults of fs's flags, so
+// a container can be configured without mounting files or changing its
+// command. Flags given on the command line still win over the environment.
+// Variables that are set but empty are ignored.
+func applyEnvDefaults(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := flagEnvName(f.Name)
+		value := os.Getenv(name)
+		if value == "" && envAliases[f.Name] != "" {
+			name = envAliases[f.Name]
+			value = os.Getenv(name)
+		}
+		if value == "" || err != nil {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("$%s: invalid value %q for --%s: %v", name, value, f.Name, setErr)
+			return
+		}
+		f.DefValue = value
+	})
+	return err
+}
+
+// applySourceEnv sets feed URLs from EPG_SOURCE_<NAME> variables after the
+// sources file is read. A built-in or listed provider (case-insensitive) gets
+// the new URL, an empty value disables it, and any other name adds an
+// optional provider at the end.
+func applySourceEnv(providers []Provider) []Provider {
+	names := make([]string, 0)
+	urls := make(map[string]string)
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, sourceEnvPrefix) || key == sourceEnvPrefix {
+			continue
+		}
+		name := strings.TrimPrefix(key, sourceEnvPrefix)
+		names = append(names, name)
+		urls[name] = strings.TrimSpace(value)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		found := false
+		for i := range providers {
+			if strings.EqualFold(providers[i].Name, name) {
+				providers[i].URL = urls[name]
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		provider := Provider{Name: name, Label: name}
+		for _, builtin := range builtinProviders {
+			if strings.EqualFold(builtin.Name, name) {
+				provider = builtin
+				break
+			}
+		}
+		provider.URL = urls[name]
+		providers = append(providers, provider)
+	}
+	return providers
+}
@@ -1,24 +1,36 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
-	"encoding/json"
+	"context"
 	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 // XML structures
 type TV struct {
-	XMLName    xml.Name    `xml:"tv"`
-	Channels   []Channel   `xml:"channel"`
-	Programmes []Programme `xml:"programme"`
+	XMLName xml.Name `xml:"tv"`
+	// Date and the source-info attributes say when and from where the feed
+	// was generated; see freshness.go.
+	Date              string      `xml:"date,attr,omitempty"`
+	SourceInfoName    string      `xml:"source-info-name,attr,omitempty"`
+	SourceInfoURL     string      `xml:"source-info-url,attr,omitempty"`
+	GeneratorInfoName string      `xml:"generator-info-name,attr,omitempty"`
+	Channels          []Channel   `xml:"channel"`
+	Programmes        []Programme `xml:"programme"`
 }
 
 type Channel struct {
@@ -28,24 +40,112 @@ type Channel struct {
 }
 
 type Programme struct {
-	Start   string `xml:"start,attr"`
-	Stop    string `xml:"stop,attr"`
-	Channel string `xml:"channel,attr"`
-	Title   string `xml:"title"`
-	Desc    string `xml:"desc"`
-	Icon    Icon   `xml:"icon"`
+	Start      string       `xml:"start,attr"`
+	Stop       string       `xml:"stop,attr"`
+	Channel    string       `xml:"channel,attr"`
+	Title      string       `xml:"title"`
+	Desc       string       `xml:"desc"`
+	Icons      []Icon       `xml:"icon"`
+	Categories []string     `xml:"category"`
+	EpisodeNum []EpisodeNum `xml:"episode-num"`
+	New        *struct{}    `xml:"new"`
+	Credits    *XMLCredits  `xml:"credits"`
+	URLs       []string     `xml:"url"`
+}
+
+type XMLCredits struct {
+	Directors  []string `xml:"director"`
+	Actors     []string `xml:"actor"`
+	Presenters []string `xml:"presenter"`
+}
+
+type EpisodeNum struct {
+	System string `xml:"system,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// episode returns the programme's episode number, preferring xmltv_ns.
+func (p Programme) episode() string {
+	for _, ep := range p.EpisodeNum {
+		if ep.System == "xmltv_ns" && strings.TrimSpace(ep.Value) != "" {
+			return strings.TrimSpace(ep.Value)
+		}
+	}
+	for _, ep := range p.EpisodeNum {
+		if strings.TrimSpace(ep.Value) != "" {
+			return strings.TrimSpace(ep.Value)
+		}
+	}
+	return ""
+}
+
+// episodeNumbering are the episode-num systems that number episodes rather
+// than identify programmes in another catalogue.
+var episodeNumbering = map[string]bool{"xmltv_ns": true, "onscreen": true}
+
+// externalIDs returns the programme's identifiers in other catalogues, such
+// as dd_progid or crid, keyed by their episode-num system. The first value
+// of a system wins.
+func (p Programme) externalIDs() map[string]string {
+	var ids map[string]string
+	for _, ep := range p.EpisodeNum {
+		system, value := strings.TrimSpace(ep.System), strings.TrimSpace(ep.Value)
+		if system == "" || value == "" || episodeNumbering[system] {
+			continue
+		}
+		if ids == nil {
+			ids = make(map[string]string)
+		}
+		if _, exists := ids[system]; !exists {
+			ids[system] = value
+		}
+	}
+	return ids
+}
+
+// url returns the programme's first web page.
+func (p Programme) url() string {
+	for _, u := range p.URLs {
+		if u = strings.TrimSpace(u); u != "" {
+			return u
+		}
+	}
+	return ""
 }
 
 type Icon struct {
-	Src string `xml:"src,attr"`
+	Src    string `xml:"src,attr"`
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
 }
 
 // JSON structures
 type ChannelJSON struct {
-	ChannelName string        `json:"channel_name"`
-	ChannelLogo string        `json:"channel_logo"`
-	Date        string        `json:"date"`
+	ChannelID   string `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	ChannelLogo string `json:"channel_logo"`
+	Date        string `json:"date"`
+	// NoData marks a placeholder for a day the feeds list nothing for.
+	NoData bool `json:"no_data,omitempty"`
+	// StaleSince is set when a feed could not be downloaded and the
+	// schedule was built from a cached copy: when that copy was downloaded.
+	StaleSince string `json:"stale_since,omitempty"`
+	// Deprecated marks the last copy of a channel no longer in the filter,
+	// kept from DeprecatedSince for --removed-grace; see softdelete.go.
+	Deprecated      bool   `json:"deprecated,omitempty"`
+	DeprecatedSince string `json:"deprecated_since,omitempty"`
+	// Timezone is set when the channel's times are not in --timezone.
+	Timezone    string        `json:"timezone,omitempty"`
+	ProviderIDs []ProviderRef `json:"provider_ids"`
 	Programs    []ProgramJSON `json:"programs"`
+	// Descriptions holds the programme descriptions by key, written with
+	// --dedupe-descriptions.
+	Descriptions map[string]string `json:"descriptions,omitempty"`
+	// Page, Pages and NextPage are set when --max-programmes splits the day
+	// across files: star-plus.json, then star-plus.2.json, and so on.
+	Page     int    `json:"page,omitempty"`
+	Pages    int    `json:"pages,omitempty"`
+	NextPage string `json:"next_page,omitempty"`
 }
 
 type ProgramJSON struct {
@@ -53,131 +153,1090 @@ type ProgramJSON struct {
 	StartTime string `json:"start_time"`
 	EndTime   string `json:"end_time"`
 	ShowLogo  string `json:"show_logo"`
+	IsNew     bool   `json:"is_new"`
+
+	Description string `json:"description,omitempty"`
+	// DescriptionRef replaces Description with its key in the schedule's
+	// descriptions table, with --dedupe-descriptions.
+	DescriptionRef string   `json:"description_ref,omitempty"`
+	Credits        *Credits `json:"credits,omitempty"`
+	// Kind classifies the programme as movie, series, sports, news or
+	// other, emitted with --kind together with a 0–1 confidence.
+	Kind           string  `json:"kind,omitempty"`
+	KindConfidence float64 `json:"kind_confidence,omitempty"`
+	// Recurrence tells a daily or weekly programme from a one-off, judged
+	// from the archive, with --recurrence.
+	Recurrence string `json:"recurrence,omitempty"`
+	// Artwork is every image of the programme, typed poster, banner or
+	// thumbnail, emitted with --artwork.
+	Artwork []Artwork `json:"artwork,omitempty"`
+	// CatchupAvailable tells whether a programme that has ended can still
+	// be replayed, on channels with a catch-up window in catchup.txt.
+	CatchupAvailable *bool `json:"catchup_available,omitempty"`
+	// URL and ExternalIDs link the programme to its web page and to other
+	// catalogues (dd_progid, crid, ...), emitted with --external-ids.
+	URL         string            `json:"url,omitempty"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+
+	Debug *ProgramDebug `json:"debug,omitempty"`
+}
+
+// ProgramDebug carries the raw feed values behind a programme, emitted with
+// --debug-output so timezone and offset problems can be traced from the JSON.
+type ProgramDebug struct {
+	RawStart        string `json:"raw_start"`
+	RawStop         string `json:"raw_stop"`
+	Start           string `json:"start"`
+	Stop            string `json:"stop"`
+	Source          string `json:"source"`
+	SourceChannelID string `json:"source_channel_id"`
+}
+
+// Credits lists the leading names of a programme's cast and crew, in feed
+// order, emitted with --credits.
+type Credits struct {
+	Directors  []string `json:"directors,omitempty"`
+	Actors     []string `json:"actors,omitempty"`
+	Presenters []string `json:"presenters,omitempty"`
+}
+
+// credits returns up to limit names per role, or nil when there are none.
+func (p Programme) credits(limit int) *Credits {
+	if p.Credits == nil || limit <= 0 {
+		return nil
+	}
+	top := func(names []string) []string {
+		result := make([]string, 0, limit)
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" && len(result) < limit {
+				result = append(result, name)
+			}
+		}
+		if len(result) == 0 {
+			return nil
+		}
+		return result
+	}
+	credits := &Credits{
+		Directors:  top(p.Credits.Directors),
+		Actors:     top(p.Credits.Actors),
+		Presenters: top(p.Credits.Presenters),
+	}
+	if credits.Directors == nil && credits.Actors == nil && credits.Presenters == nil {
+		return nil
+	}
+	return credits
 }
 
 type FilterRule struct {
 	OriginalName string
 	OutputName   string
+	// Source pins the rule to one provider: `source:` in filter.yaml, or
+	// `@provider` after the name in filter.txt.
+	Source string
+	// ChannelID is the feed channel ID a playlist entry's tvg-id names; it
+	// is tried before the match strategies.
+	ChannelID string
+	// The options below can only be set in filter.yaml.
+	// Groups adds the channel to these serve groups.
+	Groups []string
+	// Logo replaces the provider icon and any logo catalog entry.
+	Logo string
+	// Timezone replaces --timezone for this channel's days and times.
+	Timezone string
+	// Order sorts the rules; 0 keeps the rule's place after ordered ones.
+	Order int
+	// Critical rules fail the run when they produce no schedule.
+	Critical bool
+	// MaxProgrammes replaces --max-programmes for this channel.
+	MaxProgrammes int
 }
 
 type LogEntry struct {
-	Timestamp       string
-	Channel         string
-	TodayPrograms   int
+	Timestamp        string
+	Channel          string
+	TodayPrograms    int
 	TomorrowPrograms int
-	Status          string
+	Status           string
+	// Source and Strategy record which source won and how it was chosen.
+	Source   string
+	Strategy string
 }
 
 var logEntries []LogEntry
+
+// scheduleChanges holds this run's schedule stability against the previous
+// run, for the detailed log.
+var scheduleChanges []ScheduleChange
 var logBuffer strings.Builder
 
 func logMessage(msg string) {
+	runMu.Lock()
+	defer runMu.Unlock()
 	fmt.Println(msg)
 	logBuffer.WriteString(msg + "\n")
 }
 
+// resetLog empties the log of the run before. Like logMessage it holds
+// runMu, as a daemon's signal handler and admin endpoints log meanwhile.
+func resetLog() {
+	runMu.Lock()
+	defer runMu.Unlock()
+	logBuffer.Reset()
+}
+
+// loggedText returns what the run has logged so far.
+func loggedText() string {
+	runMu.Lock()
+	defer runMu.Unlock()
+	return logBuffer.String()
+}
+
+// commands are the subcommands; without one, the binary runs a generation.
+var commands = map[string]func(args []string) error{
+	"search":         runSearch,
+	"serve":          runServe,
+	"doctor":         runDoctor,
+	"gc":             runGC,
+	"cache":          runCache,
+	"profiles":       runProfiles,
+	"convert-filter": runConvertFilter,
+	"fetch":          runFetch,
+	"match":          runMatch,
+	"generate":       runGenerateCommand,
+	"validate":       runValidate,
+	"duplicates":     runDuplicates,
+	"compare":        runCompare,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, exists := commands[os.Args[1]]; exists {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		}
+		if wantsProfiles(os.Args[1:]) {
+			if err := runProfiles(os.Args[1:]); err != nil {
+				fmt.Printf("❌ %v\n", err)
+				os.Exit(exitCode(err))
+			}
+			return
+		}
+	}
+
+	opts := registerGenerateFlags(flag.CommandLine)
+	flag.Parse()
+	// Failed runs exit 0, as they always have, unless a critical channel is
+	// missing or --strict asks for exit codes.
+	if err := runGenerate(opts); errors.Is(err, errCriticalChannels) || (opts.Strict && err != nil) {
+		os.Exit(exitCode(err))
+	}
+}
+
+// GenerateOptions holds the settings of one generation run.
+type GenerateOptions struct {
+	FilterFile      string
+	Timezone        string
+	MatchStrategies string
+	Overlap         string
+	OverlapFile     string
+	AliasFile       string
+	SourcesFile     string
+	ChannelIDFile   string
+	LogoFile        string
+	LineupDir       string
+	ChannelNames    string
+	OverlapPolicy   string
+	Enrich          string
+	StateFile       string
+	Only            string
+	Skip            string
+	DebugOutput     bool
+	PrewarmImages   bool
+	PrewarmWorkers  int
+	BaseURL         string
+	SlackWebhook    string
+	Pushgateway     string
+	Output          string
+	Descriptions    bool
+	Kinds           bool
+	Artwork         bool
+	Patches         bool
+	Placeholders    bool
+	Stdin           bool
+	CreditLimit     int
+	MaxFileSize     string
+	maxFileBytes    int
+	XLSX            string
+	XLSXSlot        string
+	// MaxProgrammes splits a day with more programmes into pages; see
+	// pagination.go.
+	MaxProgrammes int
+	// Canonical writes byte-identical outputs for identical inputs; see
+	// reproducible.go.
+	Canonical bool
+	// OutputToday and OutputTomorrow are the folders of the first two days;
+	// later days of --days go to output-day-N.
+	OutputToday    string
+	OutputTomorrow string
+	Days           int
+	// ProviderOrder and DisabledProviders override the sources file's
+	// providers and their priority for one run.
+	ProviderOrder     string
+	DisabledProviders string
+	// ArchiveDays is how long past days stay in the archive; 0 keeps none.
+	ArchiveDays int
+	// DedupeDescriptions writes each channel file's descriptions once, in a
+	// table the programmes refer to by key.
+	DedupeDescriptions bool
+	// AllChannels makes a rule for every channel in the sources instead of
+	// reading the filter file.
+	AllChannels bool
+	// ExternalIDs adds each programme's URL and episode-num identifiers.
+	ExternalIDs bool
+	// FeedsDir reads the feeds saved by `epg fetch` instead of downloading.
+	FeedsDir string
+	// LogFile replaces epg-parser.log; the detailed log is written next to
+	// it.
+	LogFile string
+	// TimezoneFallback is a fixed UTC offset such as +05:30 used when the
+	// system has no zone database for Timezone.
+	TimezoneFallback string
+	// Force regenerates even when nothing changed since the last run.
+	Force bool
+	// DryRun downloads, matches and filters as usual but writes nothing,
+	// listing the files it would have written; DryRunJSON also saves that
+	// list as JSON.
+	DryRun     bool
+	DryRunJSON string
+	// Date generates as if today were that day (YYYY-MM-DD). FromArchive
+	// reads its feeds from FeedArchive, where each run saves the feeds it
+	// used; see feedarchive.go.
+	Date        string
+	FromArchive bool
+	FeedArchive string
+	// Chaos injects faults into feed downloads; see chaos.go.
+	Chaos string
+	// Strict fails the run when a rule is unmatched, and MinOutput when
+	// fewer than that percentage of rules produce output; see strict.go.
+	Strict    bool
+	MinOutput float64
+	// DeadSourceRuns is how many failed runs in a row mark a source as
+	// likely dead; see health.go.
+	DeadSourceRuns int
+	// ConnectTimeout, HeaderTimeout, DownloadTimeout and DecodeTimeout
+	// limit each stage of getting a feed; see watchdog.go.
+	ConnectTimeout  time.Duration
+	HeaderTimeout   time.Duration
+	DownloadTimeout time.Duration
+	DecodeTimeout   time.Duration
+	// MaxFeedAge flags feeds whose XMLTV date is older; RejectStale fails
+	// them instead. See freshness.go.
+	MaxFeedAge  time.Duration
+	RejectStale bool
+	// MinFeedSize is the size below which a download is corrupt; see
+	// integrity.go.
+	MinFeedSize string
+	// FeedCache keeps each downloaded feed on disk for conditional requests
+	// by later runs; see feeddisk.go. A feed that fails to download is read
+	// from its copy there, and Offline reads every feed from it without
+	// downloading; see offline.go.
+	FeedCache string
+	Offline   bool
+	// CacheDir gathers the feed cache, the state database and the temp
+	// files of downloads in one directory, and CacheMaxSize caps the feed
+	// cache in it; see cachedir.go.
+	CacheDir     string
+	CacheMaxSize string
+	// Proxy routes feed requests through an HTTP or SOCKS5 proxy; see
+	// proxy.go.
+	Proxy string
+	// CACert is trusted besides the system's CAs, and InsecureSkipVerify
+	// names the providers whose certificates are not checked; see
+	// feedtls.go.
+	CACert             string
+	InsecureSkipVerify string
+	// Retries and RetryBackoff retry failed feed requests; Context, when
+	// set by embedding code, cancels the run's feed requests.
+	Retries      int
+	RetryBackoff time.Duration
+	Context      context.Context `json:"-"`
+	// Downloads is how many feeds are downloaded and parsed at once; see
+	// parallel.go.
+	Downloads int
+	// HostInterval and MaxDownloadRate keep requests to each host polite;
+	// see polite.go.
+	HostInterval    time.Duration
+	MaxDownloadRate string
+	// CatchupFile gives channels a catch-up window, for the
+	// catchup_available flag of their past programmes; see catchup.go.
+	CatchupFile string
+	// DuplicateTolerance is how far apart merge may find a programme's
+	// copies from two sources and still collapse them; see overlap.go.
+	DuplicateTolerance time.Duration
+	// Recurrence tags programmes daily, weekly or one-off from the
+	// archive; see recurrence.go.
+	Recurrence bool
+	// RemovedGrace is how long the files of a channel removed from the
+	// filter stay published, marked deprecated; see softdelete.go.
+	RemovedGrace time.Duration
+	// Hooks are callbacks for code embedding the generator.
+	Hooks Hooks `json:"-"`
+	// envErr is an EPG_* variable that is not a valid flag value, reported
+	// once the run starts.
+	envErr error
+	// config is the configuration held by a long-running process; nil
+	// reads the files at the start of the run.
+	config *runConfig
+	// feeds keeps parsed feeds between runs of a long-lived process; nil
+	// downloads every feed in full.
+	feeds *feedCache
+	// staleFeeds holds, by source, when the cached copy a run read in place
+	// of a download was downloaded.
+	staleFeeds map[string]time.Time
+	// recurrence is the archive's airings that --recurrence judges by.
+	recurrence *recurrenceHistory
+	// runLoc is the zone the run's days and times are in: --timezone, or
+	// its fixed-offset fallback.
+	runLoc *time.Location
+}
+
+// partial reports whether the run is restricted to a subset of filter rules.
+// Partial runs leave other channels' files and the run-wide indexes alone.
+func (o *GenerateOptions) partial() bool {
+	return o.Only != "" || o.Skip != ""
+}
+
+// maxDays bounds --days; XMLTV feeds rarely cover more than a week.
+const maxDays = 14
+
+// outputDay is one day a run generates: its offset from today and the
+// folder its channel files go to.
+type outputDay struct {
+	Offset int
+	Dir    string
+}
+
+// label names the day in logs: Today, Tomorrow, then Day +2 and so on.
+func (d outputDay) label() string {
+	switch d.Offset {
+	case 0:
+		return "Today"
+	case 1:
+		return "Tomorrow"
+	}
+	return fmt.Sprintf("Day +%d", d.Offset)
+}
+
+// outputDays lists the days a run generates, from today.
+func (o *GenerateOptions) outputDays() []outputDay {
+	days := make([]outputDay, 0, o.Days)
+	for i := 0; i < o.Days; i++ {
+		dir := fmt.Sprintf("output-day-%d", i)
+		switch i {
+		case 0:
+			dir = o.OutputToday
+		case 1:
+			dir = o.OutputTomorrow
+		}
+		days = append(days, outputDay{Offset: i, Dir: dir})
+	}
+	return days
+}
+
+// validateLayout checks the EPG_* environment, --days and the output folders.
+func (o *GenerateOptions) validateLayout() error {
+	if o.envErr != nil {
+		return o.envErr
+	}
+	return o.validateFolders()
+}
+
+// validateFolders checks --days and the output folders.
+func (o *GenerateOptions) validateFolders() error {
+	if o.Days < 1 || o.Days > maxDays {
+		return fmt.Errorf("--days must be between 1 and %d, got %d", maxDays, o.Days)
+	}
+	today, tomorrow := path.Clean(filepath.ToSlash(o.OutputToday)), path.Clean(filepath.ToSlash(o.OutputTomorrow))
+	for _, dir := range []string{today, tomorrow} {
+		if dir == "." || dir == ".." || path.IsAbs(dir) || strings.HasPrefix(dir, "../") {
+			return fmt.Errorf("output folder %q must be a folder inside --output", dir)
+		}
+	}
+	if today == tomorrow {
+		return fmt.Errorf("--output-today and --output-tomorrow are both %q", today)
+	}
+	return nil
+}
+
+// registerOutputFlags defines the flags saying where a run writes its day
+// folders and which timezone its days are in, so commands that read them
+// back (such as search) find them.
+func registerOutputFlags(fs *flag.FlagSet, opts *GenerateOptions) {
+	fs.StringVar(&opts.Output, "output", ".", "where to write outputs: a directory, zip://file.zip, s3://bucket/prefix or mem://")
+	fs.StringVar(&opts.OutputToday, "output-today", "output-today", "folder for today's channel files, inside --output")
+	fs.StringVar(&opts.OutputTomorrow, "output-tomorrow", "output-tomorrow", "folder for tomorrow's channel files, inside --output")
+	fs.IntVar(&opts.Days, "days", 2, "days to generate from today; days after tomorrow go to output-day-2, output-day-3, ...")
+	fs.StringVar(&opts.Timezone, "timezone", "Asia/Kolkata", "timezone for the output days and times")
+	fs.StringVar(&opts.TimezoneFallback, "timezone-fallback", defaultTimezoneFallback, "fixed UTC offset used, with a warning, when the system cannot load --timezone (empty aborts the run instead)")
+}
+
+// registerGenerateFlags defines the generation flags on fs, so commands that
+// embed a generation run (such as serve) accept the same options.
+func registerGenerateFlags(fs *flag.FlagSet) *GenerateOptions {
+	opts := &GenerateOptions{}
+	registerOutputFlags(fs, opts)
+	fs.StringVar(&opts.FilterFile, "filter", "filter.txt", "channel filter file")
+	fs.StringVar(&opts.MatchStrategies, "match", defaultMatchStrategies, "comma-separated match strategies in order: cache, chno, id, alias, name, partial, token[:threshold], prompt")
+	fs.StringVar(&opts.LineupDir, "lineups", "lineups", "directory of provider lineups (Tata.txt with number = channel lines) for chno: rules")
+	fs.StringVar(&opts.Overlap, "overlap", overlapMerge, "channels found in several sources: merge (the fullest source each day, gaps and missing details filled from the others), prefer-priority or prefer-coverage")
+	fs.StringVar(&opts.CatchupFile, "catchup", "catchup.txt", "per-channel catch-up windows (channel = 7d or 72h), marking each ended programme catchup_available true or false")
+	fs.DurationVar(&opts.DuplicateTolerance, "duplicate-tolerance", 10*time.Minute, "merge collapses a programme listed by two sources under the same title when their times overlap or come within this much of each other (0 keeps both)")
+	fs.StringVar(&opts.OverlapFile, "overlap-rules", "overlap.txt", "per-channel overlap strategy overrides (channel = strategy)")
+	fs.StringVar(&opts.ProviderOrder, "providers", "", "comma-separated providers to consult for this run, in priority order, e.g. Tata,Jio (default all enabled, in sources order)")
+	fs.StringVar(&opts.DisabledProviders, "disable-providers", "", "comma-separated providers to leave out of this run, e.g. Jio when its feed is broken")
+	fs.StringVar(&opts.SourcesFile, "sources", "sources.txt", "feed URLs by provider (name = URL), e.g. to enable Airtel, DishTV, DDFreeDish or SunDirect mirrors, or a sources.yaml/.json listing every feed")
+	fs.StringVar(&opts.AliasFile, "aliases", "aliases.txt", "alias file used by the alias match strategy")
+	fs.StringVar(&opts.ChannelIDFile, "channel-ids", "channel-ids.txt", "canonical channel ID overrides (output-name = CanonicalID)")
+	fs.StringVar(&opts.Enrich, "enrich", "", "providers whose own API enriches descriptions and artwork, e.g. Jio or Jio=URL with {channel} and {offset}")
+	fs.StringVar(&opts.ChannelNames, "channel-names", channelNamesProvider, "channel_name source: provider (display name in the feed) or filter (the name written in filter.txt)")
+	fs.StringVar(&opts.OverlapPolicy, "overlap-policy", overlapPolicyBoth, "which day lists a programme spanning midnight: both, start-day or end-day")
+	fs.StringVar(&opts.LogoFile, "logos", "logos.txt", "logo catalog (channel = logo URL) used instead of provider icons")
+	fs.StringVar(&opts.StateFile, "state", "epg-state.db", "state database for history, match cache and source health (empty to disable)")
+	fs.StringVar(&opts.Only, "only", "", "comma-separated channels to process, ignoring the rest of filter.txt")
+	fs.StringVar(&opts.Skip, "skip", "", "comma-separated channels to leave out of this run")
+	fs.BoolVar(&opts.DebugOutput, "debug-output", false, "include raw feed start/stop strings and source channel IDs in each programme")
+	fs.BoolVar(&opts.PrewarmImages, "prewarm-images", false, "request every logo and show image after generation to warm a CDN, reporting dead links")
+	fs.IntVar(&opts.PrewarmWorkers, "prewarm-concurrency", 8, "maximum concurrent image requests for --prewarm-images")
+	fs.StringVar(&opts.FeedsDir, "feeds", "", "directory of feeds saved by `epg fetch`, used instead of downloading (fetch writes to feeds/ by default)")
+	fs.IntVar(&opts.ArchiveDays, "archive-days", 7, "keep a copy of each day's channel files under archive/DATE for this many days, listed in archive-index.json (0 disables)")
+	fs.StringVar(&opts.LogFile, "log-file", "", "run log (default epg-parser.log); the detailed log is written next to it as NAME-detailed.log")
+	fs.BoolVar(&opts.Descriptions, "descriptions", false, "include programme descriptions")
+	fs.BoolVar(&opts.Kinds, "kind", false, "classify each programme as movie, series, sports, news or other, with a confidence")
+	fs.DurationVar(&opts.RemovedGrace, "removed-grace", 7*24*time.Hour, "keep publishing the last files of a channel removed from the filter for this long, marked \"deprecated\": true, so client caches can adjust (0 removes them at once)")
+	fs.BoolVar(&opts.Recurrence, "recurrence", false, "tag each programme daily, weekly or one-off by how often the archive shows it airing (needs --archive-days 7 or more)")
+	fs.IntVar(&opts.DeadSourceRuns, "dead-source-runs", 3, "alert that a source is likely dead, and its URL needs updating, once it has failed this many runs in a row (0 disables)")
+	fs.BoolVar(&opts.Strict, "strict", false, "fail the run, with a distinct exit code, when any filter rule is unmatched; also makes the bare binary exit non-zero on failure")
+	fs.Float64Var(&opts.MinOutput, "min-output", 0, "fail the run when fewer than this percentage of filter rules produce output (0 disables)")
+	fs.BoolVar(&opts.Stdin, "stdin", false, "read one gzipped or plain XMLTV feed from standard input instead of the sources file's feeds")
+	fs.BoolVar(&opts.Placeholders, "placeholders", true, "write a channel file with no programmes and \"no_data\": true for a day a matched channel has no schedule, instead of no file")
+	fs.BoolVar(&opts.Patches, "patches", false, "also write NAME.patch.json, an RFC 6902 JSON Patch from each channel file's previous copy to the new one")
+	fs.BoolVar(&opts.Artwork, "artwork", false, "include every programme image as artwork, typed poster, banner or thumbnail by aspect ratio")
+	fs.BoolVar(&opts.DedupeDescriptions, "dedupe-descriptions", false, "with --descriptions, write each channel file's descriptions once in a descriptions table keyed by hash, which programmes refer to with description_ref")
+	fs.BoolVar(&opts.AllChannels, "all-channels", false, "publish every channel in the sources, named by a slug of its display name, instead of the channels in --filter")
+	fs.BoolVar(&opts.ExternalIDs, "external-ids", false, "include each programme's <url> and its episode-num identifiers in other catalogues (dd_progid, crid, ...)")
+	fs.IntVar(&opts.CreditLimit, "credits", 0, "include up to this many directors, actors and presenters per programme (0 to omit credits)")
+	fs.StringVar(&opts.MaxFileSize, "max-file-size", "", "per-file size budget such as 200KB; optional fields are trimmed to fit")
+	fs.BoolVar(&opts.Canonical, "canonical", false, "write reproducible outputs: JSON keys sorted, stamped with the feeds' own date instead of the time of the run, no generated_at")
+	fs.IntVar(&opts.MaxProgrammes, "max-programmes", 0, "split a day with more programmes than this into linked pages: star-plus.json, star-plus.2.json, ... (0 disables)")
+	fs.StringVar(&opts.SlackWebhook, "slack-webhook", os.Getenv("SLACK_WEBHOOK_URL"), "Slack incoming webhook for a run report (default $SLACK_WEBHOOK_URL)")
+	fs.StringVar(&opts.Pushgateway, "pushgateway", os.Getenv("PUSHGATEWAY_URL"), "Prometheus Pushgateway to push run metrics to (default $PUSHGATEWAY_URL)")
+	fs.BoolVar(&opts.Force, "force", false, "regenerate even when the feeds and configuration are unchanged since the last run")
+	fs.StringVar(&opts.XLSX, "xlsx", "", "also write a workbook with a weekly grid sheet per channel, e.g. schedule.xlsx")
+	fs.StringVar(&opts.XLSXSlot, "xlsx-slot", "30m", "time slot of each --xlsx grid row")
+	fs.StringVar(&opts.BaseURL, "base-url", "", "public URL of the published files, used for absolute links in sitemap.xml")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "download, match and filter as usual, but write no files; list the files that would be written with their programme counts")
+	fs.StringVar(&opts.Date, "date", "", "generate as if today were this date (YYYY-MM-DD), e.g. with --from-archive to reproduce a past run")
+	fs.BoolVar(&opts.FromArchive, "from-archive", false, "read the --date's feeds from --feed-archive instead of downloading, leaving the state database and output archive untouched")
+	fs.StringVar(&opts.FeedArchive, "feed-archive", "", "save the feeds each run used under DIR/DATE for --archive-days days, for --from-archive (empty disables)")
+	fs.StringVar(&opts.DryRunJSON, "dry-run-json", "", "also write the --dry-run list to this JSON file (implies --dry-run)")
+	fs.StringVar(&opts.Chaos, "chaos", "", "inject faults into feed downloads for resilience testing, e.g. fail=0.3,status=0.2,slow=0.5,delay=3s,truncate=0.2,malformed=0.01,seed=7")
+	fs.DurationVar(&opts.ConnectTimeout, "connect-timeout", 30*time.Second, "time allowed to connect to a feed server, TLS included (0 for no limit)")
+	fs.DurationVar(&opts.HeaderTimeout, "header-timeout", time.Minute, "time allowed for a feed server to answer once connected (0 for no limit)")
+	fs.DurationVar(&opts.DownloadTimeout, "download-timeout", 10*time.Minute, "time allowed to download a feed's body, resumes included (0 for no limit)")
+	fs.DurationVar(&opts.DecodeTimeout, "decode-timeout", 5*time.Minute, "time allowed to parse a downloaded feed (0 for no limit)")
+	fs.DurationVar(&opts.MaxFeedAge, "max-feed-age", 36*time.Hour, "warn about a feed whose XMLTV date says it was generated longer ago than this (0 disables)")
+	fs.StringVar(&opts.MinFeedSize, "min-feed-size", "1KB", "treat a downloaded feed smaller than this as a corrupt download, before parsing it (0 disables; min_size in sources.yaml overrides it per feed)")
+	fs.BoolVar(&opts.RejectStale, "reject-stale", false, "fail a feed older than --max-feed-age like a download error, instead of only warning")
+	fs.StringVar(&opts.CACert, "ca-cert", "", "also trust the CA certificates in this PEM file for feed downloads and an https:// --proxy, e.g. a corporate proxy's that re-signs TLS")
+	fs.StringVar(&opts.InsecureSkipVerify, "insecure-skip-verify", "", "comma-separated providers whose TLS certificates are not verified, for mirrors with self-signed certificates (insecure: prefer --ca-cert)")
+	fs.StringVar(&opts.Proxy, "proxy", "", "download feeds through this proxy: http://, https://, socks5:// or socks5h://host:port, with user:password@ if needed (default $HTTPS_PROXY/$HTTP_PROXY, minus $NO_PROXY)")
+	fs.StringVar(&opts.FeedCache, "feed-cache", "", "keep each downloaded feed and its ETag/Last-Modified in this directory, so later runs request it conditionally and read it from disk when unchanged or unavailable (empty disables)")
+	fs.BoolVar(&opts.Offline, "offline", false, "download nothing and read every feed from --feed-cache, marking the outputs stale")
+	fs.StringVar(&opts.CacheDir, "cache-dir", "", "keep the caches in this directory: the feed cache (feeds/, unless --feed-cache says otherwise), the temp files of downloads (tmp/), and --state, --feed-cache and serve's --tls-cache when relative (empty keeps them in the working directory)")
+	fs.StringVar(&opts.CacheMaxSize, "cache-max-size", "", "evict the feeds used longest ago from the feed cache after a run until it fits in this size, e.g. 2GB (empty or 0 for no cap)")
+	fs.IntVar(&opts.Downloads, "parallel-downloads", 4, "download and parse up to this many feeds at once (1 downloads them one after another)")
+	fs.DurationVar(&opts.HostInterval, "host-interval", 0, "wait at least this long between two requests to the same feed host, retries and resumes included, e.g. 2s (0 disables)")
+	fs.StringVar(&opts.MaxDownloadRate, "max-download-rate", "", "read each feed host at no more than this many bytes per second, e.g. 500KB (empty or 0 for no limit)")
+	fs.IntVar(&opts.Retries, "retries", 2, "retry a feed request this many times after a connection failure or a 500, 502 or 504 response (0 disables)")
+	fs.DurationVar(&opts.RetryBackoff, "retry-backoff", 2*time.Second, "wait before the first retry, doubled for each further one, with jitter")
+	hideFlags(fs, "chaos")
+	opts.envErr = applyEnvDefaults(fs)
+	return opts
+}
+
+// runGenerate downloads the sources and writes the output files. Failures are
+// logged as they happen; the returned error only tells callers the run failed.
+// Every run ends with OnRunFinished and, with --pushgateway, pushed metrics.
+func runGenerate(opts *GenerateOptions) error {
+	logEntries = nil
+	throttleEvents = nil
+	collapsedProgrammes = nil
+	scheduleChanges = nil
+	runWarnings = nil
+	resetLog()
+
+	if opts.LogFile != "" {
+		defer func(previous string) { logName = previous }(logName)
+		logName = strings.TrimSuffix(opts.LogFile, ".log")
+	}
+	if opts.DryRunJSON != "" {
+		opts.DryRun = true
+	}
+	if opts.DryRun {
+		defer func(previous string) { logName = previous }(logName)
+		logName = ""
+	}
+	if opts.FromArchive {
+		// A replay must not rewrite the archive of what was published
+		defer func(previous int) { opts.ArchiveDays = previous }(opts.ArchiveDays)
+		opts.ArchiveDays = 0
+	}
+
+	result := RunFinished{Started: time.Now(), Partial: opts.partial()}
+	err := generate(opts, &result)
+	result.Duration, result.Err, result.Throttled = time.Since(result.Started), err, len(throttleEvents)
+	result.Warnings = runWarnings
+	opts.Hooks.runFinished(result)
+	if opts.Pushgateway != "" && !opts.DryRun {
+		if err := pushMetrics(opts.Pushgateway, filepath.Base(logName), result); err != nil {
+			fmt.Printf("⚠️  Could not push metrics to %s: %v\n", opts.Pushgateway, err)
+		}
+	}
+	return err
+}
+
+// generate is the body of runGenerate; it fills in result as it goes.
+func generate(opts *GenerateOptions, result *RunFinished) error {
+	startedAt := result.Started
 	logMessage("🚀 Starting EPG Parser...")
-	logMessage(fmt.Sprintf("🕒 Script started at: %s", time.Now().Format("2006-01-02 15:04:05 MST")))
+	logMessage(fmt.Sprintf("🕒 Script started at: %s", startedAt.Format("2006-01-02 15:04:05 MST")))
+
+	// Open the state database shared by every stage of the run; a dry run
+	// or a replay reads it without recording anything
+	open := openStateStore
+	if opts.DryRun {
+		open = openStateStoreReadOnly
+		logMessage("🧪 Dry run: feeds are downloaded and matched, but no files are written")
+	}
+	cacheMaxBytes, err := parseByteSize(opts.CacheMaxSize)
+	if err != nil {
+		err = fmt.Errorf("invalid --cache-max-size: %v", err)
+		logMessage(fmt.Sprintf("❌ %v", err))
+		saveLog()
+		return err
+	}
+	if opts.Offline && opts.feedCache().dir == "" {
+		err := fmt.Errorf("--offline needs --feed-cache")
+		logMessage(fmt.Sprintf("❌ %v", err))
+		saveLog()
+		return err
+	}
+	if opts.FromArchive {
+		if opts.Date == "" || opts.FeedArchive == "" {
+			err := fmt.Errorf("--from-archive needs --date and --feed-archive")
+			logMessage(fmt.Sprintf("❌ %v", err))
+			saveLog()
+			return err
+		}
+		open = openStateStoreReadOnly
+		logMessage(fmt.Sprintf("⏪ Replaying %s from the feeds archived in %s; the state database is not updated", opts.Date, opts.FeedArchive))
+	}
+	store, err := open(opts.statePath())
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error opening %s: %v", opts.statePath(), err))
+		saveLog()
+		return err
+	}
+	defer store.Close()
 
-	// Load IST timezone
-	ist, err := time.LoadLocation("Asia/Kolkata")
+	// Load the output timezone (IST unless --timezone says otherwise)
+	loc, fellBack, err := loadTimezone(opts.Timezone, opts.TimezoneFallback)
 	if err != nil {
-		logMessage(fmt.Sprintf("❌ Error loading IST timezone: %v", err))
+		logMessage(fmt.Sprintf("❌ Error %v", err))
 		saveLog()
-		return
+		return err
+	}
+	if fellBack {
+		logMessage(fmt.Sprintf("⚠️  WARNING: timezone %s is not available on this system; using the fixed offset %s without daylight saving. Install tzdata to fix this.", opts.Timezone, loc))
 	}
+	opts.runLoc = loc
 
-	// Get today and tomorrow in IST
-	now := time.Now().In(ist)
-	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, ist)
-	tomorrow := today.AddDate(0, 0, 1)
+	if err := opts.validateLayout(); err != nil {
+		logMessage(fmt.Sprintf("❌ %v", err))
+		saveLog()
+		return err
+	}
+	days := opts.outputDays()
+
+	// Get today in the output timezone
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if opts.Date != "" {
+		if today, err = time.ParseInLocation("2006-01-02", opts.Date, loc); err != nil {
+			err = fmt.Errorf("invalid --date %q: expected YYYY-MM-DD", opts.Date)
+			logMessage(fmt.Sprintf("❌ %v", err))
+			saveLog()
+			return err
+		}
+	}
 
-	logMessage(fmt.Sprintf("📅 Today (IST): %s", today.Format("2006-01-02")))
-	logMessage(fmt.Sprintf("📅 Tomorrow (IST): %s", tomorrow.Format("2006-01-02")))
+	for _, day := range days {
+		date := today.AddDate(0, 0, day.Offset)
+		logMessage(fmt.Sprintf("📅 %s (%s): %s", day.label(), date.Format("MST"), date.Format("2006-01-02")))
+	}
 
-	// Download and parse EPG files
-	logMessage("\n📥 Downloading Jio TV EPG...")
-	jioTV, err := downloadAndParseEPG("https://avkb.short.gy/jioepg.xml.gz")
+	stopWatchdog, err := startWatchdog(opts)
 	if err != nil {
-		logMessage(fmt.Sprintf("❌ Error downloading Jio TV EPG: %v", err))
+		logMessage(fmt.Sprintf("❌ %v", err))
 		saveLog()
-		return
+		return err
+	}
+	defer stopWatchdog()
+	if opts.Chaos != "" {
+		stop, err := startChaos(opts.Chaos)
+		if err != nil {
+			logMessage(fmt.Sprintf("❌ %v", err))
+			saveLog()
+			return err
+		}
+		defer stop()
+	}
+
+	// Download and parse EPG files, in priority order
+	config := opts.config
+	if config == nil {
+		if config, err = loadRunConfig(opts); err != nil {
+			logMessage(fmt.Sprintf("❌ Error %v", err))
+			saveLog()
+			return err
+		}
+	}
+	providers := config.Providers
+	if opts.Stdin {
+		providers = []Provider{stdinProvider}
 	}
-	logMessage(fmt.Sprintf("✅ Jio TV: %d channels, %d programmes", len(jioTV.Channels), len(jioTV.Programmes)))
 
-	logMessage("\n📥 Downloading Tata Play EPG...")
-	tataTV, err := downloadAndParseEPG("https://avkb.short.gy/tsepg.xml.gz")
+	lineups, err := loadLineups(opts.LineupDir)
 	if err != nil {
-		logMessage(fmt.Sprintf("❌ Error downloading Tata Play EPG: %v", err))
+		logMessage(fmt.Sprintf("❌ Error loading lineups: %v", err))
 		saveLog()
-		return
+		return err
 	}
-	logMessage(fmt.Sprintf("✅ Tata Play: %d channels, %d programmes", len(tataTV.Channels), len(tataTV.Programmes)))
-
-	// Create channel maps by ID and by normalized name
-	logMessage("\n🔀 Building channel index...")
-	jioChannelsByID := make(map[string]*Channel)
-	jioChannelsByName := make(map[string]*Channel)
-	for i := range jioTV.Channels {
-		ch := &jioTV.Channels[i]
-		jioChannelsByID[ch.ID] = ch
-		jioChannelsByName[normalizeChannelName(ch.DisplayName)] = ch
+	catchup, err := loadCatchupWindows(opts.CatchupFile)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error loading %s: %v", opts.CatchupFile, err))
+		saveLog()
+		return err
 	}
 
-	tataChannelsByID := make(map[string]*Channel)
-	tataChannelsByName := make(map[string]*Channel)
-	for i := range tataTV.Channels {
-		ch := &tataTV.Channels[i]
-		tataChannelsByID[ch.ID] = ch
-		tataChannelsByName[normalizeChannelName(ch.DisplayName)] = ch
+	// Skip the run when neither the feeds nor the configuration changed.
+	// Long-running processes keep their own feed cache instead. Catch-up
+	// flags change with the time of day, so runs with catch-up windows
+	// always regenerate.
+	inputs := ""
+	if !opts.partial() {
+		inputs = inputsFingerprint(opts, today)
+	}
+	// Feeds saved by `epg fetch` stand in for downloads, like the feed
+	// cache of a long-running process. A replay reads the day's archived
+	// feeds the same way.
+	feeds, feedsDir := opts.feeds, opts.FeedsDir
+	if opts.FromArchive {
+		feedsDir = feedArchiveDay(opts.FeedArchive, today)
+	}
+	if feedsDir != "" {
+		if feeds, err = loadFetchedFeeds(feedsDir); err != nil {
+			logMessage(fmt.Sprintf("❌ Error loading feeds from %s: %v", feedsDir, err))
+			saveLog()
+			return err
+		}
+		logMessage(fmt.Sprintf("📦 Using feeds saved in %s", feedsDir))
+	}
+	prefetched := make(map[string]*TV)
+	validators := make(map[string]FeedValidators)
+	if last, found := store.LastRun(); found && !opts.Force && !opts.DryRun && !opts.Stdin && !opts.Offline && len(catchup) == 0 && feeds == nil && inputs != "" && last.Inputs == inputs && outputsPresent(opts.Output) {
+		logMessage("\n🔎 Configuration unchanged since the last run, checking the feeds...")
+		var unchanged bool
+		prefetched, validators, unchanged = probeSources(providers, store, opts.feedCache())
+		if unchanged {
+			result.Unchanged = true
+			logMessage(fmt.Sprintf("💤 No changes since the run finished at %s: feeds and configuration are the same, outputs left as they are (--force to regenerate)", last.FinishedAt))
+			saveLog()
+			return nil
+		}
 	}
 
-	// Build programme maps by channel ID
-	logMessage("🔀 Building programme index...")
-	jioProgrammesByChannel := make(map[string][]Programme)
-	for _, prog := range jioTV.Programmes {
-		jioProgrammesByChannel[prog.Channel] = append(jioProgrammesByChannel[prog.Channel], prog)
+	sources := make([]*EPGSource, 0, len(providers))
+	failures := make([]string, 0)
+	deadSources := make([]string, 0)
+	used := make([]archivedFeed, 0, len(providers))
+	// A failed required source degrades the run instead of aborting it;
+	// the run fails only when no source at all could be read
+	degraded := make([]string, 0)
+	var firstFailure *sourceError
+	opts.staleFeeds = make(map[string]time.Time)
+	// Concurrent downloads log as one block rather than a paragraph each
+	paragraph := "\n"
+	if len(providers) > 1 && opts.Downloads > 1 {
+		logMessage(fmt.Sprintf("\n📥 Downloading %d feeds, up to %d at a time...", len(providers), opts.Downloads))
+		paragraph = ""
+	}
+	type download struct {
+		tv          *TV
+		validators  FeedValidators
+		err         error
+		downloadErr error
+		duration    time.Duration
+	}
+	downloads := fetchProviders(providers, opts.Downloads, func(provider Provider) download {
+		logMessage(fmt.Sprintf("%s📥 Downloading %s EPG...", paragraph, provider.Label))
+		fetchStarted := time.Now()
+		var d download
+		switch {
+		case prefetched[provider.URL] != nil:
+			d.tv = prefetched[provider.URL]
+			logMessage("   ♻️  Already downloaded while checking for changes")
+		case opts.Offline:
+			d.tv, d.err = lastCopyFeed(provider, opts.feedCache(), true, nil, opts.staleFeeds)
+		case feeds != nil || !provider.isXMLTV():
+			d.tv, d.err = feeds.fetchProvider(provider)
+		default:
+			d.tv, d.validators, _, d.err = downloadFeed(provider.URL, FeedValidators{}, opts.feedCache())
+		}
+		// The source's health is about the download, whatever stands in
+		d.downloadErr = d.err
+		if d.err != nil && !opts.Offline && opts.feedCache().dir != "" && feeds == nil && provider.isXMLTV() {
+			d.tv, d.err = lastCopyFeed(provider, opts.feedCache(), false, d.err, opts.staleFeeds)
+		}
+		// Archived feeds are old by design
+		if d.err == nil && !opts.FromArchive {
+			d.err = checkFreshness(provider, d.tv, opts.MaxFeedAge, opts.RejectStale, time.Now())
+		}
+		d.duration = time.Since(fetchStarted)
+		return d
+	})
+	// Results are handled in priority order, whichever finished first
+	for i, provider := range providers {
+		tv, err, downloadErr := downloads[i].tv, downloads[i].err, downloads[i].downloadErr
+		if prefetched[provider.URL] == nil && !opts.Offline && feeds == nil && provider.isXMLTV() {
+			validators[provider.URL] = downloads[i].validators
+		}
+		fetched := SourceFetched{Provider: provider.Name, URL: provider.URL, Duration: downloads[i].duration, Err: err}
+		if tv != nil {
+			fetched.Channels, fetched.Programmes = len(tv.Channels), len(tv.Programmes)
+		}
+		opts.Hooks.sourceFetched(fetched)
+		result.Sources = append(result.Sources, fetched)
+		// An offline run tried no download to record
+		var health SourceHealth
+		if !opts.Offline {
+			var healthErr error
+			if health, healthErr = store.RecordSourceResult(provider.Name, provider.URL, downloadErr); healthErr != nil {
+				logMessage(fmt.Sprintf("⚠️  Could not record source health: %v", healthErr))
+			}
+		}
+		// A source failing run after run is a dead URL, not a blip
+		if alert, dead := deadSource(provider, health, opts.DeadSourceRuns, opts.SourcesFile); downloadErr != nil && dead {
+			warn(warnSourceDead, provider.Name, "\n🪦 SOURCE LIKELY DEAD: "+alert)
+			deadSources = append(deadSources, alert)
+		}
+		if err != nil && firstFailure == nil {
+			firstFailure = &sourceError{Label: provider.Label, Err: err}
+		}
+		if err != nil && provider.Required {
+			warn(warnSourceFailed, provider.Name, fmt.Sprintf("❌ Error downloading %s EPG: %v; continuing with the other sources", provider.Label, err))
+			failures = append(failures, fmt.Sprintf("Downloading %s EPG: %v", provider.Label, err))
+			degraded = append(degraded, provider.Label)
+			continue
+		}
+		if err != nil {
+			warn(warnSourceSkipped, provider.Name, fmt.Sprintf("⚠️  Skipping %s EPG: %v", provider.Label, err))
+			failures = append(failures, fmt.Sprintf("Skipped %s EPG: %v", provider.Label, err))
+			continue
+		}
+		logMessage(fmt.Sprintf("✅ %s: %d channels, %d programmes", provider.Label, len(tv.Channels), len(tv.Programmes)))
+		src := newEPGSource(provider, tv)
+		if lineup, exists := lineups[strings.ToLower(provider.Name)]; exists {
+			missing := indexLineup(src, provider, lineup)
+			logMessage(fmt.Sprintf("📇 %s lineup: %d of %d channel numbers found in the feed", provider.Label, len(src.ChannelsByNumber), len(lineup)))
+			if len(missing) > 0 {
+				warn(warnLineupMissing, provider.Name, fmt.Sprintf("   ⚠️  Not in the feed: %s", strings.Join(missing, ", ")))
+			}
+		}
+		sources = append(sources, src)
+		used = append(used, archivedFeed{Provider: provider, TV: tv})
+	}
+	if len(sources) == 0 && firstFailure != nil {
+		logMessage("❌ No source could be read")
+		notifySlack(opts, RunReport{
+			Title:       "EPG run failed",
+			Failures:    failures,
+			DeadSources: deadSources,
+		})
+		saveLog()
+		return firstFailure
+	}
+	if len(degraded) > 0 {
+		logMessage(fmt.Sprintf("⚠️  Degraded coverage: continuing without %s", strings.Join(degraded, ", ")))
+	}
+	if opts.FeedArchive != "" && !opts.FromArchive && !opts.DryRun && !opts.partial() {
+		if err := saveFeedArchive(opts.FeedArchive, today, used, opts.ArchiveDays); err != nil {
+			logMessage(fmt.Sprintf("⚠️  Could not archive the feeds: %v", err))
+		} else {
+			logMessage(fmt.Sprintf("🗄️  Feeds archived in %s", feedArchiveDay(opts.FeedArchive, today)))
+		}
+	}
+	// The feed cache is trimmed to --cache-max-size once this run is done
+	// with it
+	if evicted, freed, err := pruneFeedCache(opts.feedCache().dir, opts.tempDir(), cacheMaxBytes); errors.Is(err, errCacheBusy) {
+		logMessage("⏭️  Feed cache in use by another run; not pruning it this time")
+	} else if err != nil {
+		logMessage(fmt.Sprintf("⚠️  Could not prune the feed cache: %v", err))
+	} else if freed > 0 {
+		logMessage(fmt.Sprintf("🧹 Feed cache pruned: %d feeds evicted, %s freed", evicted, formatByteSize(int(freed))))
 	}
 
-	tataProgrammesByChannel := make(map[string][]Programme)
-	for _, prog := range tataTV.Programmes {
-		tataProgrammesByChannel[prog.Channel] = append(tataProgrammesByChannel[prog.Channel], prog)
+	// Build channel and programme indexes
+	logMessage("\n🔀 Building channel index...")
+	for _, src := range sources {
+		logMessage(fmt.Sprintf("✅ Indexed %d %s channels", len(src.ChannelsByName), src.Name))
+	}
+	for _, src := range sources {
+		logOffsetSummary(src)
 	}
 
-	logMessage(fmt.Sprintf("✅ Indexed %d Jio channels and %d Tata channels", len(jioChannelsByName), len(tataChannelsByName)))
+	// Set up the matching strategies
+	aliases, err := loadAliases(opts.AliasFile)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error loading %s: %v", opts.AliasFile, err))
+		saveLog()
+		return err
+	}
+	matcher, err := buildMatcherChain(opts.MatchStrategies, aliases, store)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Invalid --match: %v", err))
+		saveLog()
+		return err
+	}
+	logMessage(fmt.Sprintf("🧩 Match strategies: %s (%d aliases)", matcher.Name(), len(aliases)))
 
-	// Load filter rules
-	logMessage("\n📋 Loading filter.txt...")
-	filterRules, err := loadFilterRules("filter.txt")
+	overlap, err := parseOverlapStrategy(opts.Overlap)
 	if err != nil {
-		logMessage(fmt.Sprintf("❌ Error loading filter.txt: %v", err))
+		logMessage(fmt.Sprintf("❌ Invalid --overlap: %v", err))
 		saveLog()
-		return
+		return err
+	}
+	overlapRules, err := loadOverlapRules(opts.OverlapFile)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error loading %s: %v", opts.OverlapFile, err))
+		saveLog()
+		return err
+	}
+	logMessage(fmt.Sprintf("🔀 Channels in several sources: %s (%d per-channel overrides)", overlap, len(overlapRules)))
+
+	// Load filter rules, or make one per channel with --all-channels
+	filterRules := config.Rules
+	switch {
+	case opts.AllChannels:
+		var unnamed int
+		filterRules, unnamed = discoverRules(providers, sources)
+		logMessage(fmt.Sprintf("\n🌐 Discovered %d channels in %d sources (--all-channels)", len(filterRules), len(sources)))
+		if unnamed > 0 {
+			logMessage(fmt.Sprintf("   ⏭️  Left out %d channels whose names have no Latin letters or digits to match or name files by", unnamed))
+		}
+	case opts.config != nil:
+		logMessage(fmt.Sprintf("\n📋 Loading %s...", opts.FilterFile))
+		logMessage(fmt.Sprintf("✅ Using %d filter rules loaded at %s (SIGHUP reloads)", len(filterRules), config.LoadedAt.Format("15:04:05")))
+	default:
+		logMessage(fmt.Sprintf("\n📋 Loading %s...", opts.FilterFile))
+		logMessage(fmt.Sprintf("✅ Loaded %d filter rules", len(filterRules)))
+	}
+
+	if opts.partial() {
+		total := len(filterRules)
+		filterRules = selectFilterRules(filterRules, opts.Only, opts.Skip)
+		logMessage(fmt.Sprintf("🎯 Restricted to %d of %d rules (--only/--skip); existing outputs are kept", len(filterRules), total))
 	}
-	logMessage(fmt.Sprintf("✅ Loaded %d filter rules", len(filterRules)))
 
 	// Print all filter rules
 	logMessage("\n📝 Filter Rules:")
 	for i, rule := range filterRules {
-		logMessage(fmt.Sprintf("   %d. %s → %s", i+1, rule.OriginalName, rule.OutputName))
+		pinned := ""
+		if rule.Source != "" {
+			pinned = " (@" + rule.Source + ")"
+		}
+		logMessage(fmt.Sprintf("   %d. %s%s → %s", i+1, rule.OriginalName, pinned, rule.OutputName))
 	}
 
-	// Create output directories
-	os.RemoveAll("output-today")
-	os.RemoveAll("output-tomorrow")
-	os.MkdirAll("output-today", 0755)
-	os.MkdirAll("output-tomorrow", 0755)
+	// Load canonical channel ID overrides
+	canonicalIDs, err := loadCanonicalIDs(opts.ChannelIDFile)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error loading %s: %v", opts.ChannelIDFile, err))
+		saveLog()
+		return err
+	}
+	logos, err := loadLogoCatalog(opts.LogoFile)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error loading %s: %v", opts.LogoFile, err))
+		saveLog()
+		return err
+	}
+	if len(logos) > 0 {
+		logMessage(fmt.Sprintf("🖼️  Logo catalog: %d logos", len(logos)))
+	}
+	if opts.ChannelNames != channelNamesProvider && opts.ChannelNames != channelNamesFilter {
+		err := fmt.Errorf("want %s or %s, got %q", channelNamesProvider, channelNamesFilter, opts.ChannelNames)
+		logMessage(fmt.Sprintf("❌ Invalid --channel-names: %v", err))
+		saveLog()
+		return err
+	}
+	switch opts.OverlapPolicy {
+	case overlapPolicyBoth, overlapPolicyStartDay, overlapPolicyEndDay:
+	default:
+		err := fmt.Errorf("want %s, %s or %s, got %q", overlapPolicyBoth, overlapPolicyStartDay, overlapPolicyEndDay, opts.OverlapPolicy)
+		logMessage(fmt.Sprintf("❌ Invalid --overlap-policy: %v", err))
+		saveLog()
+		return err
+	}
+	enrichers, err := parseEnrichers(opts.Enrich)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Invalid --enrich: %v", err))
+		saveLog()
+		return err
+	}
+
+	var grid *weeklyGrid
+	if opts.XLSX != "" {
+		slot, err := parseGridSlot(opts.XLSXSlot)
+		if err != nil {
+			logMessage(fmt.Sprintf("❌ Invalid --xlsx-slot: %v", err))
+			saveLog()
+			return err
+		}
+		grid = newWeeklyGrid(slot)
+	}
+
+	// Load airing history for first-airing detection
+	history, err := loadAiringHistory(store)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error loading airing history: %v", err))
+		saveLog()
+		return err
+	}
+
+	opts.maxFileBytes, err = parseByteSize(opts.MaxFileSize)
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Invalid --max-file-size: %v", err))
+		saveLog()
+		return err
+	}
+
+	// Open the output backend and clear the output directories. A dry run
+	// writes to memory and lists what it would have written.
+	var dryRunOut *MemFS
+	out, err := openOutput(opts.Output)
+	if opts.DryRun {
+		dryRunOut = newMemFS()
+		out, err = dryRunOut, nil
+	}
+	if err != nil {
+		logMessage(fmt.Sprintf("❌ Error opening output %s: %v", opts.Output, err))
+		saveLog()
+		return err
+	}
+	defer out.Close()
+	var previousManifest *Manifest
+	if opts.partial() {
+		previousManifest = loadManifest(out)
+	}
+	// Channels no longer in the filter keep their last files for
+	// --removed-grace, read back before the folders are cleared
+	var removed removedChannels
+	if !opts.partial() {
+		current := make(map[string]bool, len(filterRules))
+		for _, rule := range filterRules {
+			current[strings.TrimSuffix(formatFilename(rule.OutputName), ".json")] = true
+		}
+		dirs := make([]string, 0, len(days))
+		for _, day := range days {
+			dirs = append(dirs, day.Dir)
+		}
+		removed = keptRemovedChannels(out, dirs, current, opts.RemovedGrace, now)
+	}
+	// Today's files are also kept under archive/DATE for --archive-days,
+	// except the deprecated copies of removed channels
+	backend := out
+	archived, archiveIndex := out, loadArchiveIndex(out)
+	todayArchive := archiveDir + "/" + today.Format("2006-01-02")
+	if opts.ArchiveDays > 0 {
+		archived = archiveFS{OutputFS: out, from: opts.OutputToday, to: todayArchive, except: removed.files}
+	}
+	if opts.Recurrence {
+		if opts.ArchiveDays < 7 {
+			logMessage("⚠️  --recurrence needs --archive-days 7 or more to tell weekly programmes from one-offs; no programme is tagged")
+		}
+		opts.recurrence = loadRecurrenceHistory(out, archiveIndex)
+	}
+	manifest := newManifestFS(archived, previousManifest)
+	out = manifest
+	if opts.Canonical {
+		manifest.canonical = true
+		out = canonicalFS{out}
+	}
+	// With --patches, channel files the run replaces get a patch from their
+	// previous copy, read before the folders are cleared
+	var patches *patchFS
+	if opts.Patches {
+		names := make([]string, 0, len(filterRules)*len(days))
+		for _, rule := range filterRules {
+			for _, day := range days {
+				names = append(names, day.Dir+"/"+formatFilename(rule.OutputName))
+			}
+		}
+		var readable bool
+		patches, readable = newPatchFS(out, backend, names)
+		if !readable && !opts.DryRun {
+			logMessage(fmt.Sprintf("⚠️  --patches: output %s cannot read back the previous files, so no patches are written", opts.Output))
+		}
+		out = patches
+	}
+	out = opts.Hooks.wrapOutput(out)
+	if !opts.partial() {
+		out.RemoveAll(opts.OutputToday)
+		out.RemoveAll(opts.OutputTomorrow)
+		for _, day := range days[min(2, len(days)):] {
+			out.RemoveAll(day.Dir)
+		}
+		if opts.ArchiveDays > 0 {
+			out.RemoveAll(todayArchive)
+		}
+	}
 
 	// Process channels
 	logMessage("\n⚙️  Processing channels...")
 	logMessage("=" + strings.Repeat("=", 80))
-	
+
 	processed := 0
 	savedToday := 0
 	savedTomorrow := 0
+	savedLater := 0
 	skipped := 0
+	identities := make([]ChannelIdentity, 0)
+	analytics := newAnalytics()
+	published := make([]publishedFile, 0)
+	images := make(imageRefs)
+	programmeCounts := make(map[string]int)
+	slots := make(map[string]map[string][]string)
+	for _, day := range days {
+		slots[today.AddDate(0, 0, day.Offset).Format("2006-01-02")] = map[string][]string{}
+	}
+	unmatched := make([]string, 0)
 
+	criticalMissing := make([]string, 0)
 	for _, rule := range filterRules {
 		processed++
 		logEntry := LogEntry{
@@ -186,75 +1245,145 @@ func main() {
 			Status:    "Not Found",
 		}
 
-		// Try to find channel in Jio first, then Tata
-		normalizedSearch := normalizeChannelName(rule.OriginalName)
-		
-		var channel *Channel
-		var programmes []Programme
-		var source string
-
-		// Check Jio first
-		if ch, exists := jioChannelsByName[normalizedSearch]; exists {
-			channel = ch
-			programmes = jioProgrammesByChannel[ch.ID]
-			source = "Jio"
-		} else if ch, exists := tataChannelsByName[normalizedSearch]; exists {
-			channel = ch
-			programmes = tataProgrammesByChannel[ch.ID]
-			source = "Tata"
-		} else {
-			// Try fuzzy matching
-			channel, programmes, source = fuzzyFindChannel(rule.OriginalName, 
-				jioChannelsByName, tataChannelsByName,
-				jioProgrammesByChannel, tataProgrammesByChannel)
+		// A rule's own timezone replaces the run's for its days and times,
+		// which keep the same dates
+		loc, today := loc, today
+		if rule.Timezone != "" {
+			loc = ruleLocation(rule, loc)
+			today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc)
 		}
 
-		if channel == nil {
-			logMessage(fmt.Sprintf("❌ Channel not found: %s", rule.OriginalName))
+		// Try each strategy in order; sources are consulted in provider order
+		ruleSources := pinnedSources(sources, rule.Source)
+		if rule.Source != "" && len(ruleSources) == 0 {
+			warn(warnPinnedSource, rule.OriginalName, fmt.Sprintf("⚠️  %s is pinned to source %s, which was not loaded", rule.OriginalName, rule.Source))
+		}
+		match := matcher.Match(rule, ruleSources)
+		if match != nil {
+			strategy := overlapStrategyFor(rule, overlap, overlapRules)
+			match = resolveOverlap(strategy, match, rule, matcher.nonInteractive(), ruleSources, today, today.AddDate(0, 0, opts.Days), loc, opts.DuplicateTolerance)
+		}
+		opts.Hooks.channelMatched(ChannelMatched{Rule: rule, Match: match})
+		if match == nil {
+			warn(warnUnmatchedChannel, rule.OriginalName, fmt.Sprintf("❌ Channel not found: %s", rule.OriginalName))
+			unmatched = append(unmatched, strings.TrimSuffix(formatFilename(rule.OutputName), ".json"))
+			failures = append(failures, rule.OriginalName+": not found")
+			if rule.Critical {
+				criticalMissing = append(criticalMissing, rule.OriginalName)
+			}
 			logEntry.Status = "Not Found"
 			logEntries = append(logEntries, logEntry)
 			skipped++
 			continue
 		}
+		channel := match.Channel
+		if err := store.RecordMatch(rule, match); err != nil {
+			logMessage(fmt.Sprintf("   ⚠️  Could not cache match: %v", err))
+		}
 
-		logMessage(fmt.Sprintf("\n✅ Found: %s (from %s, ID: %s)", channel.DisplayName, source, channel.ID))
-		logMessage(fmt.Sprintf("   Total programmes: %d", len(programmes)))
+		logMessage(fmt.Sprintf("\n✅ Found: %s (from %s, ID: %s, via %s, %s)", channel.DisplayName, match.sources(), channel.ID, match.Strategy, match.Overlap))
+		logEntry.Source = match.sources()
+		logEntry.Strategy = match.Strategy + ", " + match.Overlap
+		logMessage(fmt.Sprintf("   Total programmes: %d", len(match.Programmes)))
+		programmes, enriched := enrichProgrammes(match.Programmes, match.providers(), enrichers, loc)
+		if enriched > 0 {
+			logMessage(fmt.Sprintf("   ✨ Enriched %d programmes from provider APIs", enriched))
+		}
 
-		// Filter and save today's schedule
-		todayProgs := filterProgrammesByDateRange(programmes, today, ist)
-		logMessage(fmt.Sprintf("   Today's programmes: %d", len(todayProgs)))
-		logEntry.TodayPrograms = len(todayProgs)
+		// Published name and logo; the provider's are kept unless overridden
+		presented := *channel
+		if rule.Logo != "" {
+			presented.Icon.Src = rule.Logo
+		} else if logo, exists := catalogLogo(logos, rule, channel); exists {
+			presented.Icon.Src = logo
+		}
+		if name, exists := ruleChannelName(rule); exists && opts.ChannelNames == channelNamesFilter {
+			presented.DisplayName = name
+		}
+		channel = &presented
 
-		if len(todayProgs) > 0 {
-			err := saveChannelJSON(channel, todayProgs, today, rule.OutputName, "output-today", ist)
-			if err == nil {
-				savedToday++
-				logMessage(fmt.Sprintf("   ✅ Saved: output-today/%s", formatFilename(rule.OutputName)))
-			} else {
-				logMessage(fmt.Sprintf("   ❌ Error saving today: %v", err))
-			}
+		identity := ChannelIdentity{
+			ID:        canonicalChannelID(rule.OutputName, canonicalIDs),
+			Name:      channel.DisplayName,
+			File:      formatFilename(rule.OutputName),
+			Providers: match.providers(),
+		}
+		if previous, err := store.RegisterSlug(strings.TrimSuffix(identity.File, ".json"), identity.ID); err != nil {
+			logMessage(fmt.Sprintf("   ⚠️  Could not register slug: %v", err))
+		} else if previous != "" {
+			warn(warnIDChanged, rule.OriginalName, fmt.Sprintf("   ⚠️  %s changed channel_id: %s → %s", identity.File, previous, identity.ID))
 		}
 
-		// Filter and save tomorrow's schedule
-		tomorrowProgs := filterProgrammesByDateRange(programmes, tomorrow, ist)
-		logMessage(fmt.Sprintf("   Tomorrow's programmes: %d", len(tomorrowProgs)))
-		logEntry.TomorrowPrograms = len(tomorrowProgs)
+		// Filter and save each day's schedule
+		slug := strings.TrimSuffix(identity.File, ".json")
+		total := 0
+		for _, day := range days {
+			date := today.AddDate(0, 0, day.Offset)
+			dayProgs := filterProgrammesByDateRange(programmes, date, loc, opts.OverlapPolicy)
+			logMessage(fmt.Sprintf("   %s's programmes: %d", day.label(), len(dayProgs)))
+			total += len(dayProgs)
+			switch day.Offset {
+			case 0:
+				logEntry.TodayPrograms = len(dayProgs)
+			case 1:
+				logEntry.TomorrowPrograms = len(dayProgs)
+			}
+			if len(dayProgs) == 0 {
+				// Clients get an empty schedule instead of a 404
+				if opts.Placeholders {
+					if err := saveChannelJSON(out, channel, identity, nil, date, day.Dir, loc, history, 0, 0, opts); err != nil {
+						logMessage(fmt.Sprintf("   ❌ Error saving %s placeholder: %v", strings.ToLower(day.label()), err))
+					} else {
+						logMessage(fmt.Sprintf("   📭 No data: saved placeholder %s/%s", day.Dir, identity.File))
+					}
+				}
+				continue
+			}
 
-		if len(tomorrowProgs) > 0 {
-			err := saveChannelJSON(channel, tomorrowProgs, tomorrow, rule.OutputName, "output-tomorrow", ist)
-			if err == nil {
+			analytics.add(identity, dayProgs, date, loc)
+			slots[date.Format("2006-01-02")][slug] = scheduleSlots(dayProgs, loc)
+			err := saveChannelJSON(out, channel, identity, dayProgs, date, day.Dir, loc, history, catchupWindowFor(rule, catchup), maxProgrammesFor(rule, opts), opts)
+			if err != nil {
+				logMessage(fmt.Sprintf("   ❌ Error saving %s: %v", strings.ToLower(day.label()), err))
+				failures = append(failures, fmt.Sprintf("%s: saving %s: %v", rule.OriginalName, strings.ToLower(day.label()), err))
+				continue
+			}
+			switch day.Offset {
+			case 0:
+				savedToday++
+			case 1:
 				savedTomorrow++
-				logMessage(fmt.Sprintf("   ✅ Saved: output-tomorrow/%s", formatFilename(rule.OutputName)))
-			} else {
-				logMessage(fmt.Sprintf("   ❌ Error saving tomorrow: %v", err))
+			default:
+				savedLater++
 			}
+			published = append(published, publishedFile{Path: day.Dir + "/" + identity.File, Channel: channel.DisplayName, Date: date.Format("2006-01-02"), Programmes: len(dayProgs)})
+			images.add(channel.Icon.Src, identity.File)
+			for _, prog := range dayProgs {
+				images.add(prog.logo(), identity.File)
+				if opts.Artwork {
+					for _, art := range prog.artwork() {
+						images.add(art.URL, identity.File)
+					}
+				}
+			}
+			logMessage(fmt.Sprintf("   ✅ Saved: %s/%s", day.Dir, identity.File))
 		}
+		programmeCounts[slug] = total
 
-		if len(todayProgs) == 0 && len(tomorrowProgs) == 0 {
+		if grid != nil {
+			grid.add(channel.DisplayName, programmes, today, loc)
+		}
+		if total == 0 {
+			warn(warnLowCoverage, rule.OriginalName, fmt.Sprintf("   ⚠️  No programmes for %s on any day", rule.OriginalName))
+			failures = append(failures, rule.OriginalName+": no programmes")
+			if rule.Critical {
+				criticalMissing = append(criticalMissing, rule.OriginalName)
+			}
 			logEntry.Status = "No Programmes"
 			skipped++
 		} else {
 			logEntry.Status = "Success"
+			identities = append(identities, identity)
 		}
 
 		logEntries = append(logEntries, logEntry)
@@ -265,33 +1394,246 @@ func main() {
 	logMessage(fmt.Sprintf("   Total Processed: %d channels", processed))
 	logMessage(fmt.Sprintf("   ✅ Saved Today: %d", savedToday))
 	logMessage(fmt.Sprintf("   ✅ Saved Tomorrow: %d", savedTomorrow))
+	if opts.Days > 2 {
+		logMessage(fmt.Sprintf("   ✅ Saved Later Days: %d", savedLater))
+	}
 	logMessage(fmt.Sprintf("   ❌ Skipped: %d", skipped))
+	logWarningCounts(runWarnings)
+	if len(degraded) > 0 {
+		logMessage(fmt.Sprintf("   ⚠️  Degraded coverage: %s failed, %d of %d sources used", strings.Join(degraded, ", "), len(sources), len(providers)))
+	}
+	if patches != nil {
+		logMessage(fmt.Sprintf("   🩹 Patches: %d", patches.written))
+	}
+	if len(throttleEvents) > 0 {
+		logMessage(fmt.Sprintf("   ⏳ Throttled: %d responses (see detailed log)", len(throttleEvents)))
+	}
 	logMessage(fmt.Sprintf("\n🕒 Script completed at: %s", time.Now().Format("2006-01-02 15:04:05 MST")))
 
+	// Outputs are stamped with the time of the run. --canonical leaves
+	// generated_at out and dates the pages by the feeds instead, so the
+	// same feeds give the same files.
+	generatedAt := time.Now().In(loc).Format(time.RFC3339)
+	stamp, feedDate := generatedAt, ""
+	if opts.Canonical {
+		generatedAt, stamp = "", today.Format(time.RFC3339)
+		if newest, ok := newestFeedDate(used); ok {
+			feedDate = newest.In(loc).Format(time.RFC3339)
+			stamp = feedDate
+		}
+	}
+
+	if opts.PrewarmImages {
+		logMessage("\n🔥 Pre-warming images...")
+		dead := prewarmImages(images, opts.PrewarmWorkers)
+		logMessage(fmt.Sprintf("   ✅ Checked %d images, %d dead", len(images), len(dead)))
+		report := QualityReport{
+			GeneratedAt:   generatedAt,
+			ImagesChecked: len(images),
+			DeadImages:    dead,
+		}
+		if err := saveQualityReport(out, "quality-report.json", report); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving quality-report.json: %v", err))
+		}
+	}
+
+	if !opts.partial() {
+		if err := removed.save(out); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving the files of removed channels: %v", err))
+		} else if kept := removed.identities(); len(kept) > 0 {
+			logMessage(fmt.Sprintf("🚧 Kept %d channels removed from the filter, marked deprecated for --removed-grace %s", len(kept), opts.RemovedGrace))
+			identities = append(identities, kept...)
+		}
+		if len(removed.expired) > 0 {
+			logMessage(fmt.Sprintf("🗑️  Grace period over, no longer published: %s", strings.Join(removed.expired, ", ")))
+		}
+		if err := saveChannelIndex(out, "channels.json", identities); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving channels.json: %v", err))
+		}
+		if err := analytics.Save(out, "analytics.json", generatedAt); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving analytics.json: %v", err))
+		}
+		if err := saveStaticIndex(out, published, opts.BaseURL, stamp); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving index.html/sitemap.xml: %v", err))
+		}
+		if grid != nil && len(grid.sheets) > 0 {
+			if err := grid.Save(out, opts.XLSX); err != nil {
+				logMessage(fmt.Sprintf("❌ Error saving %s: %v", opts.XLSX, err))
+			} else {
+				logMessage(fmt.Sprintf("📊 Saved %s: %d channel sheets", opts.XLSX, len(grid.sheets)))
+			}
+		}
+	}
+	if opts.ArchiveDays > 0 {
+		archivedChannels := make([]string, 0, savedToday)
+		for _, file := range published {
+			if file.Date == today.Format("2006-01-02") && strings.HasPrefix(file.Path, opts.OutputToday+"/") {
+				archivedChannels = append(archivedChannels, strings.TrimSuffix(path.Base(file.Path), ".json"))
+			}
+		}
+		index, err := updateArchive(out, archiveIndex, today, archivedChannels, opts.ArchiveDays, opts.partial(), generatedAt)
+		if err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving %s: %v", archiveIndexFile, err))
+		} else {
+			logMessage(fmt.Sprintf("🗄️  Archive: %d days retained", len(index.Days)))
+		}
+	}
+	// A partial run can only update the manifest when it can read the
+	// previous one; otherwise it would drop the channels it skipped.
+	if !opts.partial() || previousManifest != nil {
+		if err := manifest.save(generatedAt, feedDate); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving %s: %v", manifestFile, err))
+		}
+	} else {
+		logMessage(fmt.Sprintf("⚠️  %s not updated: no previous manifest to merge this partial run into", manifestFile))
+	}
+	if err := out.Close(); err != nil {
+		logMessage(fmt.Sprintf("❌ Error finalizing output %s: %v", opts.Output, err))
+	}
+	if err := history.Save(store, now); err != nil {
+		logMessage(fmt.Sprintf("❌ Error saving airing history: %v", err))
+	}
+	run := RunMetadata{
+		StartedAt:     startedAt.Format(time.RFC3339),
+		FinishedAt:    time.Now().Format(time.RFC3339),
+		Processed:     processed,
+		SavedToday:    savedToday,
+		SavedTomorrow: savedTomorrow,
+		Skipped:       skipped,
+		Programmes:    programmeCounts,
+		Unmatched:     unmatched,
+		Slots:         slots,
+		Inputs:        inputs,
+	}
+	// A --only/--skip run (the daemon's volatile and alias runs too) sees a
+	// subset of the channels, so it is compared with the last full run but
+	// does not replace it
+	previousRun, hadPrevious := store.LastRun()
+	if !opts.partial() {
+		if err := store.RecordRun(run); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving run metadata: %v", err))
+		}
+	}
+	for url, feed := range validators {
+		if err := store.RecordFeedValidators(url, feed); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving feed validators: %v", err))
+		}
+	}
+
+	result.Processed, result.SavedToday, result.SavedTomorrow, result.Skipped = processed, savedToday, savedTomorrow, skipped
+
+	report := RunReport{
+		Title:         "EPG run " + now.Format("2006-01-02 15:04 MST"),
+		Processed:     processed,
+		SavedToday:    savedToday,
+		SavedTomorrow: savedTomorrow,
+		Skipped:       skipped,
+		Failures:      failures,
+		DeadSources:   deadSources,
+		Links:         reportLinks(opts.BaseURL, opts.PrewarmImages),
+	}
+	if hadPrevious {
+		report.CoverageDrops, report.NewUnmatched = compareRuns(previousRun, run)
+		for _, drop := range report.CoverageDrops {
+			warn(warnLowCoverage, drop.Channel, fmt.Sprintf("📉 %s lists %d programmes, down from %d last run", drop.Channel, drop.After, drop.Before))
+		}
+		scheduleChanges = compareSchedules(previousRun, run)
+		logScheduleStability(scheduleChanges)
+		report.ReplacedLineups = replacedLineups(scheduleChanges)
+	}
+	if len(degraded) > 0 {
+		report.Title = "EPG run degraded: " + strings.Join(degraded, ", ") + " failed"
+	}
+	problems := strictProblems(opts, processed, len(identities), unmatched, degraded)
+	if len(problems) > 0 {
+		logMessage(fmt.Sprintf("\n🚫 Strict checks failed: %s", strings.Join(problems, "; ")))
+		report.Title = "EPG run failed: strict checks"
+		report.Failures = append(report.Failures, problems...)
+	}
+	if len(criticalMissing) > 0 {
+		logMessage(fmt.Sprintf("\n🚨 Critical channels without a schedule: %s", strings.Join(criticalMissing, ", ")))
+		report.Title = "EPG run failed: critical channels missing"
+	}
+	if opts.DryRun {
+		if err := logDryRun(dryRunReport(opts.Output, dryRunOut, published, unmatched), opts.DryRunJSON); err != nil {
+			logMessage(fmt.Sprintf("❌ Error saving %s: %v", opts.DryRunJSON, err))
+		}
+	} else {
+		notifySlack(opts, report)
+	}
+
 	// Save detailed log
 	saveLog()
 	saveDetailedLog()
-	logMessage("\n✅ Done! Check epg-parser.log for details.")
+	saveRunSummary(RunSummary{
+		FinishedAt:    time.Now().In(loc).Format(time.RFC3339),
+		Processed:     processed,
+		SavedToday:    savedToday,
+		SavedTomorrow: savedTomorrow,
+		Skipped:       skipped,
+		Degraded:      degraded,
+		WarningCounts: warningCounts(runWarnings),
+		Warnings:      runWarnings,
+	})
+	if !opts.DryRun {
+		logMessage(fmt.Sprintf("\n✅ Done! Check %s.log for details.", logName))
+	}
+	if len(criticalMissing) > 0 {
+		return fmt.Errorf("%w: %s", errCriticalChannels, strings.Join(criticalMissing, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", errPartialRun, strings.Join(problems, "; "))
+	}
+	return nil
 }
 
+// downloadAndParseEPG reads the feed at url, an HTTP URL or a local file,
+// in its two stages: fetchEPG, then decodeEPG.
 func downloadAndParseEPG(url string) (*TV, error) {
-	resp, err := http.Get(url)
+	body, err := fetchEPG(url)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return decodeEPGWithin(url, bytes.NewReader(body))
+}
 
-	gzReader, err := gzip.NewReader(resp.Body)
+// fetchEPG returns the raw, possibly gzipped, feed at url.
+func fetchEPG(url string) ([]byte, error) {
+	resp, err := httpGet(url, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer gzReader.Close()
+	defer resp.Body.Close()
+	return readFeedBody(url, resp)
+}
+
+// decodeEPG parses an XMLTV document, gzipped or plain. Errors are
+// feedErrors, without the URL, of the decompress or parse stage.
+func decodeEPG(body io.Reader) (*TV, error) {
+	compressed := &countingReader{r: body}
+	buffered := bufio.NewReader(compressed)
+	// consumed is how far into body decompression got
+	consumed := func() int64 { return compressed.n - int64(buffered.Buffered()) }
+	var document io.Reader = buffered
+	var decompressed *countingReader
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, &feedError{Stage: stageDecompress, Offset: consumed(), Err: err}
+		}
+		defer gzReader.Close()
+		decompressed = &countingReader{r: gzReader}
+		document = decompressed
+	}
 
 	var tv TV
-	decoder := xml.NewDecoder(gzReader)
-	err = decoder.Decode(&tv)
+	decoder := xml.NewDecoder(document)
+	err := decoder.Decode(&tv)
 	if err != nil {
-		return nil, err
+		if decompressed != nil && decompressed.err != nil {
+			return nil, &feedError{Stage: stageDecompress, Offset: consumed(), Err: decompressed.err}
+		}
+		return nil, &feedError{Stage: stageParse, Offset: decoder.InputOffset(), Err: err}
 	}
 
 	return &tv, nil
@@ -300,44 +1642,30 @@ func downloadAndParseEPG(url string) (*TV, error) {
 func normalizeChannelName(name string) string {
 	// Remove .json extension
 	name = strings.TrimSuffix(name, ".json")
-	
+
 	// Convert to lowercase
 	name = strings.ToLower(name)
-	
+
 	// Remove all spaces, dashes, and special characters
 	reg := regexp.MustCompile(`[^a-z0-9]`)
 	name = reg.ReplaceAllString(name, "")
-	
-	return name
-}
 
-func fuzzyFindChannel(searchName string, jioChannels, tataChannels map[string]*Channel,
-	jioProgrammes, tataProgrammes map[string][]Programme) (*Channel, []Programme, string) {
-	
-	normalized := normalizeChannelName(searchName)
-	
-	// Try partial matching in Jio
-	for key, ch := range jioChannels {
-		if strings.Contains(key, normalized) || strings.Contains(normalized, key) {
-			return ch, jioProgrammes[ch.ID], "Jio"
-		}
-	}
-	
-	// Try partial matching in Tata
-	for key, ch := range tataChannels {
-		if strings.Contains(key, normalized) || strings.Contains(normalized, key) {
-			return ch, tataProgrammes[ch.ID], "Tata"
-		}
-	}
-	
-	return nil, nil, ""
+	return name
 }
 
+// loadFilterRules reads filter.txt, filter.yaml when filename ends in .yaml
+// or .yml, or an M3U playlist when it ends in .m3u or .m3u8.
 func loadFilterRules(filename string) ([]FilterRule, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
+	if isYAMLFilter(filename) {
+		return parseFilterYAML(data)
+	}
+	if isPlaylistFilter(filename) {
+		return parsePlaylist(data), nil
+	}
 
 	lines := strings.Split(string(data), "\n")
 	rules := make([]FilterRule, 0)
@@ -351,11 +1679,11 @@ func loadFilterRules(filename string) ([]FilterRule, error) {
 		var rule FilterRule
 		if strings.Contains(line, "=") {
 			parts := strings.SplitN(line, "=", 2)
-			rule.OriginalName = strings.TrimSpace(parts[0])
+			rule.OriginalName, rule.Source = cutSourcePin(strings.TrimSpace(parts[0]))
 			rule.OutputName = strings.TrimSpace(parts[1])
 		} else {
-			rule.OriginalName = line
-			rule.OutputName = line
+			rule.OriginalName, rule.Source = cutSourcePin(line)
+			rule.OutputName = rule.OriginalName
 		}
 
 		rules = append(rules, rule)
@@ -364,10 +1692,70 @@ func loadFilterRules(filename string) ([]FilterRule, error) {
 	return rules, nil
 }
 
-func filterProgrammesByDateRange(programmes []Programme, targetDate time.Time, loc *time.Location) []Programme {
+// sourcePin is a trailing `@provider` on the name side of a filter.txt rule.
+var sourcePin = regexp.MustCompile(`\s+@([A-Za-z0-9_-]+)$`)
+
+// cutSourcePin splits "Star Plus @tata" into the channel name and the
+// provider it is pinned to.
+func cutSourcePin(name string) (string, string) {
+	match := sourcePin.FindStringSubmatchIndex(name)
+	if match == nil {
+		return name, ""
+	}
+	return name[:match[0]], name[match[2]:match[3]]
+}
+
+// selectFilterRules keeps the rules named in only (all rules when empty) and
+// drops those named in skip. Names are compared against both sides of a rule
+// after normalization, so "Sony SAB" and "sony-sab.json" are equivalent.
+func selectFilterRules(rules []FilterRule, only, skip string) []FilterRule {
+	onlySet := normalizedNameSet(only)
+	skipSet := normalizedNameSet(skip)
+
+	selected := make([]FilterRule, 0)
+	for _, rule := range rules {
+		original := normalizeChannelName(rule.OriginalName)
+		output := normalizeChannelName(rule.OutputName)
+		if len(onlySet) > 0 && !onlySet[original] && !onlySet[output] {
+			continue
+		}
+		if skipSet[original] || skipSet[output] {
+			continue
+		}
+		selected = append(selected, rule)
+	}
+	return selected
+}
+
+func normalizedNameSet(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			set[normalizeChannelName(name)] = true
+		}
+	}
+	return set
+}
+
+// --overlap-policy values: which day's schedule lists a programme that
+// spans midnight.
+const (
+	// overlapPolicyBoth lists it on both days (the historical behaviour).
+	overlapPolicyBoth = "both"
+	// overlapPolicyStartDay lists it on the day it starts.
+	overlapPolicyStartDay = "start-day"
+	// overlapPolicyEndDay lists it on the day it ends; a programme ending
+	// exactly at midnight belongs to the day before.
+	overlapPolicyEndDay = "end-day"
+)
+
+// filterProgrammesByDateRange returns the programmes that belong to the day
+// starting at targetDate under policy, sorted by start time.
+func filterProgrammesByDateRange(programmes []Programme, targetDate time.Time, loc *time.Location, policy string) []Programme {
 	result := make([]Programme, 0)
 	startOfDay := targetDate
-	endOfDay := targetDate.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	nextDay := targetDate.AddDate(0, 0, 1)
+	endOfDay := nextDay.Add(-time.Nanosecond)
 
 	for _, prog := range programmes {
 		startTime, err := parseEPGTime(prog.Start, loc)
@@ -381,9 +1769,18 @@ func filterProgrammesByDateRange(programmes []Programme, targetDate time.Time, l
 			continue
 		}
 
-		// Programme overlaps with target day if:
-		// - It starts before end of day AND ends after start of day
-		if startTime.Before(endOfDay) && endTime.After(startOfDay) {
+		var belongs bool
+		switch policy {
+		case overlapPolicyStartDay:
+			belongs = !startTime.Before(startOfDay) && startTime.Before(nextDay)
+		case overlapPolicyEndDay:
+			belongs = endTime.After(startOfDay) && !endTime.After(nextDay)
+		default:
+			// Programme overlaps with target day if:
+			// - It starts before end of day AND ends after start of day
+			belongs = startTime.Before(endOfDay) && endTime.After(startOfDay)
+		}
+		if belongs {
 			result = append(result, prog)
 		}
 	}
@@ -398,33 +1795,106 @@ func filterProgrammesByDateRange(programmes []Programme, targetDate time.Time, l
 	return result
 }
 
+// Feed timestamps outside these years are treated as garbage.
+const (
+	minEPGYear = 1970
+	maxEPGYear = 2100
+)
+
 func parseEPGTime(timeStr string, loc *time.Location) (time.Time, error) {
-	// Format: "20251102183000 +0000" or "20251102183000"
-	parts := strings.Fields(timeStr)
-	if len(parts) == 0 {
-		return time.Time{}, fmt.Errorf("invalid time format")
+	t, err := epgTimes.parse(timeStr)
+	if err != nil {
+		return time.Time{}, err
 	}
+	// Convert to the target timezone (IST)
+	return t.In(loc), nil
+}
 
-	// Parse the timestamp part (first 14 characters: YYYYMMDDHHmmss)
-	timestamp := parts[0]
-	if len(timestamp) < 14 {
-		return time.Time{}, fmt.Errorf("timestamp too short")
+// parseEPGInstant parses an XMLTV timestamp into UTC.
+func parseEPGInstant(timeStr string) (time.Time, error) {
+	// Format: "20251102183000 +0000", "20251102183000+0000" or
+	// "20251102183000"; XMLTV also allows dropping the seconds
+	timestamp, offset := splitEPGTime(timeStr)
+	var layout string
+	switch len(timestamp) {
+	case 14:
+		layout = "20060102150405"
+	case 12:
+		layout = "200601021504"
+	default:
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", timeStr)
 	}
-
-	t, err := time.Parse("20060102150405", timestamp)
+	t, err := time.Parse(layout, timestamp)
 	if err != nil {
 		return time.Time{}, err
 	}
+	if t.Year() < minEPGYear || t.Year() > maxEPGYear {
+		return time.Time{}, fmt.Errorf("timestamp %q out of range", timeStr)
+	}
+
+	// Apply the UTC offset ("+0000", "+0530", "-0330"); without one the
+	// timestamp is UTC
+	if offset != "" {
+		d, err := parseUTCOffset(offset)
+		if err != nil {
+			return time.Time{}, err
+		}
+		t = t.Add(-d)
+	}
+	return t, nil
+}
+
+// parseUTCOffset parses an XMLTV offset such as "+0530" or "+05:30".
+func parseUTCOffset(offset string) (time.Duration, error) {
+	value := strings.ReplaceAll(offset, ":", "")
+	if len(value) != 5 || (value[0] != '+' && value[0] != '-') || strings.Trim(value[1:], "0123456789") != "" {
+		return 0, fmt.Errorf("invalid UTC offset %q", offset)
+	}
+	hours, errHours := strconv.Atoi(value[1:3])
+	minutes, errMinutes := strconv.Atoi(value[3:5])
+	if errHours != nil || errMinutes != nil || hours > 14 || minutes > 59 {
+		return 0, fmt.Errorf("invalid UTC offset %q", offset)
+	}
 
-	// Convert from UTC to IST
-	return t.UTC().In(loc), nil
+	d := time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
+	if value[0] == '-' {
+		d = -d
+	}
+	return d, nil
+}
+
+// offsetLabel returns the offset part of an XMLTV timestamp, or "none".
+func offsetLabel(timeStr string) string {
+	if _, offset := splitEPGTime(timeStr); offset != "" {
+		return offset
+	}
+	return "none"
+}
+
+// splitEPGTime separates the digits of an XMLTV time from its UTC offset,
+// which may follow after a space or directly.
+func splitEPGTime(timeStr string) (string, string) {
+	parts := strings.Fields(timeStr)
+	if len(parts) == 0 {
+		return "", ""
+	}
+	timestamp := parts[0]
+	digits := 0
+	for digits < len(timestamp) && timestamp[digits] >= '0' && timestamp[digits] <= '9' {
+		digits++
+	}
+	offset := timestamp[digits:]
+	if offset == "" && len(parts) > 1 {
+		offset = parts[1]
+	}
+	return timestamp[:digits], offset
 }
 
 func formatTime12Hour(t time.Time) string {
 	hour := t.Hour()
 	minute := t.Minute()
 	period := "AM"
-	
+
 	if hour >= 12 {
 		period = "PM"
 		if hour > 12 {
@@ -434,10 +1904,27 @@ func formatTime12Hour(t time.Time) string {
 	if hour == 0 {
 		hour = 12
 	}
-	
+
 	return fmt.Sprintf("%02d:%02d %s", hour, minute, period)
 }
 
+// --channel-names values.
+const (
+	channelNamesProvider = "provider"
+	channelNamesFilter   = "filter"
+)
+
+// ruleChannelName returns the name a rule publishes under when it is written
+// as a name ("Star Plus HD = Star Plus", or just "Star Plus"). Rules written
+// as file names ("star-plus.json") have no name of their own.
+func ruleChannelName(rule FilterRule) (string, bool) {
+	name := strings.TrimSpace(rule.OutputName)
+	if name == "" || strings.HasSuffix(strings.ToLower(name), ".json") {
+		return "", false
+	}
+	return name, true
+}
+
 func formatFilename(name string) string {
 	filename := strings.ToLower(name)
 	filename = strings.ReplaceAll(filename, " ", "-")
@@ -447,19 +1934,25 @@ func formatFilename(name string) string {
 	return filename
 }
 
-func saveChannelJSON(channel *Channel, programmes []Programme, date time.Time, outputName string, dir string, loc *time.Location) error {
-	if len(programmes) == 0 {
-		return nil
-	}
-
+// saveChannelJSON writes one day of a channel's schedule. Without
+// programmes it writes a no_data placeholder.
+func saveChannelJSON(out OutputFS, channel *Channel, identity ChannelIdentity, programmes []Programme, date time.Time, dir string, loc *time.Location, history *AiringHistory, catchup time.Duration, maxProgrammes int, opts *GenerateOptions) error {
 	// Prepare JSON structure
 	channelJSON := ChannelJSON{
+		ChannelID:   identity.ID,
 		ChannelName: channel.DisplayName,
 		ChannelLogo: channel.Icon.Src,
 		Date:        date.Format("2006-01-02"),
+		NoData:      len(programmes) == 0,
+		StaleSince:  staleSince(identity.Providers, opts.staleFeeds),
+		ProviderIDs: identity.Providers,
 		Programs:    make([]ProgramJSON, 0),
 	}
+	if loc.String() != opts.runLoc.String() {
+		channelJSON.Timezone = loc.String()
+	}
 
+	slug, now := strings.TrimSuffix(identity.File, ".json"), time.Now()
 	for _, prog := range programmes {
 		startTime, err := parseEPGTime(prog.Start, loc)
 		if err != nil {
@@ -474,57 +1967,147 @@ func saveChannelJSON(channel *Channel, programmes []Programme, date time.Time, o
 			ShowName:  prog.Title,
 			StartTime: formatTime12Hour(startTime),
 			EndTime:   formatTime12Hour(endTime),
-			ShowLogo:  prog.Icon.Src,
+			ShowLogo:  prog.logo(),
+			IsNew:     history.IsNew(slug, prog, startTime),
+		}
+		programJSON.CatchupAvailable = catchupAvailable(startTime, endTime, now, catchup)
+		if opts.Descriptions {
+			programJSON.Description = strings.TrimSpace(prog.Desc)
+		}
+		programJSON.Credits = prog.credits(opts.CreditLimit)
+		if opts.Artwork {
+			programJSON.Artwork = prog.artwork()
+		}
+		if opts.ExternalIDs {
+			programJSON.URL, programJSON.ExternalIDs = prog.url(), prog.externalIDs()
+		}
+		if opts.Kinds {
+			programJSON.Kind, programJSON.KindConfidence = classifyProgramme(prog, startTime, endTime)
+		}
+		if opts.Recurrence {
+			programJSON.Recurrence = opts.recurrence.recurrence(slug, prog.Title, date)
+		}
+		if opts.DebugOutput {
+			programJSON.Debug = &ProgramDebug{
+				RawStart:        prog.Start,
+				RawStop:         prog.Stop,
+				Start:           startTime.Format(time.RFC3339),
+				Stop:            endTime.Format(time.RFC3339),
+				Source:          programmeSource(identity.Providers, prog),
+				SourceChannelID: prog.Channel,
+			}
 		}
 		channelJSON.Programs = append(channelJSON.Programs, programJSON)
 	}
 
-	// Generate filename
-	filename := formatFilename(outputName)
-
-	// Write JSON file
-	filePath := filepath.Join(dir, filename)
-	jsonData, err := json.MarshalIndent(channelJSON, "", "  ")
-	if err != nil {
-		return err
+	pages := paginate(channelJSON, maxProgrammes, identity.File)
+	if len(pages) > 1 {
+		logMessage(fmt.Sprintf("   📑 %d programmes split into %d pages of %d", len(channelJSON.Programs), len(pages), maxProgrammes))
 	}
+	for i := range pages {
+		page, file := &pages[i], pageFile(identity.File, pages[i].Page)
+		if opts.DedupeDescriptions {
+			dedupeDescriptions(page)
+		}
+
+		// Encode within the size budget, trimming optional fields if needed
+		jsonData, trimmed, fits, err := marshalWithinBudget(page, opts.maxFileBytes)
+		if err != nil {
+			return err
+		}
+		if len(trimmed) > 0 {
+			logMessage(fmt.Sprintf("   ✂️  %s/%s over %s budget: %s (now %s)", dir, file, formatByteSize(opts.maxFileBytes), strings.Join(trimmed, ", "), formatByteSize(len(jsonData))))
+		}
+		if !fits {
+			warn(warnOverBudget, identity.Name, fmt.Sprintf("   ⚠️  %s/%s is still %s after trimming", dir, file, formatByteSize(len(jsonData))))
+		}
 
-	return os.WriteFile(filePath, jsonData, 0644)
+		// Write JSON file
+		if err := out.WriteFile(path.Join(dir, file), jsonData); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// logName is the base name of the log files; profile runs give each profile
+// its own, and dry runs, which write no log files, none.
+var logName = "epg-parser"
+
 func saveLog() {
-	logFile := "epg-parser.log"
-	err := os.WriteFile(logFile, []byte(logBuffer.String()), 0644)
+	if logName == "" {
+		return
+	}
+	logFile := logName + ".log"
+	os.MkdirAll(filepath.Dir(logFile), 0755)
+	err := os.WriteFile(logFile, []byte(loggedText()), 0644)
 	if err != nil {
 		fmt.Printf("❌ Error saving log: %v\n", err)
 	}
 }
 
 func saveDetailedLog() {
+	if logName == "" {
+		return
+	}
 	var detailedLog strings.Builder
-	
+
 	detailedLog.WriteString("=" + strings.Repeat("=", 80) + "\n")
 	detailedLog.WriteString("EPG PARSER - DETAILED EXECUTION LOG\n")
 	detailedLog.WriteString("=" + strings.Repeat("=", 80) + "\n\n")
 	detailedLog.WriteString(fmt.Sprintf("Execution Time: %s\n\n", time.Now().Format("2006-01-02 15:04:05 MST")))
-	
+
 	detailedLog.WriteString("CHANNEL PROCESSING DETAILS:\n")
 	detailedLog.WriteString(strings.Repeat("-", 80) + "\n")
-	detailedLog.WriteString(fmt.Sprintf("%-5s %-30s %-10s %-10s %-15s\n", "No.", "Channel", "Today", "Tomorrow", "Status"))
+	detailedLog.WriteString(fmt.Sprintf("%-5s %-30s %-10s %-10s %-15s %-12s %s\n", "No.", "Channel", "Today", "Tomorrow", "Status", "Source", "Strategy"))
 	detailedLog.WriteString(strings.Repeat("-", 80) + "\n")
-	
+
 	for i, entry := range logEntries {
-		detailedLog.WriteString(fmt.Sprintf("%-5d %-30s %-10d %-10d %-15s\n", 
-			i+1, 
-			truncate(entry.Channel, 30), 
-			entry.TodayPrograms, 
-			entry.TomorrowPrograms, 
-			entry.Status))
-	}
-	
+		detailedLog.WriteString(fmt.Sprintf("%-5d %-30s %-10d %-10d %-15s %-12s %s\n",
+			i+1,
+			truncate(entry.Channel, 30),
+			entry.TodayPrograms,
+			entry.TomorrowPrograms,
+			entry.Status,
+			entry.Source,
+			entry.Strategy))
+	}
+
+	if len(throttleEvents) > 0 {
+		detailedLog.WriteString("\nTHROTTLING EVENTS:\n")
+		detailedLog.WriteString(strings.Repeat("-", 80) + "\n")
+		for _, event := range throttleEvents {
+			outcome := fmt.Sprintf("waited %s", event.Waited)
+			if event.GaveUp {
+				outcome = "gave up"
+			}
+			detailedLog.WriteString(fmt.Sprintf("%s  HTTP %d  Retry-After=%q  %s  %s\n",
+				event.Timestamp, event.Status, event.RetryAfter, outcome, event.URL))
+		}
+	}
+
+	if len(scheduleChanges) > 0 {
+		detailedLog.WriteString("\nSCHEDULE CHANGES SINCE PREVIOUS RUN:\n")
+		detailedLog.WriteString(strings.Repeat("-", 80) + "\n")
+		detailedLog.WriteString(fmt.Sprintf("%-12s %-30s %-8s %s\n", "Date", "Channel", "Slots", "Changed"))
+		for _, change := range scheduleChanges {
+			detailedLog.WriteString(fmt.Sprintf("%-12s %-30s %-8d %.0f%%\n",
+				change.Date, truncate(change.Channel, 30), change.Slots, change.Changed*100))
+		}
+	}
+
+	if len(collapsedProgrammes) > 0 {
+		detailedLog.WriteString("\nCOLLAPSED DUPLICATES (MERGE):\n")
+		detailedLog.WriteString(strings.Repeat("-", 80) + "\n")
+		for _, collapsed := range collapsedProgrammes {
+			detailedLog.WriteString(fmt.Sprintf("%s: %s\n   kept    %s\n   dropped %s\n",
+				collapsed.Channel, collapsed.Title, collapsed.Kept, collapsed.Dropped))
+		}
+	}
+
 	detailedLog.WriteString(strings.Repeat("=", 80) + "\n")
-	
-	err := os.WriteFile("epg-parser-detailed.log", []byte(detailedLog.String()), 0644)
+
+	err := os.WriteFile(logName+"-detailed.log", []byte(detailedLog.String()), 0644)
 	if err != nil {
 		fmt.Printf("❌ Error saving detailed log: %v\n", err)
 	}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEPGInstant(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "20251102183000 +0000", want: time.Date(2025, 11, 2, 18, 30, 0, 0, time.UTC)},
+		{in: "20251102183000 +0530", want: time.Date(2025, 11, 2, 13, 0, 0, 0, time.UTC)},
+		{in: "20251102183000+0530", want: time.Date(2025, 11, 2, 13, 0, 0, 0, time.UTC)},
+		{in: "20251102183000 +05:30", want: time.Date(2025, 11, 2, 13, 0, 0, 0, time.UTC)},
+		{in: "20251102183000 -0330", want: time.Date(2025, 11, 2, 22, 0, 0, 0, time.UTC)},
+		{in: "20251102183000 +1400", want: time.Date(2025, 11, 2, 4, 30, 0, 0, time.UTC)},
+		// Offsets can move the instant across midnight and the year
+		{in: "20251102023000 +0530", want: time.Date(2025, 11, 1, 21, 0, 0, 0, time.UTC)},
+		{in: "20251231220000 -0500", want: time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)},
+		// No offset means UTC; XMLTV allows dropping the seconds
+		{in: "20251102183000", want: time.Date(2025, 11, 2, 18, 30, 0, 0, time.UTC)},
+		{in: "202511021830 +0530", want: time.Date(2025, 11, 2, 13, 0, 0, 0, time.UTC)},
+		{in: "  20251102183000   +0000  ", want: time.Date(2025, 11, 2, 18, 30, 0, 0, time.UTC)},
+
+		{in: "", wantErr: true},
+		{in: "garbage", wantErr: true},
+		{in: "2025110218", wantErr: true},
+		{in: "20251302183000 +0000", wantErr: true},
+		{in: "20251102183000 +2400", wantErr: true},
+		{in: "20251102183000 +0560", wantErr: true},
+		{in: "20251102183000 +05", wantErr: true},
+		{in: "20251102183000 IST", wantErr: true},
+		{in: "18991231235959 +0000", wantErr: true},
+		{in: "21010101000000 +0000", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseEPGInstant(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseEPGInstant(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseEPGInstant(%q): %v", tt.in, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseEPGInstant(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseEPGTimeDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zone database: %v", err)
+	}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		// 2026-03-08: clocks go from 02:00 EST to 03:00 EDT
+		{in: "20260308065900 +0000", want: "2026-03-08 01:59 EST"},
+		{in: "20260308070000 +0000", want: "2026-03-08 03:00 EDT"},
+		// 2026-11-01: 01:00-02:00 happens twice
+		{in: "20261101053000 +0000", want: "2026-11-01 01:30 EDT"},
+		{in: "20261101063000 +0000", want: "2026-11-01 01:30 EST"},
+		{in: "20261101013000 -0500", want: "2026-11-01 01:30 EST"},
+	}
+	for _, tt := range tests {
+		got, err := parseEPGTime(tt.in, newYork)
+		if err != nil {
+			t.Errorf("parseEPGTime(%q): %v", tt.in, err)
+			continue
+		}
+		if s := got.Format("2006-01-02 15:04 MST"); s != tt.want {
+			t.Errorf("parseEPGTime(%q) = %s, want %s", tt.in, s, tt.want)
+		}
+	}
+}
+
+func TestFilterProgrammesByDateRange(t *testing.T) {
+	ist := time.FixedZone("IST", 5*3600+1800)
+	day := time.Date(2025, 11, 2, 0, 0, 0, 0, ist)
+	programmes := []Programme{
+		{Title: "Late Show", Start: "20251101233000 +0530", Stop: "20251102003000 +0530"},
+		{Title: "Morning", Start: "20251102060000 +0530", Stop: "20251102070000 +0530"},
+		// Ends exactly at midnight
+		{Title: "Prime", Start: "20251102230000 +0530", Stop: "20251103000000 +0530"},
+		{Title: "Night", Start: "20251102233000 +0530", Stop: "20251103010000 +0530"},
+		// The same instant written in UTC
+		{Title: "Noon UTC", Start: "20251102063000 +0000", Stop: "20251102073000 +0000"},
+		{Title: "Tomorrow", Start: "20251103060000 +0530", Stop: "20251103070000 +0530"},
+		{Title: "No Stop", Start: "20251102080000 +0530"},
+	}
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{policy: overlapPolicyBoth, want: []string{"Late Show", "Morning", "Noon UTC", "Prime", "Night"}},
+		{policy: overlapPolicyStartDay, want: []string{"Morning", "Noon UTC", "Prime", "Night"}},
+		{policy: overlapPolicyEndDay, want: []string{"Late Show", "Morning", "Noon UTC", "Prime"}},
+	}
+	for _, tt := range tests {
+		got := filterProgrammesByDateRange(programmes, day, ist, tt.policy)
+		if titles := programmeTitles(got); !equalStrings(titles, tt.want) {
+			t.Errorf("policy %s: got %v, want %v", tt.policy, titles, tt.want)
+		}
+	}
+}
+
+func TestFilterProgrammesByDateRangeDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zone database: %v", err)
+	}
+	// 2026-03-08 is 23 hours long in New York
+	day := time.Date(2026, 3, 8, 0, 0, 0, 0, newYork)
+	programmes := []Programme{
+		{Title: "First", Start: "20260308053000 +0000", Stop: "20260308063000 +0000"},
+		{Title: "Last", Start: "20260309033000 +0000", Stop: "20260309040000 +0000"},
+		{Title: "Next Day", Start: "20260309043000 +0000", Stop: "20260309050000 +0000"},
+	}
+	got := filterProgrammesByDateRange(programmes, day, newYork, overlapPolicyStartDay)
+	if titles, want := programmeTitles(got), []string{"First", "Last"}; !equalStrings(titles, want) {
+		t.Errorf("got %v, want %v", titles, want)
+	}
+}
+
+// FuzzParseEPGInstant checks that no timestamp panics the parser, and that
+// whatever it accepts reads back the same written again at its own offset.
+func FuzzParseEPGInstant(f *testing.F) {
+	for _, seed := range []string{
+		"20251102183000 +0000", "20251102183000+0530", "202511021830 -0330",
+		"20251102183000 +05:30", "20251102183000", "19700101000000 +0530",
+		"21001231235959 -1400", "", " ", "+0530", "2025110218300 +0000",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		got, err := parseEPGInstant(in)
+		if err != nil {
+			return
+		}
+		if cached, err := parseEPGTime(in, time.UTC); err != nil || !cached.Equal(got) {
+			t.Fatalf("parseEPGTime(%q) = %v, %v; parseEPGInstant gave %v", in, cached, err, got)
+		}
+		_, offset := splitEPGTime(in)
+		if offset == "" {
+			offset = "+0000"
+		}
+		d, err := parseUTCOffset(offset)
+		if err != nil {
+			t.Fatalf("%q parsed with offset %q: %v", in, offset, err)
+		}
+		again := got.In(time.FixedZone("", int(d.Seconds()))).Format("20060102150405 -0700")
+		back, err := parseEPGInstant(again)
+		if err != nil {
+			t.Fatalf("%q parsed as %v, but %q does not: %v", in, got, again, err)
+		}
+		if !back.Equal(got) {
+			t.Fatalf("%q parsed as %v, but %q as %v", in, got, again, back)
+		}
+	})
+}
+
+func programmeTitles(programmes []Programme) []string {
+	titles := make([]string, 0, len(programmes))
+	for _, prog := range programmes {
+		titles = append(titles, prog.Title)
+	}
+	return titles
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
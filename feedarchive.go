@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archivedFeed is one feed a run used, for the feed archive.
+type archivedFeed struct {
+	Provider Provider
+	TV       *TV
+}
+
+// feedArchiveDay is the folder of day's feeds in the feed archive.
+func feedArchiveDay(archive string, day time.Time) string {
+	return filepath.Join(archive, day.Format("2006-01-02"))
+}
+
+// saveFeedArchive saves the feeds a run used under archive/DATE, in the
+// layout `epg fetch` writes, so `--date DATE --from-archive` can rebuild
+// that day's outputs later. The last run of a day replaces its earlier
+// runs' feeds. Days more than keepDays before today are removed.
+func saveFeedArchive(archive string, today time.Time, feeds []archivedFeed, keepDays int) error {
+	dir := feedArchiveDay(archive, today)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	index := make([]fetchedFeed, 0, len(feeds))
+	for _, feed := range feeds {
+		body, err := encodeEPG(feed.TV)
+		if err != nil {
+			return fmt.Errorf("%s: %v", feed.Provider.Name, err)
+		}
+		sum := sha256.Sum256(body)
+		entry := fetchedFeed{
+			Name:      feed.Provider.Name,
+			URL:       feed.Provider.URL,
+			File:      strings.ToLower(feed.Provider.Name) + ".xml.gz",
+			SHA256:    hex.EncodeToString(sum[:]),
+			FetchedAt: time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := writeFileAtomic(filepath.Join(dir, entry.File), body); err != nil {
+			return err
+		}
+		index = append(index, entry)
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, fetchedFeedsIndex), append(data, '\n')); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(archive)
+	if err != nil {
+		return err
+	}
+	cutoff := today.AddDate(0, 0, -keepDays).Format("2006-01-02")
+	for _, entry := range entries {
+		if _, err := time.Parse("2006-01-02", entry.Name()); err == nil && entry.IsDir() && entry.Name() < cutoff {
+			os.RemoveAll(filepath.Join(archive, entry.Name()))
+		}
+	}
+	return nil
+}
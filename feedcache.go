@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// feedCache keeps the last parsed copy of each feed together with its
+// validators, so repeated runs in one process can make conditional requests
+// and skip re-parsing feeds that have not changed upstream.
+type feedCache struct {
+	mu    sync.Mutex
+	feeds map[string]*cachedFeed
+	// pinned caches hand out a feed already downloaded without asking the
+	// server again, so the runs of one execution all see the same data.
+	pinned bool
+}
+
+type cachedFeed struct {
+	ETag         string
+	LastModified string
+	TV           *TV
+}
+
+func newFeedCache() *feedCache {
+	return &feedCache{feeds: make(map[string]*cachedFeed)}
+}
+
+// fetchProvider fetches provider's feed: through fetch for an XMLTV feed,
+// and otherwise through its Source, unless a pinned cache already holds it.
+func (c *feedCache) fetchProvider(provider Provider) (*TV, error) {
+	if provider.isXMLTV() {
+		return c.fetch(provider.URL)
+	}
+	if c != nil && c.pinned {
+		c.mu.Lock()
+		cached := c.feeds[provider.URL]
+		c.mu.Unlock()
+		if cached != nil {
+			logMessage("   ♻️  Reusing feed downloaded earlier")
+			return cached.TV, nil
+		}
+	}
+	return fetchSource(provider)
+}
+
+// fetch returns the feed at url, reusing the cached copy when the server
+// answers 304 Not Modified. A nil cache always downloads in full.
+func (c *feedCache) fetch(url string) (*TV, error) {
+	if c == nil {
+		return downloadAndParseEPG(url)
+	}
+
+	c.mu.Lock()
+	cached := c.feeds[url]
+	c.mu.Unlock()
+	if cached != nil && c.pinned {
+		logMessage("   ♻️  Reusing feed downloaded earlier")
+		return cached.TV, nil
+	}
+
+	header := make(http.Header)
+	if cached != nil {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := httpGet(url, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		if cached == nil {
+			return nil, fmt.Errorf("unexpected 304 Not Modified without a cached copy")
+		}
+		logMessage("   ♻️  Not modified upstream, reusing cached feed")
+		return cached.TV, nil
+	}
+
+	body, err := readFeedBody(url, resp)
+	if err != nil {
+		return nil, err
+	}
+	tv, err := decodeEPGWithin(url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.feeds[url] = &cachedFeed{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		TV:           tv,
+	}
+	c.mu.Unlock()
+	return tv, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// feedDiskCache keeps the last downloaded copy of each feed on disk with its
+// validators, for --feed-cache. Every run is a new process, so this is what
+// lets a run ask for a feed conditionally and, when the server answers 304
+// Not Modified, read it from disk instead of downloading tens of megabytes
+// again. The copy is also what a run falls back to when the feed cannot be
+// downloaded. The zero value caches nothing.
+type feedDiskCache struct {
+	dir string
+}
+
+// paths returns where url's body and validators are kept, named by a hash
+// of the URL.
+func (c feedDiskCache) paths(url string) (body, meta string) {
+	sum := sha256.Sum256([]byte(url))
+	name := filepath.Join(c.dir, hex.EncodeToString(sum[:])[:16])
+	return name + ".feed", name + ".json"
+}
+
+// partialPaths returns where an unfinished download of url is kept between
+// runs, and the If-Range validator it was started under.
+func (c feedDiskCache) partialPaths(url string) (body, validator string) {
+	feed, _ := c.paths(url)
+	name := strings.TrimSuffix(feed, ".feed")
+	return name + ".partial", name + ".partial.validator"
+}
+
+// resume asks for the rest of a download of url that an earlier run gave up
+// on or was stopped in, with a Range request naming the copy it started.
+// The response is 206 Partial Content continuing the partial file, or 200
+// when the feed has changed since; either is for readBody. It reports false,
+// leaving the feed to be requested as usual, when there is nothing to resume
+// or the server cannot continue it.
+func (c feedDiskCache) resume(url string) (*http.Response, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+	body, meta := c.partialPaths(url)
+	info, errStat := os.Stat(body)
+	validator, errRead := os.ReadFile(meta)
+	if errStat != nil || errRead != nil || info.Size() == 0 || len(validator) == 0 {
+		return nil, false
+	}
+	header := make(http.Header)
+	header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+	header.Set("If-Range", string(validator))
+	resp, err := httpGet(url, header)
+	if err != nil {
+		logMessage(fmt.Sprintf("   ⚠️  Could not resume %s: %v", url, err))
+		return nil, false
+	}
+	if resp.StatusCode == http.StatusOK {
+		logMessage("   ♻️  Feed changed since an earlier run's download broke off, downloading it again")
+		return resp, true
+	}
+	if resp.StatusCode != http.StatusPartialContent || contentRangeStart(resp.Header.Get("Content-Range")) != info.Size() {
+		resp.Body.Close()
+		os.Remove(body)
+		os.Remove(meta)
+		return nil, false
+	}
+	logMessage(fmt.Sprintf("   ⏯️  Resuming the download an earlier run broke off at %d bytes", info.Size()))
+	return resp, true
+}
+
+// readBody reads the body of resp for url like readFeedBody, but through a
+// partial file in the cache, so that a download given up on, or stopped with
+// the process, is picked up by the next run's resume. resp is 200, or a 206
+// from resume continuing the partial file. Feeds without a validator cannot
+// be resumed safely and go through a temp file as usual.
+func (c feedDiskCache) readBody(url string, resp *http.Response) ([]byte, error) {
+	validator := rangeValidator(resp.Header)
+	if c.dir == "" || validator == "" {
+		return readFeedBody(url, resp)
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	body, meta := c.partialPaths(url)
+	partial, err := os.OpenFile(body, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	defer partial.Close()
+	var written int64
+	if resp.StatusCode == http.StatusPartialContent {
+		written = contentRangeStart(resp.Header.Get("Content-Range"))
+	} else if err := partial.Truncate(0); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if err := os.WriteFile(meta, []byte(validator), 0644); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	data, validator, err := finishFeedBody(url, resp, partial, written, validator)
+	if err != nil {
+		if info, statErr := partial.Stat(); statErr == nil && info.Size() > 0 && validator != "" {
+			os.WriteFile(meta, []byte(validator), 0644)
+			logMessage(fmt.Sprintf("   💾 Kept %d bytes of %s for the next run to resume", info.Size(), url))
+		}
+		return nil, err
+	}
+	os.Remove(body)
+	os.Remove(meta)
+	if err := verifyFeed(url, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// load returns the validators of url's cached copy, if the copy is there.
+func (c feedDiskCache) load(url string) (FeedValidators, bool) {
+	var validators FeedValidators
+	if c.dir == "" {
+		return validators, false
+	}
+	body, meta := c.paths(url)
+	data, err := os.ReadFile(meta)
+	if err != nil || json.Unmarshal(data, &validators) != nil {
+		return validators, false
+	}
+	if _, err := os.Stat(body); err != nil {
+		return validators, false
+	}
+	return validators, validators.ETag != "" || validators.LastModified != ""
+}
+
+// read returns url's cached body, marking the copy used so that pruning
+// keeps it.
+func (c feedDiskCache) read(url string) ([]byte, error) {
+	body, meta := c.paths(url)
+	now := time.Now()
+	os.Chtimes(meta, now, now)
+	return os.ReadFile(body)
+}
+
+// save replaces url's cached copy. The body is written first, each file
+// through its own temp file renamed into place, so a run stopped part-way
+// leaves the previous copy intact and runs sharing the cache do not write
+// into each other's temp files.
+// Feeds the server gives no validators for are kept too: they are never
+// requested conditionally, but can stand in when a download fails.
+func (c feedDiskCache) save(url string, data []byte, validators FeedValidators) error {
+	if c.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	body, meta := c.paths(url)
+	encoded, err := json.MarshalIndent(struct {
+		URL string `json:"url"`
+		FeedValidators
+	}{url, validators}, "", "  ")
+	if err != nil {
+		return err
+	}
+	for _, file := range []struct {
+		path string
+		data []byte
+	}{{body, data}, {meta, encoded}} {
+		if err := writeFileAtomic(file.path, file.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The stages of getting a feed that a feedError names.
+const (
+	stageRequest    = "request"
+	stageDownload   = "download"
+	stageVerify     = "verify"
+	stageDecompress = "decompress"
+	stageParse      = "parse"
+)
+
+// feedError is a feed failure with where it happened, so that "gzip: invalid
+// header" says which feed failed, how far in, and whether a proxy stood in
+// between. The source's label is added by sourceError. Offset is the byte
+// the stage had reached, -1 when unknown: of the body as served for request,
+// download and verify, of the compressed body for decompress and of the XML
+// document for parse. URL is empty for a feed read from a file.
+type feedError struct {
+	URL    string
+	Stage  string
+	Offset int64
+	Proxy  string
+	Err    error
+}
+
+func (e *feedError) Error() string {
+	var message strings.Builder
+	if e.URL != "" {
+		message.WriteString(e.URL)
+		if e.Proxy != "" {
+			message.WriteString(" via proxy " + e.Proxy)
+		}
+		message.WriteString(": ")
+	}
+	message.WriteString(e.Stage + " failed")
+	if e.Offset >= 0 {
+		fmt.Fprintf(&message, " at byte %d", e.Offset)
+	}
+	return message.String() + ": " + e.Err.Error()
+}
+
+func (e *feedError) Unwrap() error { return e.Err }
+
+// feedFailure wraps err from stage of getting url in a feedError, noting the
+// proxy a request or download went through. An error that already is one
+// is returned as it is.
+func feedFailure(url, stage string, offset int64, err error) error {
+	if failure, placed := err.(*feedError); placed {
+		return failure
+	}
+	failure := &feedError{URL: url, Stage: stage, Offset: offset, Err: err}
+	if stage == stageRequest || stage == stageDownload {
+		failure.Proxy = proxyName(url)
+	}
+	return failure
+}
+
+// proxyName returns the proxy feed requests for url go through, without
+// its password, or "" when they go direct.
+func proxyName(url string) string {
+	if _, local := localFeedPath(url); local {
+		return ""
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return ""
+	}
+	proxy, err := feedProxyFor(req)
+	if err != nil || proxy == nil {
+		return ""
+	}
+	return proxy.Redacted()
+}
+
+// countingReader counts the bytes read through it and keeps the first error
+// other than io.EOF that its reader returned, so decodeEPG can tell a
+// broken gzip stream from broken XML.
+type countingReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if err != nil && err != io.EOF && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
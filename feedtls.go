@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// feedTLS are the TLS settings of the feed URLs that need their own: a CA
+// of their own to trust, or no verification at all. httpGet requests them
+// through a copy of feedClient's transport with these settings. The
+// providers a run loads register theirs.
+var feedTLS = make(map[string]*tls.Config)
+
+// tlsClients are the copies of feedClient made for feedTLS, kept while
+// feedClient stays the same, so their connections are reused.
+var tlsClients = struct {
+	mu      sync.Mutex
+	base    *http.Client
+	clients map[string]*http.Client
+}{}
+
+// loadCAPool returns the system's trusted CAs plus those in the PEM files,
+// for TLS that a corporate proxy re-signs or a mirror signs with its own CA.
+func loadCAPool(files ...string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s holds no PEM certificates", file)
+		}
+	}
+	return pool, nil
+}
+
+// registerFeedTLS makes httpGet use each provider's CA certificate and skip
+// verification where it says to, besides trusting the caCert of --ca-cert.
+func registerFeedTLS(providers []Provider, caCert string) error {
+	configs := make(map[string]*tls.Config)
+	for _, p := range providers {
+		if p.CACert == "" && !p.InsecureSkipVerify {
+			continue
+		}
+		pool, err := loadCAPool(caCert, p.CACert)
+		if err != nil {
+			return fmt.Errorf("%s: ca_cert: %v", p.Name, err)
+		}
+		if p.InsecureSkipVerify {
+			logMessage(fmt.Sprintf("⚠️  Not verifying the TLS certificate of %s: anyone on the way can change its feed", p.Label))
+		}
+		configs[p.URL] = &tls.Config{RootCAs: pool, InsecureSkipVerify: p.InsecureSkipVerify}
+	}
+	feedTLS = configs
+	return nil
+}
+
+// markInsecure sets InsecureSkipVerify on the providers named in list, the
+// comma-separated names of --insecure-skip-verify. Naming a provider that
+// is not enabled is an error, as for --providers.
+func markInsecure(providers []Provider, list string) error {
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		found := false
+		for i := range providers {
+			if strings.EqualFold(providers[i].Name, name) {
+				providers[i].InsecureSkipVerify, found = true, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("--insecure-skip-verify: unknown provider %q", name)
+		}
+	}
+	return nil
+}
+
+// feedClientFor returns the client for url's requests: feedClient, or a
+// copy of it with url's TLS settings. Under --chaos, whose transport cannot
+// be copied, the settings are not applied.
+func feedClientFor(url string) *http.Client {
+	config, found := feedTLS[url]
+	if !found {
+		return feedClient
+	}
+	tlsClients.mu.Lock()
+	defer tlsClients.mu.Unlock()
+	if tlsClients.base != feedClient {
+		tlsClients.base, tlsClients.clients = feedClient, make(map[string]*http.Client)
+	}
+	if client, found := tlsClients.clients[url]; found {
+		return client
+	}
+	base := feedClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	transport, ok := base.(*http.Transport)
+	if !ok {
+		return feedClient
+	}
+	transport = transport.Clone()
+	transport.TLSClientConfig = config
+	client := &http.Client{Transport: transport, Timeout: feedClient.Timeout}
+	tlsClients.clients[url] = client
+	return client
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// programmeFields are the names accepted by ?fields=: the programme fields
+// of the channel files plus start_iso and end_iso, the RFC 3339 instants.
+var programmeFields = []string{"show_name", "start_time", "end_time", "show_logo", "is_new", "description", "credits", "kind", "kind_confidence", "recurrence", "artwork", "catchup_available", "url", "external_ids", "debug", "start_iso", "end_iso"}
+
+// projectedSchedule is a ChannelJSON whose programmes carry only the
+// requested fields.
+type projectedSchedule struct {
+	ChannelID   string           `json:"channel_id"`
+	ChannelName string           `json:"channel_name"`
+	ChannelLogo string           `json:"channel_logo"`
+	Date        string           `json:"date"`
+	NoData      bool             `json:"no_data,omitempty"`
+	StaleSince  string           `json:"stale_since,omitempty"`
+	Timezone    string           `json:"timezone,omitempty"`
+	ProviderIDs []ProviderRef    `json:"provider_ids"`
+	Programs    []map[string]any `json:"programs"`
+	// Deprecated and DeprecatedSince are ChannelJSON's, for removed
+	// channels.
+	Deprecated      bool   `json:"deprecated,omitempty"`
+	DeprecatedSince string `json:"deprecated_since,omitempty"`
+}
+
+// requestFields parses ?fields=show_name,start_iso, writing a 400 response
+// for unknown names. It returns nil when every field is wanted.
+func requestFields(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	value := r.URL.Query().Get("fields")
+	if value == "" {
+		return nil, true
+	}
+	fields := make([]string, 0)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !contains(programmeFields, field) {
+			writeError(w, http.StatusBadRequest, "unknown field "+field+": expected "+strings.Join(programmeFields, ", "))
+			return nil, false
+		}
+		fields = append(fields, field)
+	}
+	return fields, true
+}
+
+// projectSchedule keeps only fields in each programme; nil fields returns
+// the schedule as stored.
+func projectSchedule(schedule *ChannelJSON, fields []string, loc *time.Location) any {
+	if fields == nil {
+		return schedule
+	}
+	projected := projectedSchedule{
+		ChannelID:   schedule.ChannelID,
+		ChannelName: schedule.ChannelName,
+		ChannelLogo: schedule.ChannelLogo,
+		Date:        schedule.Date,
+		NoData:      schedule.NoData,
+		StaleSince:  schedule.StaleSince,
+		Timezone:    schedule.Timezone,
+		ProviderIDs: schedule.ProviderIDs,
+		Programs:    make([]map[string]any, 0, len(schedule.Programs)),
+	}
+	projected.Deprecated, projected.DeprecatedSince = schedule.Deprecated, schedule.DeprecatedSince
+	for _, airing := range airings(schedule, loc) {
+		// A deduplicated description is returned inline
+		prog := airing.ProgramJSON
+		prog.Description, prog.DescriptionRef = schedule.description(prog), ""
+		var all map[string]any
+		data, err := json.Marshal(prog)
+		if err != nil || json.Unmarshal(data, &all) != nil {
+			continue
+		}
+		all["start_iso"] = airing.Start.Format(time.RFC3339)
+		all["end_iso"] = airing.End.Format(time.RFC3339)
+
+		programme := make(map[string]any, len(fields))
+		for _, field := range fields {
+			if value, exists := all[field]; exists {
+				programme[field] = value
+			}
+		}
+		projected.Programs = append(projected.Programs, programme)
+	}
+	return projected
+}
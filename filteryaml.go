@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// filterDocument is the schema of filter.yaml, the structured alternative to
+// filter.txt with per-rule options.
+type filterDocument struct {
+	Channels []filterChannel `yaml:"channels"`
+}
+
+type filterChannel struct {
+	// Name is the channel as written in filter.txt: a provider display name,
+	// a file name, or a chno: rule.
+	Name string `yaml:"name"`
+	// Output is the file the channel is published as; Name by default.
+	Output   string   `yaml:"output,omitempty"`
+	Source   string   `yaml:"source,omitempty"`
+	Groups   []string `yaml:"groups,omitempty"`
+	Logo     string   `yaml:"logo,omitempty"`
+	Timezone string   `yaml:"timezone,omitempty"`
+	Order    int      `yaml:"order,omitempty"`
+	Critical bool     `yaml:"critical,omitempty"`
+	// MaxProgrammes paginates the channel's files; see pagination.go.
+	MaxProgrammes int `yaml:"max_programmes,omitempty"`
+}
+
+// isYAMLFilter reports whether filename is a filter.yaml rather than a
+// filter.txt.
+func isYAMLFilter(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// parseFilterYAML reads filter.yaml into rules sorted by order. Rules
+// without an order follow those with one, and ties keep the order of the
+// file. Unknown keys are rejected, so a misspelt option fails loudly instead
+// of being ignored.
+func parseFilterYAML(data []byte) ([]FilterRule, error) {
+	var doc filterDocument
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	rules := make([]FilterRule, 0, len(doc.Channels))
+	for i, channel := range doc.Channels {
+		rule := FilterRule{
+			OriginalName:  strings.TrimSpace(channel.Name),
+			OutputName:    strings.TrimSpace(channel.Output),
+			Source:        strings.TrimSpace(channel.Source),
+			Groups:        channel.Groups,
+			Logo:          strings.TrimSpace(channel.Logo),
+			Timezone:      strings.TrimSpace(channel.Timezone),
+			Order:         channel.Order,
+			Critical:      channel.Critical,
+			MaxProgrammes: channel.MaxProgrammes,
+		}
+		if rule.OriginalName == "" {
+			return nil, fmt.Errorf("channel %d: name is required", i+1)
+		}
+		if rule.Order < 0 {
+			return nil, fmt.Errorf("%s: order must be positive", rule.OriginalName)
+		}
+		if rule.MaxProgrammes < 0 {
+			return nil, fmt.Errorf("%s: max_programmes must be positive", rule.OriginalName)
+		}
+		if rule.OutputName == "" {
+			rule.OutputName = rule.OriginalName
+		}
+		if rule.Logo != "" && !strings.HasPrefix(rule.Logo, "https://") && !strings.HasPrefix(rule.Logo, "http://") {
+			return nil, fmt.Errorf("%s: invalid logo URL %q", rule.OriginalName, rule.Logo)
+		}
+		if rule.Timezone != "" {
+			if _, err := time.LoadLocation(rule.Timezone); err != nil {
+				return nil, fmt.Errorf("%s: %v", rule.OriginalName, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i].Order, rules[j].Order
+		return a != 0 && (b == 0 || a < b)
+	})
+	return rules, nil
+}
+
+// errCriticalChannels fails a run in which a critical rule produced no
+// schedule. The outputs are still written.
+var errCriticalChannels = errors.New("critical channels missing")
+
+// pinnedSources returns the sources a rule may match in: all of them, or
+// only the one it is pinned to.
+func pinnedSources(sources []*EPGSource, pinned string) []*EPGSource {
+	if pinned == "" {
+		return sources
+	}
+	for _, src := range sources {
+		if strings.EqualFold(src.Name, pinned) {
+			return []*EPGSource{src}
+		}
+	}
+	return nil
+}
+
+// filterGroups returns the groups named in filter rules, keyed like
+// groups.txt, with the output slugs of their channels.
+func filterGroups(rules []FilterRule) map[string][]string {
+	groups := make(map[string][]string)
+	for _, rule := range rules {
+		for _, group := range rule.Groups {
+			name := groupKey(group)
+			groups[name] = append(groups[name], strings.TrimSuffix(formatFilename(rule.OutputName), ".json"))
+		}
+	}
+	return groups
+}
+
+// runConvertFilter implements `epg convert-filter`: it rewrites a filter.txt
+// as filter.yaml, keeping every rule and its order.
+func runConvertFilter(args []string) error {
+	fs := flag.NewFlagSet("convert-filter", flag.ContinueOnError)
+	input := fs.String("filter", "filter.txt", "filter.txt to convert")
+	output := fs.String("out", "filter.yaml", "filter.yaml to write; an existing file is not overwritten")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rules, err := loadFilterRules(*input)
+	if err != nil {
+		return fmt.Errorf("loading %s: %v", *input, err)
+	}
+	doc := filterDocument{Channels: make([]filterChannel, 0, len(rules))}
+	for _, rule := range rules {
+		channel := filterChannel{Name: rule.OriginalName, Source: rule.Source}
+		if rule.OutputName != rule.OriginalName {
+			channel.Output = rule.OutputName
+		}
+		doc.Channels = append(doc.Channels, channel)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Converted from " + *input + ". Per-rule options: output, source, groups,\n# logo, timezone, order, critical (see README).\n")
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Wrote %d rules to %s; run with --filter %s\n", len(rules), *output, *output)
+	return nil
+}
+
+// ruleLocation returns the zone of rule's days and times: its own timezone,
+// or runLoc without one. parseFilterYAML checks the zone loads; should it
+// fail to load later all the same, the run's zone is used, with a warning.
+func ruleLocation(rule FilterRule, runLoc *time.Location) *time.Location {
+	if rule.Timezone == "" {
+		return runLoc
+	}
+	loc, err := time.LoadLocation(rule.Timezone)
+	if err != nil {
+		logMessage(fmt.Sprintf("⚠️  %s: timezone %s: %v; using %s", rule.OriginalName, rule.Timezone, err, runLoc))
+		return runLoc
+	}
+	return loc
+}
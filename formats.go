@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// scheduleFormats are the renderings /epg/{channel} offers besides JSON,
+// chosen by the channel's extension: star-plus.ics for calendar apps and
+// star-plus.xml for PVRs.
+var scheduleFormats = map[string]struct {
+	contentType string
+	render      func(w io.Writer, slug string, schedules []*ChannelJSON, loc *time.Location) error
+}{
+	".ics": {"text/calendar; charset=utf-8", renderICS},
+	".xml": {"application/xml; charset=utf-8", renderXMLTV},
+}
+
+// cutScheduleFormat splits "star-plus.ics" into the channel and the
+// extension of a format in scheduleFormats.
+func cutScheduleFormat(channel string) (string, string) {
+	for ext := range scheduleFormats {
+		if name, found := strings.CutSuffix(channel, ext); found {
+			return name, ext
+		}
+	}
+	return channel, ""
+}
+
+// handleScheduleFormat serves a channel's schedule as ICS or XMLTV, rendered
+// from the guide: every day loaded, or the one ?date= names.
+func (s *guideServer) handleScheduleFormat(w http.ResponseWriter, r *http.Request, slug string, days map[string]*ChannelJSON, ext string) {
+	dates := make([]string, 0, len(days))
+	if r.URL.Query().Get("date") != "" {
+		date, ok := s.requestDate(w, r)
+		if !ok {
+			return
+		}
+		if _, exists := days[date]; !exists {
+			writeError(w, http.StatusNotFound, "no schedule for "+date)
+			return
+		}
+		dates = append(dates, date)
+	} else {
+		for date := range days {
+			dates = append(dates, date)
+		}
+		sort.Strings(dates)
+	}
+	schedules := make([]*ChannelJSON, len(dates))
+	for i, date := range dates {
+		schedules[i] = days[date]
+	}
+
+	format := scheduleFormats[ext]
+	var body strings.Builder
+	if err := format.render(&body, slug, schedules, s.loc); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", format.contentType)
+	io.WriteString(w, body.String())
+}
+
+// scheduleAirings resolves the days' programmes into airings with their
+// descriptions inline. A programme running past midnight is in both days'
+// files; it is kept once.
+func scheduleAirings(schedules []*ChannelJSON, loc *time.Location) []Airing {
+	result := make([]Airing, 0)
+	seen := make(map[time.Time]bool)
+	for _, schedule := range schedules {
+		for _, airing := range airings(schedule, loc) {
+			if seen[airing.Start] {
+				continue
+			}
+			seen[airing.Start] = true
+			airing.Description, airing.DescriptionRef = schedule.description(airing.ProgramJSON), ""
+			result = append(result, airing)
+		}
+	}
+	return result
+}
+
+// renderICS writes the schedules as an iCalendar feed with one event per
+// programme, so calendar apps can subscribe to a channel.
+func renderICS(w io.Writer, slug string, schedules []*ChannelJSON, loc *time.Location) error {
+	name := slug
+	if len(schedules) > 0 && schedules[0].ChannelName != "" {
+		name = schedules[0].ChannelName
+	}
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//epg-parser//EPG//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:" + escapeICSText(name),
+	}
+	for _, airing := range scheduleAirings(schedules, loc) {
+		start, end := airing.Start.UTC().Format("20060102T150405Z"), airing.End.UTC().Format("20060102T150405Z")
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+slug+"-"+start+"@epg-parser",
+			"DTSTAMP:"+stamp,
+			"DTSTART:"+start,
+			"DTEND:"+end,
+			"SUMMARY:"+escapeICSText(airing.ShowName),
+		)
+		if airing.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+escapeICSText(airing.Description))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, foldICSLine(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeICSText escapes a TEXT value (RFC 5545 section 3.3.11).
+func escapeICSText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// foldICSLine breaks a content line into 75-octet lines, continued with a
+// leading space, without splitting a UTF-8 character.
+func foldICSLine(line string) string {
+	var folded strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			folded.WriteString("\r\n ")
+			width = 1
+		}
+		folded.WriteRune(r)
+		width += size
+	}
+	return folded.String()
+}
+
+// xmltvDocument is the XMLTV rendering of one channel, with empty elements
+// left out.
+type xmltvDocument struct {
+	XMLName    xml.Name         `xml:"tv"`
+	Generator  string           `xml:"generator-info-name,attr"`
+	Channel    xmltvChannel     `xml:"channel"`
+	Programmes []xmltvProgramme `xml:"programme"`
+}
+
+type xmltvChannel struct {
+	ID          string     `xml:"id,attr"`
+	DisplayName string     `xml:"display-name"`
+	Icon        *xmltvIcon `xml:"icon,omitempty"`
+}
+
+type xmltvIcon struct {
+	Src string `xml:"src,attr"`
+}
+
+type xmltvProgramme struct {
+	Start   string     `xml:"start,attr"`
+	Stop    string     `xml:"stop,attr"`
+	Channel string     `xml:"channel,attr"`
+	Title   string     `xml:"title"`
+	Desc    string     `xml:"desc,omitempty"`
+	Icon    *xmltvIcon `xml:"icon,omitempty"`
+	New     *struct{}  `xml:"new,omitempty"`
+}
+
+// renderXMLTV writes the schedules as an XMLTV document for PVRs, with the
+// channel under its channel_id.
+func renderXMLTV(w io.Writer, slug string, schedules []*ChannelJSON, loc *time.Location) error {
+	doc := xmltvDocument{Generator: "epg-parser", Channel: xmltvChannel{ID: slug, DisplayName: slug}, Programmes: make([]xmltvProgramme, 0)}
+	if len(schedules) > 0 {
+		first := schedules[0]
+		if first.ChannelID != "" {
+			doc.Channel.ID = first.ChannelID
+		}
+		if first.ChannelName != "" {
+			doc.Channel.DisplayName = first.ChannelName
+		}
+		if first.ChannelLogo != "" {
+			doc.Channel.Icon = &xmltvIcon{Src: first.ChannelLogo}
+		}
+	}
+	for _, airing := range scheduleAirings(schedules, loc) {
+		prog := xmltvProgramme{
+			Start:   airing.Start.Format("20060102150405 -0700"),
+			Stop:    airing.End.Format("20060102150405 -0700"),
+			Channel: doc.Channel.ID,
+			Title:   airing.ShowName,
+			Desc:    airing.Description,
+		}
+		if airing.ShowLogo != "" {
+			prog.Icon = &xmltvIcon{Src: airing.ShowLogo}
+		}
+		if airing.IsNew {
+			prog.New = &struct{}{}
+		}
+		doc.Programmes = append(doc.Programmes, prog)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("encoding XMLTV: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
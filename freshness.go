@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// feedDateLayouts are the forms of the XMLTV <tv date="..."> attribute seen
+// in feeds, most specific first.
+var feedDateLayouts = []string{"20060102150405 -0700", "20060102150405", "200601021504", "20060102", time.RFC3339}
+
+// generatedAt returns when the feed says it was generated, from its date
+// attribute. Dates without an offset are read as UTC.
+func (tv *TV) generatedAt() (time.Time, bool) {
+	value := strings.TrimSpace(tv.Date)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// staleFeedError is a feed generated longer ago than --max-feed-age.
+type staleFeedError struct {
+	Generated time.Time
+	Age       time.Duration
+	Limit     time.Duration
+}
+
+func (e *staleFeedError) Error() string {
+	return fmt.Sprintf("feed generated %s ago (%s), over the %s --max-feed-age", e.Age.Round(time.Minute), e.Generated.Format(time.RFC3339), e.Limit)
+}
+
+// checkFreshness compares a feed's generation date with maxAge (0 disables
+// the check). A stale feed is logged; with reject it is also returned as a
+// staleFeedError, failing the source like a download error. Feeds without
+// a readable date cannot be checked and pass.
+func checkFreshness(provider Provider, tv *TV, maxAge time.Duration, reject bool, now time.Time) error {
+	if maxAge <= 0 {
+		return nil
+	}
+	generated, ok := tv.generatedAt()
+	if !ok {
+		if tv.Date != "" {
+			logMessage(fmt.Sprintf("   ⚠️  %s feed date %q not understood; freshness not checked", provider.Label, tv.Date))
+		}
+		return nil
+	}
+	age := now.Sub(generated)
+	if age <= maxAge {
+		return nil
+	}
+	err := &staleFeedError{Generated: generated, Age: age, Limit: maxAge}
+	if reject {
+		return err
+	}
+	from := ""
+	if tv.SourceInfoName != "" || tv.SourceInfoURL != "" {
+		from = fmt.Sprintf(" (source: %s)", strings.TrimSpace(tv.SourceInfoName+" "+tv.SourceInfoURL))
+	}
+	warn(warnStaleFeed, provider.Name, fmt.Sprintf("   ⚠️  %s is stale: %v%s; the guide may be wrong", provider.Label, err, from))
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runGC implements `epg gc`: it removes state and files older than the
+// retention period and reports the space reclaimed.
+func runGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	keepDays := fs.Int("keep-days", 14, "keep anything used or dated within this many days")
+	dryRun := fs.Bool("dry-run", false, "report what would be removed without removing it")
+	opts := registerGenerateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *keepDays < 1 {
+		return fmt.Errorf("--keep-days must be at least 1")
+	}
+
+	if err := opts.validateLayout(); err != nil {
+		return err
+	}
+	loc, fellBack, err := loadTimezone(opts.Timezone, opts.TimezoneFallback)
+	if err != nil {
+		return err
+	}
+	if fellBack {
+		fmt.Printf("⚠️  Timezone %s is not available on this system; using the fixed offset %s\n", opts.Timezone, loc)
+	}
+	now := time.Now().In(loc)
+	cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -*keepDays)
+	verb := "Removed"
+	if *dryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("🧹 Collecting garbage older than %s\n", cutoff.Format("2006-01-02"))
+
+	var reclaimed int64
+
+	// Channel files dated before the cutoff, left behind by partial runs
+	// for channels that have since stopped appearing in the feeds.
+	if strings.Contains(opts.Output, "://") {
+		fmt.Printf("   ⏭️  %s is not a local directory; skipping old outputs\n", opts.Output)
+	} else {
+		files, bytes, err := removeStaleOutputs(opts.Output, opts.outputDays(), cutoff, *dryRun)
+		if err != nil {
+			return err
+		}
+		reclaimed += bytes
+		fmt.Printf("   🗂️  %s %d old channel files (%s)\n", verb, files, formatByteSize(int(bytes)))
+	}
+
+	// Match cache entries for rules that have not matched since the cutoff,
+	// then compaction, since bbolt never shrinks its file on its own.
+	state := opts.statePath()
+	if _, err := os.Stat(state); state != "" && err == nil {
+		store, err := openStateStore(state)
+		if err != nil {
+			return fmt.Errorf("opening %s: %v", state, err)
+		}
+		pruned, err := store.PruneMatchCache(cutoff, *dryRun)
+		store.Close()
+		if err != nil {
+			return fmt.Errorf("pruning match cache: %v", err)
+		}
+		fmt.Printf("   🧩 %s %d stale match cache entries\n", verb, pruned)
+
+		if !*dryRun {
+			before, after, err := compactStateFile(state)
+			if err != nil {
+				return fmt.Errorf("compacting %s: %v", state, err)
+			}
+			reclaimed += before - after
+			fmt.Printf("   🗜️  Compacted %s: %s → %s\n", state, formatByteSize(int(before)), formatByteSize(int(after)))
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("\n✅ Would reclaim %s\n", formatByteSize(int(reclaimed)))
+	} else {
+		fmt.Printf("\n✅ Reclaimed %s\n", formatByteSize(int(reclaimed)))
+	}
+	return nil
+}
+
+// removeStaleOutputs deletes channel files under root's output folders whose
+// date is before cutoff, returning how many files and bytes were removed.
+func removeStaleOutputs(root string, days []outputDay, cutoff time.Time, dryRun bool) (int, int64, error) {
+	removed := 0
+	var bytes int64
+	for _, day := range days {
+		files, err := filepath.Glob(filepath.Join(root, day.Dir, "*.json"))
+		if err != nil {
+			return removed, bytes, err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return removed, bytes, err
+			}
+			var schedule struct {
+				Date string `json:"date"`
+			}
+			if err := json.Unmarshal(data, &schedule); err != nil {
+				continue
+			}
+			date, err := time.ParseInLocation("2006-01-02", schedule.Date, cutoff.Location())
+			if err != nil || !date.Before(cutoff) {
+				continue
+			}
+			if !dryRun {
+				if err := os.Remove(file); err != nil {
+					return removed, bytes, err
+				}
+			}
+			removed++
+			bytes += int64(len(data))
+		}
+	}
+	return removed, bytes, nil
+}
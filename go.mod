@@ -1,3 +1,15 @@
 module epg-parser
 
 go 1.23
+
+require (
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/crypto v0.32.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.21.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
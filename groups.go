@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// loadGroups reads `Group Name: channel, channel, ...` lines, where channels
+// are output names or canonical IDs. `Group Name = channel, ...` works too,
+// like aliases.txt and the other .txt files. A missing file yields no groups.
+func loadGroups(filename string) (map[string][]string, error) {
+	groups := make(map[string][]string)
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return groups, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.IndexAny(line, ":=")
+		if sep < 0 {
+			continue
+		}
+		name := groupKey(line[:sep])
+		for _, channel := range strings.Split(line[sep+1:], ",") {
+			if channel = strings.TrimSpace(channel); channel != "" {
+				groups[name] = append(groups[name], channel)
+			}
+		}
+	}
+	return groups, nil
+}
+
+// groupKey makes group names case-insensitive and URL friendly, so
+// "Hindi Movies" is served at /group/hindi-movies.
+func groupKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "-")
+}
+
+func (s *guideServer) groupChannels(w http.ResponseWriter, r *http.Request, guide *Guide) (string, []string, bool) {
+	name := groupKey(r.PathValue("name"))
+	channels, exists := guide.Groups[name]
+	if !exists {
+		writeError(w, http.StatusNotFound, "unknown group")
+		return "", nil, false
+	}
+	return name, channels, true
+}
+
+func (s *guideServer) handleGroupNow(w http.ResponseWriter, r *http.Request) {
+	guide := s.guide.Load()
+	name, channels, ok := s.groupChannels(w, r, guide)
+	if !ok {
+		return
+	}
+
+	now := time.Now().In(s.loc)
+	summaries := make([]ChannelNow, 0, len(channels))
+	for _, channel := range channels {
+		if summary, found := s.channelNow(guide, channel, now); found {
+			summaries = append(summaries, summary)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"group":    name,
+		"time":     now.Format(time.RFC3339),
+		"channels": summaries,
+	})
+}
+
+func (s *guideServer) handleGroupEPG(w http.ResponseWriter, r *http.Request) {
+	guide := s.guide.Load()
+	name, channels, ok := s.groupChannels(w, r, guide)
+	if !ok {
+		return
+	}
+	date, ok := s.requestDate(w, r)
+	if !ok {
+		return
+	}
+	fields, ok := requestFields(w, r)
+	if !ok {
+		return
+	}
+
+	schedules := make([]any, 0, len(channels))
+	for _, channel := range channels {
+		if _, days := guide.lookup(channel); days != nil && days[date] != nil {
+			schedules = append(schedules, projectSchedule(days[date], fields, s.loc))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"group":    name,
+		"date":     date,
+		"channels": schedules,
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Kinds of source failure recorded in SourceHealth.
+const (
+	failureDNS        = "dns"
+	failureHTTP       = "http"
+	failureTimeout    = "timeout"
+	failureConnection = "connection"
+	failureParse      = "parse"
+	failureStale      = "stale"
+	failureCorrupt    = "corrupt"
+	failureTLS        = "tls"
+)
+
+// statusError is a feed request answered with an unexpected HTTP status.
+type statusError struct {
+	Status string
+	Code   int
+}
+
+func (e *statusError) Error() string { return "unexpected HTTP status " + e.Status }
+
+// failureKind classifies a feed error for the source health record.
+func failureKind(err error) string {
+	var dnsErr *net.DNSError
+	var status *statusError
+	var stage *stageTimeoutError
+	var netErr net.Error
+	switch {
+	case errors.As(err, new(parseError)):
+		return failureParse
+	case errors.As(err, new(*staleFeedError)):
+		return failureStale
+	case errors.As(err, new(*corruptFeedError)):
+		return failureCorrupt
+	case errors.As(err, new(*tls.CertificateVerificationError)):
+		return failureTLS
+	case errors.As(err, &dnsErr):
+		return failureDNS
+	case errors.As(err, &status):
+		return failureHTTP
+	case errors.As(err, &stage), errors.As(err, &netErr) && netErr.Timeout():
+		return failureTimeout
+	default:
+		return failureConnection
+	}
+}
+
+// deadSource reports whether a source has failed at least runs runs in a row
+// at its current URL, and if so the alert to raise. runs 0 disables the
+// check.
+func deadSource(provider Provider, health SourceHealth, runs int, sourcesFile string) (string, bool) {
+	if runs <= 0 || health.ConsecutiveFailures < runs {
+		return "", false
+	}
+	hint := "the server is gone or moved"
+	switch health.LastKind {
+	case failureDNS:
+		hint = "its host no longer resolves, as when a short link expires"
+	case failureHTTP:
+		hint = "the server answers, but not with the feed"
+	case failureParse:
+		hint = "the URL no longer serves a gzipped XMLTV feed"
+	case failureStale:
+		hint = "the mirror has stopped updating the feed"
+	case failureCorrupt:
+		hint = "the feed keeps arriving truncated or damaged"
+	case failureTLS:
+		hint = "its TLS certificate cannot be verified, so give its CA with --ca-cert or ca_cert if it is trusted"
+	}
+	return fmt.Sprintf("%s (%s) has failed %d runs in a row since %s; %s. Last error (%s): %s. Update its URL in %s.",
+		provider.Label, provider.URL, health.ConsecutiveFailures, health.FailingSince, hint, health.LastKind, health.LastError, sourcesFile), true
+}
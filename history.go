@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// historyRetentionDays is how long a first airing is remembered.
+const historyRetentionDays = 60
+
+// AiringHistory remembers when each title/episode was first seen per output
+// channel, so first airings can be inferred for feeds without <new/> markers.
+type AiringHistory struct {
+	// bootstrap holds channels that had no history when this run started.
+	bootstrap map[string]bool
+	// Channels maps output slug -> airing key -> first airing.
+	Channels map[string]map[string]FirstAiring `json:"channels"`
+}
+
+// FirstAiring records the first start time (RFC3339) of a title/episode.
+// Baseline entries were recorded while bootstrapping a channel and are never
+// reported as new.
+type FirstAiring struct {
+	First    string `json:"first"`
+	Baseline bool   `json:"baseline,omitempty"`
+}
+
+// loadAiringHistory reads the history from the state store. Without a store
+// history is disabled and nil is returned.
+func loadAiringHistory(store *StateStore) (*AiringHistory, error) {
+	if store == nil {
+		return nil, nil
+	}
+	h := &AiringHistory{
+		bootstrap: make(map[string]bool),
+		Channels:  make(map[string]map[string]FirstAiring),
+	}
+	err := store.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketHistory).ForEach(func(slug, value []byte) error {
+			seen := make(map[string]FirstAiring)
+			if err := json.Unmarshal(value, &seen); err != nil {
+				return fmt.Errorf("history for %s: %v", slug, err)
+			}
+			h.Channels[string(slug)] = seen
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// IsNew reports whether prog is a first airing on channel slug, recording it
+// in the history. An explicit <new/> always wins. A channel with no history
+// yet is treated as a bootstrap: nothing is flagged until a baseline exists.
+func (h *AiringHistory) IsNew(slug string, prog Programme, start time.Time) bool {
+	if prog.New != nil {
+		h.record(slug, prog, start, false)
+		return true
+	}
+	if h == nil {
+		return false
+	}
+
+	seen, exists := h.Channels[slug]
+	if !exists || h.bootstrap[slug] {
+		h.bootstrap[slug] = true
+		h.record(slug, prog, start, true)
+		return false
+	}
+
+	key := airingKey(prog)
+	first, exists := seen[key]
+	if !exists {
+		seen[key] = FirstAiring{First: start.Format(time.RFC3339)}
+		return true
+	}
+	if first.Baseline {
+		return false
+	}
+	firstTime, err := time.Parse(time.RFC3339, first.First)
+	if err != nil {
+		return false
+	}
+	return firstTime.Equal(start)
+}
+
+func (h *AiringHistory) record(slug string, prog Programme, start time.Time, baseline bool) {
+	if h == nil {
+		return
+	}
+	seen, exists := h.Channels[slug]
+	if !exists {
+		seen = make(map[string]FirstAiring)
+		h.Channels[slug] = seen
+	}
+	key := airingKey(prog)
+	if _, exists := seen[key]; !exists {
+		seen[key] = FirstAiring{First: start.Format(time.RFC3339), Baseline: baseline}
+	}
+}
+
+// Save prunes entries older than the retention window and writes the
+// history back to the state store.
+func (h *AiringHistory) Save(store *StateStore, now time.Time) error {
+	if h == nil || store == nil || store.readOnly {
+		return nil
+	}
+	cutoff := now.AddDate(0, 0, -historyRetentionDays)
+	return store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketHistory)
+		for slug, seen := range h.Channels {
+			for key, first := range seen {
+				if t, err := time.Parse(time.RFC3339, first.First); err != nil || t.Before(cutoff) {
+					delete(seen, key)
+				}
+			}
+			if len(seen) == 0 {
+				delete(h.Channels, slug)
+				if err := bucket.Delete([]byte(slug)); err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := json.Marshal(seen)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(slug), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// airingKey identifies a title/episode combination. Programmes without an
+// episode number are keyed by title alone.
+func airingKey(prog Programme) string {
+	key := strings.ToLower(strings.TrimSpace(prog.Title))
+	if episode := prog.episode(); episode != "" {
+		key += "|" + episode
+	}
+	return key
+}
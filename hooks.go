@@ -0,0 +1,100 @@
+package main
+
+import "time"
+
+// Hooks lets code embedding the generator follow a run without parsing log
+// output, e.g. to drive a progress bar or export metrics. Every callback is
+// optional and is called synchronously from the run.
+type Hooks struct {
+	// OnSourceFetched is called after each provider feed is downloaded (or
+	// fails to download).
+	OnSourceFetched func(SourceFetched)
+	// OnChannelMatched is called for every filter rule, matched or not.
+	OnChannelMatched func(ChannelMatched)
+	// OnFileWritten is called for every file written to the output,
+	// including channels.json, analytics.json and the static index.
+	OnFileWritten func(FileWritten)
+	// OnRunFinished is called once at the end of every run, successful or
+	// not.
+	OnRunFinished func(RunFinished)
+}
+
+type SourceFetched struct {
+	Provider   string
+	URL        string
+	Channels   int
+	Programmes int
+	Duration   time.Duration
+	Err        error
+}
+
+type ChannelMatched struct {
+	Rule FilterRule
+	// Match is nil when no strategy found the channel.
+	Match *Match
+}
+
+type FileWritten struct {
+	Name  string
+	Bytes int
+}
+
+type RunFinished struct {
+	Started  time.Time
+	Duration time.Duration
+	// Err is the error the run failed with, nil on success.
+	Err error
+	// Unchanged reports a run skipped because nothing changed since the
+	// last one; the counts below are then zero.
+	Unchanged bool
+	// Partial reports a --channel or --only-* run, whose counts cover only
+	// the channels it processed.
+	Partial       bool
+	Processed     int
+	SavedToday    int
+	SavedTomorrow int
+	Skipped       int
+	Throttled     int
+	Sources       []SourceFetched
+	// Warnings are the run's coded warnings; see warnings.go.
+	Warnings []Warning
+}
+
+func (h Hooks) sourceFetched(event SourceFetched) {
+	if h.OnSourceFetched != nil {
+		h.OnSourceFetched(event)
+	}
+}
+
+func (h Hooks) channelMatched(event ChannelMatched) {
+	if h.OnChannelMatched != nil {
+		h.OnChannelMatched(event)
+	}
+}
+
+func (h Hooks) runFinished(event RunFinished) {
+	if h.OnRunFinished != nil {
+		h.OnRunFinished(event)
+	}
+}
+
+// wrapOutput reports successful writes to out through OnFileWritten.
+func (h Hooks) wrapOutput(out OutputFS) OutputFS {
+	if h.OnFileWritten == nil {
+		return out
+	}
+	return hookedFS{OutputFS: out, onWrite: h.OnFileWritten}
+}
+
+type hookedFS struct {
+	OutputFS
+	onWrite func(FileWritten)
+}
+
+func (h hookedFS) WriteFile(name string, data []byte) error {
+	if err := h.OutputFS.WriteFile(name, data); err != nil {
+		return err
+	}
+	h.onWrite(FileWritten{Name: name, Bytes: len(data)})
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// hostingOptions are how `epg serve` listens: plain HTTP by default, HTTPS
+// from certificate files or from Let's Encrypt for Domains, and basic
+// authentication for everything but /healthz and /admin.
+type hostingOptions struct {
+	Addr      string
+	CertFile  string
+	KeyFile   string
+	Domains   []string
+	CertCache string
+	Email     string
+	// ACMEAddr answers Let's Encrypt's HTTP challenges and redirects other
+	// plain HTTP requests to HTTPS; empty leaves port 80 alone.
+	ACMEAddr  string
+	BasicAuth string
+}
+
+// validate checks that the options describe one way of serving.
+func (o hostingOptions) validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return fmt.Errorf("--tls-cert and --tls-key go together")
+	}
+	if o.CertFile != "" && len(o.Domains) > 0 {
+		return fmt.Errorf("give either --tls-cert and --tls-key or --tls-domains, not both")
+	}
+	if o.BasicAuth != "" && !strings.Contains(o.BasicAuth, ":") {
+		return fmt.Errorf("--basic-auth must be user:password")
+	}
+	return nil
+}
+
+// listen serves handler as the options say until the server fails.
+func (o hostingOptions) listen(handler http.Handler) error {
+	server := &http.Server{Addr: o.Addr, Handler: handler}
+	switch {
+	case o.CertFile != "":
+		return server.ListenAndServeTLS(o.CertFile, o.KeyFile)
+	case len(o.Domains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(o.Domains...),
+			Cache:      autocert.DirCache(o.CertCache),
+			Email:      o.Email,
+		}
+		if o.ACMEAddr != "" {
+			go func() {
+				if err := http.ListenAndServe(o.ACMEAddr, manager.HTTPHandler(nil)); err != nil {
+					logMessage(fmt.Sprintf("⚠️  Not answering HTTP challenges on %s: %v", o.ACMEAddr, err))
+				}
+			}()
+		}
+		server.TLSConfig = manager.TLSConfig()
+		return server.ListenAndServeTLS("", "")
+	default:
+		return server.ListenAndServe()
+	}
+}
+
+// scheme names what listen serves, for the startup log.
+func (o hostingOptions) scheme() string {
+	if o.CertFile != "" || len(o.Domains) > 0 {
+		return "https"
+	}
+	return "http"
+}
+
+// withBasicAuth asks for s.basicAuth's user and password on every request
+// but /healthz, for load balancers, and /admin, which has its own token.
+func (s *guideServer) withBasicAuth(next http.Handler) http.Handler {
+	if s.basicAuth == "" {
+		return next
+	}
+	wantUser, wantPassword, _ := strings.Cut(s.basicAuth, ":")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(wantUser)) != 1 || subtle.ConstantTimeCompare([]byte(password), []byte(wantPassword)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="epg", charset="UTF-8"`)
+			writeError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// publishedFiles lists the files /files serves: those the last run's
+// manifest.json in root lists, and the manifest. Nothing else in the
+// output directory, which is often the working directory with the sources
+// and state files, is served.
+func publishedFiles(root string) map[string]bool {
+	files := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Join(root, manifestFile))
+	if err != nil {
+		return files
+	}
+	var manifest Manifest
+	if json.Unmarshal(data, &manifest) != nil {
+		return files
+	}
+	for name := range manifest.Files {
+		files[name] = true
+	}
+	files[manifestFile] = true
+	return files
+}
+
+// handleFile serves a generated file as written, so the output directory
+// can be hosted without a separate web server. /files/ is its index.html.
+func (s *guideServer) handleFile(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.PathValue("path"))[1:]
+	if name == "" {
+		name = "index.html"
+	}
+	if !s.guide.Load().Files[name] {
+		writeError(w, http.StatusNotFound, "no such file")
+		return
+	}
+	file, err := os.Open(filepath.Join(s.outputRoot, filepath.FromSlash(name)))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "no such file")
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
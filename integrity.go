@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// feedCheck is what a feed's download must pass before it is parsed.
+type feedCheck struct {
+	MinSize  int
+	Checksum string
+}
+
+// feedChecks are the checks of each feed URL, applied by verifyFeed. The
+// providers a run loads register theirs.
+var feedChecks = make(map[string]feedCheck)
+
+// sha256Checksum is a checksum given in sources.yaml itself.
+var sha256Checksum = regexp.MustCompile(`^sha256:[0-9a-fA-F]{64}$`)
+
+// registerFeedChecks makes verifyFeed check each provider's downloads, with
+// minSize for those that set no min_size of their own.
+func registerFeedChecks(providers []Provider, minSize int) {
+	checks := make(map[string]feedCheck)
+	for _, p := range providers {
+		check := feedCheck{MinSize: p.MinSize, Checksum: p.Checksum}
+		if check.MinSize == 0 {
+			check.MinSize = minSize
+		}
+		checks[p.URL] = check
+	}
+	feedChecks = checks
+}
+
+// corruptFeedError is a download that arrived but fails verifyFeed.
+type corruptFeedError struct {
+	Reason string
+}
+
+func (e *corruptFeedError) Error() string { return "corrupt download: " + e.Reason }
+
+// verifyFeed checks a downloaded feed before it is parsed, so that a
+// truncated or damaged download is reported as one rather than as an XML
+// error deep into the file: it must reach its minimum size, be a gzip
+// stream whose checksum and length trailer match (the stream is read
+// through once for this) or else an XML document, and match its configured
+// checksum. Failures are feedErrors of the verify stage around a
+// corruptFeedError.
+func verifyFeed(url string, body []byte) error {
+	check := feedChecks[url]
+	corrupt := func(offset int64, format string, args ...any) error {
+		return feedFailure(url, stageVerify, offset, &corruptFeedError{Reason: fmt.Sprintf(format, args...)})
+	}
+	if len(body) < check.MinSize {
+		return corrupt(-1, "%s, under the %s minimum", formatByteSize(len(body)), formatByteSize(check.MinSize))
+	}
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		compressed := &countingReader{r: bytes.NewReader(body)}
+		gzReader, err := gzip.NewReader(compressed)
+		if err == nil {
+			_, err = io.Copy(io.Discard, gzReader)
+		}
+		if err != nil {
+			return corrupt(compressed.n, "damaged or truncated gzip (%v)", err)
+		}
+	} else if start := documentStart(body); !strings.HasPrefix(start, "<") {
+		return corrupt(0, "neither gzip nor XML, starts %q", start)
+	} else if lower := strings.ToLower(start); strings.HasPrefix(lower, "<!doctype html") || strings.HasPrefix(lower, "<html") {
+		return corrupt(0, "an HTML page, not a feed")
+	}
+	if check.Checksum == "" {
+		return nil
+	}
+	expected, err := expectedChecksum(check.Checksum)
+	if err != nil {
+		return feedFailure(url, stageVerify, -1, fmt.Errorf("fetching checksum: %w", err))
+	}
+	sum := sha256.Sum256(body)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, expected) {
+		return corrupt(-1, "SHA-256 %s, expected %s", actual, expected)
+	}
+	return nil
+}
+
+// documentStart returns the first bytes of body past a byte order mark and
+// white space, for telling an XML document from an error message.
+func documentStart(body []byte) string {
+	body = bytes.TrimLeft(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(body) > 20 {
+		body = body[:20]
+	}
+	return string(body)
+}
+
+// expectedChecksum returns the SHA-256 a checksum setting expects: the one
+// it gives as sha256:<hex>, or the first word of the checksum file at its
+// URL, as sha256sum writes them.
+func expectedChecksum(checksum string) (string, error) {
+	if sum, found := strings.CutPrefix(checksum, "sha256:"); found {
+		return sum, nil
+	}
+	resp, err := httpGet(checksum, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || !sha256Checksum.MatchString("sha256:"+fields[0]) {
+		return "", fmt.Errorf("%s holds no SHA-256", checksum)
+	}
+	return fields[0], nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// chnoPrefix marks a filter rule that names a channel by its number in a
+// provider lineup: `chno:112 = Star Gold`, or `chno:Tata:112 = Star Gold` to
+// use one provider's numbering. Numbers survive the renames ("Star Gold" to
+// "Star Gold SD") that break name matching.
+const chnoPrefix = "chno:"
+
+// channelNumberRule returns the provider (empty for any) and channel number
+// of a chno: rule.
+func channelNumberRule(rule FilterRule) (provider, number string, ok bool) {
+	value, found := strings.CutPrefix(strings.TrimSpace(rule.OriginalName), chnoPrefix)
+	if !found {
+		return "", "", false
+	}
+	if before, after, pinned := strings.Cut(value, ":"); pinned {
+		provider, value = strings.TrimSpace(before), after
+	}
+	number, ok = normalizeChannelNumber(value)
+	return provider, number, ok
+}
+
+// normalizeChannelNumber trims leading zeros, so "0112" and "112" are the
+// same channel.
+func normalizeChannelNumber(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.Trim(value, "0123456789") != "" {
+		return "", false
+	}
+	if trimmed := strings.TrimLeft(value, "0"); trimmed != "" {
+		return trimmed, true
+	}
+	return "0", true
+}
+
+// loadLineups reads the provider lineup files in dir, one per provider and
+// named after it (Tata.txt), with `number = channel` lines where channel is
+// the provider's channel ID or display name. Lineups are keyed by lowercase
+// provider name. A missing directory yields no lineups.
+func loadLineups(dir string) (map[string]map[string]string, error) {
+	lineups := make(map[string]map[string]string)
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		lineup := make(map[string]string)
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+				return nil, fmt.Errorf("%s: invalid line %q: expected `number = channel`", file, line)
+			}
+			number, ok := normalizeChannelNumber(parts[0])
+			if !ok {
+				return nil, fmt.Errorf("%s: invalid channel number %q", file, strings.TrimSpace(parts[0]))
+			}
+			lineup[number] = strings.TrimSpace(parts[1])
+		}
+		provider := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		lineups[strings.ToLower(provider)] = lineup
+	}
+	return lineups, nil
+}
+
+// indexLineup resolves a provider lineup against the feed, by channel ID
+// and then display name, into src.ChannelsByNumber. It returns the numbers
+// whose channel is not in the feed.
+func indexLineup(src *EPGSource, provider Provider, lineup map[string]string) []string {
+	missing := make([]string, 0)
+	for number, channel := range lineup {
+		ch, exists := src.ChannelsByID[channel]
+		if !exists {
+			ch, exists = src.ChannelsByName[provider.indexName(channel)]
+		}
+		if !exists {
+			missing = append(missing, number)
+			continue
+		}
+		src.ChannelsByNumber[number] = ch
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// chnoMatcher resolves chno: rules through the provider lineups. Other
+// rules are left to the rest of the chain.
+type chnoMatcher struct{}
+
+func (chnoMatcher) Name() string { return "chno" }
+
+func (chnoMatcher) Match(rule FilterRule, sources []*EPGSource) *Match {
+	provider, number, ok := channelNumberRule(rule)
+	if !ok {
+		return nil
+	}
+	for _, src := range sources {
+		if provider != "" && !strings.EqualFold(src.Name, provider) {
+			continue
+		}
+		if ch, exists := src.ChannelsByNumber[number]; exists {
+			return newMatch(src, ch, "chno")
+		}
+	}
+	return nil
+}
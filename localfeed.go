@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// localFeedClient reads local feed files through the same request path as
+// downloads, so Last-Modified, conditional requests and ranges behave the
+// same way for files as for mirrors.
+var localFeedClient = &http.Client{Transport: http.NewFileTransport(http.Dir("/"))}
+
+// localFeedPath returns the file a source names, for a file:// URL or a
+// plain path such as feeds/jio.xml.gz, which is relative to the working
+// directory.
+func localFeedPath(source string) (string, bool) {
+	if path, found := strings.CutPrefix(source, "file://"); found {
+		return path, true
+	}
+	return source, !strings.Contains(source, "://")
+}
+
+// validFeedURL reports whether a source is a feed this parser can read: an
+// http(s) URL or a local file.
+func validFeedURL(source string) bool {
+	if _, local := localFeedPath(source); local {
+		return true
+	}
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// localFeedRequest turns a local source into a file:// request URL for
+// localFeedClient, failing early with the file's own error when it cannot
+// be read.
+func localFeedRequest(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(abs); err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadLogoCatalog reads `channel = logo URL` lines, keyed by normalized
+// channel name. Catalog logos replace the provider icon, which is usually a
+// small JPEG on a white background. A missing file yields an empty catalog.
+func loadLogoCatalog(filename string) (map[string]string, error) {
+	catalog := make(map[string]string)
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return catalog, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %q: expected `channel = logo URL`", line)
+		}
+		url := strings.TrimSpace(parts[1])
+		if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			return nil, fmt.Errorf("invalid logo URL %q for %s", url, strings.TrimSpace(parts[0]))
+		}
+		catalog[normalizeChannelName(strings.TrimSpace(parts[0]))] = url
+	}
+	return catalog, nil
+}
+
+// catalogLogo returns the catalog logo for a matched channel, looked up by the
+// rule as written in filter.txt, its output name, then the provider's display
+// name.
+func catalogLogo(catalog map[string]string, rule FilterRule, channel *Channel) (string, bool) {
+	for _, name := range []string{rule.OriginalName, rule.OutputName, channel.DisplayName} {
+		if url, exists := catalog[normalizeChannelName(name)]; exists {
+			return url, true
+		}
+	}
+	return "", false
+}
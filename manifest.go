@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+const manifestFile = "manifest.json"
+
+// Manifest lists every output file with its checksum, so sync jobs can
+// verify what they copied and clients can validate their caches.
+type Manifest struct {
+	GeneratedAt string `json:"generated_at,omitempty"`
+	// FeedDate is the newest feed's own date, written with --canonical in
+	// place of GeneratedAt.
+	FeedDate string                   `json:"feed_date,omitempty"`
+	Files    map[string]ManifestEntry `json:"files"`
+}
+
+type ManifestEntry struct {
+	SHA256 string `json:"sha256"`
+	Bytes  int    `json:"bytes"`
+}
+
+// manifestFS records a manifest entry for every file written through it.
+// With canonical set, manifest.json itself is written with sorted keys.
+type manifestFS struct {
+	OutputFS
+	mu        sync.Mutex
+	manifest  Manifest
+	canonical bool
+}
+
+// newManifestFS wraps out. With previous set, the manifest starts from it, so
+// partial runs update the entries they rewrite and keep the rest.
+func newManifestFS(out OutputFS, previous *Manifest) *manifestFS {
+	m := &manifestFS{OutputFS: out, manifest: Manifest{Files: make(map[string]ManifestEntry)}}
+	if previous != nil {
+		for name, entry := range previous.Files {
+			m.manifest.Files[name] = entry
+		}
+	}
+	return m
+}
+
+func (m *manifestFS) WriteFile(name string, data []byte) error {
+	if err := m.OutputFS.WriteFile(name, data); err != nil {
+		return err
+	}
+	if name == manifestFile {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	m.mu.Lock()
+	m.manifest.Files[name] = ManifestEntry{SHA256: hex.EncodeToString(sum[:]), Bytes: len(data)}
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *manifestFS) RemoveAll(dir string) error {
+	if err := m.OutputFS.RemoveAll(dir); err != nil {
+		return err
+	}
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	m.mu.Lock()
+	for name := range m.manifest.Files {
+		if strings.HasPrefix(name, prefix) {
+			delete(m.manifest.Files, name)
+		}
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// save writes manifest.json, keyed by file name in sorted order.
+func (m *manifestFS) save(generatedAt, feedDate string) error {
+	m.mu.Lock()
+	m.manifest.GeneratedAt, m.manifest.FeedDate = generatedAt, feedDate
+	jsonData, err := json.MarshalIndent(m.manifest, "", "  ")
+	m.mu.Unlock()
+	if err == nil && m.canonical {
+		jsonData, err = canonicalJSON(jsonData)
+	}
+	if err != nil {
+		return err
+	}
+	return m.WriteFile(manifestFile, jsonData)
+}
+
+// loadManifest reads the manifest left by the previous run, for backends that
+// can read their files back. It returns nil when there is none.
+func loadManifest(out OutputFS) *Manifest {
+	reader, ok := out.(interface {
+		ReadFile(name string) ([]byte, error)
+	})
+	if !ok {
+		return nil
+	}
+	data, err := reader.ReadFile(manifestFile)
+	if err != nil {
+		return nil
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Files == nil {
+		return nil
+	}
+	return &manifest
+}
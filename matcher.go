@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EPGSource is one downloaded XMLTV feed together with its lookup indexes.
+type EPGSource struct {
+	Name                string
+	TV                  *TV
+	ChannelsByID        map[string]*Channel
+	ChannelsByName      map[string]*Channel
+	ProgrammesByChannel map[string][]Programme
+	// ChannelsByNumber maps lineup channel numbers to channels.
+	ChannelsByNumber map[string]*Channel
+	// Offsets counts programme start timestamps by their UTC offset suffix.
+	Offsets map[string]int
+	// FilledStops counts programmes whose missing stop time was taken from
+	// the next programme's start.
+	FilledStops int
+}
+
+func newEPGSource(provider Provider, tv *TV) *EPGSource {
+	src := &EPGSource{
+		Name:                provider.Name,
+		TV:                  tv,
+		ChannelsByID:        make(map[string]*Channel),
+		ChannelsByName:      make(map[string]*Channel),
+		ProgrammesByChannel: make(map[string][]Programme),
+		ChannelsByNumber:    make(map[string]*Channel),
+		Offsets:             make(map[string]int),
+	}
+	for i := range tv.Channels {
+		ch := &tv.Channels[i]
+		src.ChannelsByID[ch.ID] = ch
+		src.ChannelsByName[provider.indexName(ch.DisplayName)] = ch
+	}
+	for _, prog := range tv.Programmes {
+		src.ProgrammesByChannel[prog.Channel] = append(src.ProgrammesByChannel[prog.Channel], prog)
+		src.Offsets[offsetLabel(prog.Start)]++
+	}
+	for channel, progs := range src.ProgrammesByChannel {
+		src.FilledStops += fillMissingStops(progs)
+		src.ProgrammesByChannel[channel] = progs
+	}
+	return src
+}
+
+// fillMissingStops sorts a channel's programmes by start and gives those
+// without a usable stop time the start of the next programme, so they are
+// kept rather than dropped. It returns how many stops were filled in.
+func fillMissingStops(progs []Programme) int {
+	starts := make([]time.Time, len(progs))
+	valid := make([]bool, len(progs))
+	for i, prog := range progs {
+		starts[i], _ = parseEPGTime(prog.Start, time.UTC)
+		valid[i] = !starts[i].IsZero()
+	}
+	order := make([]int, len(progs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		if valid[i] != valid[j] {
+			return valid[i]
+		}
+		return starts[i].Before(starts[j])
+	})
+	sorted := make([]Programme, len(progs))
+	for k, i := range order {
+		sorted[k] = progs[i]
+	}
+	copy(progs, sorted)
+
+	filled := 0
+	for k := 0; k+1 < len(order); k++ {
+		i, next := order[k], order[k+1]
+		if !valid[i] || !valid[next] || !starts[next].After(starts[i]) {
+			continue
+		}
+		if _, err := parseEPGTime(progs[k].Stop, time.UTC); err != nil {
+			progs[k].Stop = progs[k+1].Start
+			filled++
+		}
+	}
+	return filled
+}
+
+// logOffsetSummary logs how the source's timestamps are offset from UTC,
+// warning when a feed mixes offsets or omits them.
+func logOffsetSummary(src *EPGSource) {
+	labels := make([]string, 0, len(src.Offsets))
+	for label := range src.Offsets {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return src.Offsets[labels[i]] > src.Offsets[labels[j]]
+	})
+
+	parts := make([]string, len(labels))
+	for i, label := range labels {
+		parts[i] = fmt.Sprintf("%s ×%d", label, src.Offsets[label])
+	}
+	logMessage(fmt.Sprintf("🕐 %s timestamp offsets: %s", src.Name, strings.Join(parts, ", ")))
+
+	if len(labels) > 1 {
+		warn(warnBadTimestamps, src.Name, fmt.Sprintf("⚠️  %s mixes %d different UTC offsets; each timestamp is converted using its own offset", src.Name, len(labels)))
+	}
+	if src.FilledStops > 0 {
+		warn(warnBadTimestamps, src.Name, fmt.Sprintf("🩹 %s has %d programmes without a valid stop time; they end when the next programme starts", src.Name, src.FilledStops))
+	}
+	if src.Offsets["none"] > 0 {
+		warn(warnBadTimestamps, src.Name, fmt.Sprintf("⚠️  %s has %d timestamps without an offset; they are treated as UTC", src.Name, src.Offsets["none"]))
+	}
+}
+
+// sortedNames returns the normalized channel names of the source in a stable order.
+func (s *EPGSource) sortedNames() []string {
+	names := make([]string, 0, len(s.ChannelsByName))
+	for name := range s.ChannelsByName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Match is the result of resolving a filter rule to a source channel.
+type Match struct {
+	Channel    *Channel
+	Programmes []Programme
+	Source     string
+	Strategy   string
+	// Overlap is the strategy applied across sources, and Providers lists
+	// every channel merged into Programmes (nil means just Channel). Source
+	// stays the primary source, which is what the match cache records.
+	Overlap   string
+	Providers []ProviderRef
+}
+
+// providers returns the provider channels the match was built from.
+func (m *Match) providers() []ProviderRef {
+	if m.Providers != nil {
+		return m.Providers
+	}
+	return []ProviderRef{{Source: m.Source, ID: m.Channel.ID}}
+}
+
+// sources names the contributing sources, e.g. "Jio+Tata" for a merge.
+func (m *Match) sources() string {
+	names := make([]string, 0, len(m.Providers)+1)
+	for _, ref := range m.providers() {
+		names = append(names, ref.Source)
+	}
+	return strings.Join(names, "+")
+}
+
+func newMatch(src *EPGSource, ch *Channel, strategy string) *Match {
+	return &Match{
+		Channel:    ch,
+		Programmes: src.ProgrammesByChannel[ch.ID],
+		Source:     src.Name,
+		Strategy:   strategy,
+	}
+}
+
+// Matcher resolves a filter rule against the sources, which are given in
+// priority order. It returns nil when it cannot find a channel.
+type Matcher interface {
+	Name() string
+	Match(rule FilterRule, sources []*EPGSource) *Match
+}
+
+// MatcherChain tries each matcher in order and returns the first match.
+// Playlist rules try their tvg-id first.
+type MatcherChain []Matcher
+
+func (c MatcherChain) Name() string {
+	names := make([]string, len(c))
+	for i, m := range c {
+		names[i] = m.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c MatcherChain) Match(rule FilterRule, sources []*EPGSource) *Match {
+	if match := playlistMatch(rule, sources); match != nil {
+		return match
+	}
+	for _, m := range c {
+		if match := m.Match(rule, sources); match != nil {
+			return match
+		}
+	}
+	return nil
+}
+
+// defaultMatchStrategies reproduces the historical lookup: exact normalized
+// name first, then partial (substring) matching. chno only acts on chno:
+// rules, which the historical lookup never had.
+const defaultMatchStrategies = "chno,name,partial"
+
+// matchesAliases reports whether the strategy list spec uses the aliases.
+func matchesAliases(spec string) bool {
+	for _, name := range strings.Split(spec, ",") {
+		if strings.TrimSpace(strings.ToLower(name)) == "alias" {
+			return true
+		}
+	}
+	return false
+}
+
+// buildMatcherChain builds a chain from a comma-separated strategy list such
+// as "cache,id,alias,name,token,prompt".
+func buildMatcherChain(spec string, aliases map[string]string, store *StateStore) (MatcherChain, error) {
+	chain := make(MatcherChain, 0)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		switch {
+		case name == "id":
+			chain = append(chain, idMatcher{})
+		case name == "chno":
+			chain = append(chain, chnoMatcher{})
+		case name == "cache":
+			chain = append(chain, cacheMatcher{store: store})
+		case name == "alias":
+			chain = append(chain, aliasMatcher{aliases: aliases})
+		case name == "name":
+			chain = append(chain, nameMatcher{})
+		case name == "partial":
+			chain = append(chain, partialMatcher{})
+		case name == "token" || strings.HasPrefix(name, "token:"):
+			threshold := 0.6
+			if value, ok := strings.CutPrefix(name, "token:"); ok {
+				t, err := strconv.ParseFloat(value, 64)
+				if err != nil || t <= 0 || t > 1 {
+					return nil, fmt.Errorf("invalid token threshold %q", value)
+				}
+				threshold = t
+			}
+			chain = append(chain, tokenMatcher{threshold: threshold})
+		case name == "prompt":
+			chain = append(chain, promptMatcher{})
+		default:
+			return nil, fmt.Errorf("unknown match strategy %q", name)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no match strategies configured")
+	}
+	return chain, nil
+}
+
+// idMatcher matches the rule name against provider channel IDs verbatim.
+type idMatcher struct{}
+
+func (idMatcher) Name() string { return "id" }
+
+func (idMatcher) Match(rule FilterRule, sources []*EPGSource) *Match {
+	id := strings.TrimSuffix(rule.OriginalName, ".json")
+	for _, src := range sources {
+		if ch, exists := src.ChannelsByID[id]; exists {
+			return newMatch(src, ch, "id")
+		}
+	}
+	return nil
+}
+
+// cacheMatcher reuses the channel a rule matched in a previous run, as long
+// as that channel still exists in the same source.
+type cacheMatcher struct {
+	store *StateStore
+}
+
+func (cacheMatcher) Name() string { return "cache" }
+
+func (m cacheMatcher) Match(rule FilterRule, sources []*EPGSource) *Match {
+	cached, found := m.store.CachedMatch(rule)
+	if !found {
+		return nil
+	}
+	for _, src := range sources {
+		if src.Name != cached.Source {
+			continue
+		}
+		if ch, exists := src.ChannelsByID[cached.ChannelID]; exists {
+			return newMatch(src, ch, "cache")
+		}
+	}
+	return nil
+}
+
+// aliasMatcher maps the rule name through the alias table to the provider's
+// display name.
+type aliasMatcher struct {
+	aliases map[string]string
+}
+
+func (aliasMatcher) Name() string { return "alias" }
+
+func (m aliasMatcher) Match(rule FilterRule, sources []*EPGSource) *Match {
+	target, exists := m.aliases[normalizeChannelName(rule.OriginalName)]
+	if !exists {
+		return nil
+	}
+	for _, src := range sources {
+		if ch, exists := src.ChannelsByName[target]; exists {
+			return newMatch(src, ch, "alias")
+		}
+	}
+	return nil
+}
+
+// nameMatcher matches on the normalized display name.
+type nameMatcher struct{}
+
+func (nameMatcher) Name() string { return "name" }
+
+func (nameMatcher) Match(rule FilterRule, sources []*EPGSource) *Match {
+	normalized := normalizeChannelName(rule.OriginalName)
+	for _, src := range sources {
+		if ch, exists := src.ChannelsByName[normalized]; exists {
+			return newMatch(src, ch, "name")
+		}
+	}
+	return nil
+}
+
+// partialMatcher accepts a channel whose normalized name contains, or is
+// contained in, the normalized rule name.
+type partialMatcher struct{}
+
+func (partialMatcher) Name() string { return "partial" }
+
+func (partialMatcher) Match(rule FilterRule, sources []*EPGSource) *Match {
+	normalized := normalizeChannelName(rule.OriginalName)
+	for _, src := range sources {
+		for _, key := range src.sortedNames() {
+			if strings.Contains(key, normalized) || strings.Contains(normalized, key) {
+				return newMatch(src, src.ChannelsByName[key], "partial")
+			}
+		}
+	}
+	return nil
+}
+
+// tokenMatcher scores channels by word overlap (Jaccard similarity) and
+// accepts the best one at or above the threshold.
+type tokenMatcher struct {
+	threshold float64
+}
+
+func (tokenMatcher) Name() string { return "token" }
+
+func (m tokenMatcher) Match(rule FilterRule, sources []*EPGSource) *Match {
+	candidates := rankCandidates(rule.OriginalName, sources, 1)
+	if len(candidates) == 0 || candidates[0].Score < m.threshold {
+		return nil
+	}
+	return candidates[0].Match
+}
+
+// promptMatcher asks the operator to pick a channel when stdin is a terminal.
+// It is skipped in non-interactive runs such as GitHub Actions.
+type promptMatcher struct{}
+
+func (promptMatcher) Name() string { return "prompt" }
+
+func (promptMatcher) Match(rule FilterRule, sources []*EPGSource) *Match {
+	if !stdinIsTerminal() {
+		return nil
+	}
+	candidates := rankCandidates(rule.OriginalName, sources, 5)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	fmt.Printf("\n❓ No match for %q. Pick a channel:\n", rule.OriginalName)
+	for i, c := range candidates {
+		fmt.Printf("   %d. %s (%s, ID: %s, score %.2f)\n", i+1, c.Match.Channel.DisplayName, c.Match.Source, c.Match.Channel.ID, c.Score)
+	}
+	fmt.Print("   Choice (empty to skip): ")
+
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return nil
+	}
+	match := candidates[choice-1].Match
+	match.Strategy = "prompt"
+	return match
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+type scoredCandidate struct {
+	Match *Match
+	Score float64
+}
+
+// rankCandidates returns up to limit channels ordered by token similarity to
+// name. Ties keep source priority order.
+func rankCandidates(name string, sources []*EPGSource, limit int) []scoredCandidate {
+	want := nameTokens(name)
+	if len(want) == 0 {
+		return nil
+	}
+
+	candidates := make([]scoredCandidate, 0)
+	for _, src := range sources {
+		for _, key := range src.sortedNames() {
+			ch := src.ChannelsByName[key]
+			score := jaccard(want, nameTokens(ch.DisplayName))
+			if score > 0 {
+				candidates = append(candidates, scoredCandidate{Match: newMatch(src, ch, "token"), Score: score})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// nameTokens splits a channel name into lowercase alphanumeric words.
+func nameTokens(name string) map[string]bool {
+	name = strings.ToLower(strings.TrimSuffix(name, ".json"))
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	tokens := make(map[string]bool, len(words))
+	for _, w := range words {
+		tokens[w] = true
+	}
+	return tokens
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for token := range a {
+		if b[token] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// loadAliases reads an alias file with `alias = provider display name` lines.
+// A missing file is not an error; it simply yields no aliases.
+func loadAliases(filename string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return aliases, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		aliases[normalizeChannelName(strings.TrimSpace(parts[0]))] = normalizeChannelName(strings.TrimSpace(parts[1]))
+	}
+	return aliases, nil
+}
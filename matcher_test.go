@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestFillMissingStops(t *testing.T) {
+	progs := []Programme{
+		{Title: "B", Start: "20251102200000 +0530"},
+		{Title: "Bad", Start: "not a time"},
+		{Title: "A", Start: "20251102190000 +0530", Stop: "bogus"},
+		// Across midnight, and in another offset
+		{Title: "C", Start: "20251102233000 +0530"},
+		{Title: "D", Start: "20251102190000 +0000", Stop: "20251102200000 +0000"},
+		{Title: "E", Start: "20251103013000 +0530"},
+	}
+	filled := fillMissingStops(progs)
+
+	want := []struct {
+		title, stop string
+	}{
+		{"A", "20251102200000 +0530"},
+		{"B", "20251102233000 +0530"},
+		{"C", "20251102190000 +0000"},
+		{"D", "20251102200000 +0000"},
+		// The last valid programme has no next start to borrow
+		{"E", ""},
+		{"Bad", ""},
+	}
+	if filled != 3 {
+		t.Errorf("filled %d stops, want 3", filled)
+	}
+	for i, w := range want {
+		if progs[i].Title != w.title || progs[i].Stop != w.stop {
+			t.Errorf("programme %d = %s stopping %q, want %s stopping %q", i, progs[i].Title, progs[i].Stop, w.title, w.stop)
+		}
+	}
+}
+
+func TestFillMissingStopsSameStart(t *testing.T) {
+	progs := []Programme{
+		{Title: "A", Start: "20251102190000 +0530"},
+		{Title: "B", Start: "20251102190000 +0530"},
+	}
+	if filled := fillMissingStops(progs); filled != 0 {
+		t.Errorf("filled %d stops, want 0: a programme cannot end as it starts", filled)
+	}
+}
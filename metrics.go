@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metricFamily is one Prometheus metric with its samples, each a complete
+// exposition line such as `epg_source_up{provider="Jio"} 1`.
+type metricFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []string
+}
+
+func gauge(name, help string, samples ...string) metricFamily {
+	return metricFamily{Name: name, Help: help, Type: "gauge", Samples: samples}
+}
+
+func sample(name string, value float64, labels ...string) string {
+	if len(labels) == 0 {
+		return name + " " + strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return fmt.Sprintf("%s{%s} %s", name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// runMetricFamilies describes a finished run. Every run reports its outcome,
+// duration and downloads; the last-success time only comes with a successful
+// run and the channel counts only with a full run that generated outputs, so
+// consumers that merge by metric name (the Pushgateway with POST, `epg
+// serve`) keep the previous values across failed and unchanged runs.
+func runMetricFamilies(run RunFinished) []metricFamily {
+	finished := run.Started.Add(run.Duration)
+	families := []metricFamily{
+		gauge("epg_run_success", "Whether the last run succeeded.", sample("epg_run_success", boolValue(run.Err == nil))),
+		gauge("epg_run_unchanged", "Whether the last run was skipped because feeds and configuration were unchanged.", sample("epg_run_unchanged", boolValue(run.Unchanged))),
+		gauge("epg_run_duration_seconds", "How long the last run took.", sample("epg_run_duration_seconds", run.Duration.Seconds())),
+		gauge("epg_run_timestamp_seconds", "When the last run finished, in Unix time.", sample("epg_run_timestamp_seconds", float64(finished.Unix()))),
+		gauge("epg_run_throttled_responses", "Rate-limited responses during the last run.", sample("epg_run_throttled_responses", float64(run.Throttled))),
+	}
+
+	warnings := gauge("epg_run_warnings", "Warnings of the last run, by code (see warnings.go).")
+	counts := warningCounts(run.Warnings)
+	codes := make([]string, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		warnings.Samples = append(warnings.Samples, sample(warnings.Name, float64(counts[code]), "code", code))
+	}
+	if len(warnings.Samples) > 0 {
+		families = append(families, warnings)
+	}
+
+	if len(run.Sources) > 0 {
+		up := gauge("epg_source_up", "Whether the feed downloaded in the last run.")
+		programmes := gauge("epg_source_programmes", "Programmes in the feed.")
+		duration := gauge("epg_source_fetch_duration_seconds", "How long the feed took to download and parse.")
+		for _, source := range run.Sources {
+			up.Samples = append(up.Samples, sample(up.Name, boolValue(source.Err == nil), "provider", source.Provider))
+			duration.Samples = append(duration.Samples, sample(duration.Name, source.Duration.Seconds(), "provider", source.Provider))
+			if source.Err == nil {
+				programmes.Samples = append(programmes.Samples, sample(programmes.Name, float64(source.Programmes), "provider", source.Provider))
+			}
+		}
+		families = append(families, up, duration)
+		if len(programmes.Samples) > 0 {
+			families = append(families, programmes)
+		}
+	}
+
+	if run.Err != nil {
+		return families
+	}
+	families = append(families, gauge("epg_run_last_success_timestamp_seconds", "When the last successful run finished, in Unix time.", sample("epg_run_last_success_timestamp_seconds", float64(finished.Unix()))))
+	if run.Unchanged || run.Partial {
+		return families
+	}
+	return append(families,
+		gauge("epg_channels_processed", "Filter rules processed by the last generating run.", sample("epg_channels_processed", float64(run.Processed))),
+		gauge("epg_channels_skipped", "Filter rules that matched no channel or had no schedule.", sample("epg_channels_skipped", float64(run.Skipped))),
+		gauge("epg_files_saved", "Channel files written by the last generating run.",
+			sample("epg_files_saved", float64(run.SavedToday), "day", "today"),
+			sample("epg_files_saved", float64(run.SavedTomorrow), "day", "tomorrow")),
+	)
+}
+
+// formatMetrics renders families in the Prometheus text exposition format.
+func formatMetrics(families []metricFamily) []byte {
+	var buf bytes.Buffer
+	for _, family := range families {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", family.Name, family.Help, family.Name, family.Type)
+		for _, line := range family.Samples {
+			buf.WriteString(line + "\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// pushMetrics sends a run's metrics to a Prometheus Pushgateway under the
+// given job. It POSTs, so metrics this run does not report keep their
+// previous values.
+func pushMetrics(gateway, job string, run RunFinished) error {
+	target := strings.TrimSuffix(gateway, "/") + "/metrics/job/" + url.PathEscape(job)
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(formatMetrics(runMetricFamilies(run))))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	return nil
+}
+
+// runMetricsRegistry keeps the metrics of the daemon's runs for /metrics,
+// merging each run by metric name the way the Pushgateway does.
+type runMetricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]metricFamily
+}
+
+func (r *runMetricsRegistry) record(run RunFinished) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.families == nil {
+		r.families = make(map[string]metricFamily)
+	}
+	for _, family := range runMetricFamilies(run) {
+		r.families[family.Name] = family
+	}
+}
+
+// snapshot returns the latest family of each metric.
+func (r *runMetricsRegistry) snapshot() []metricFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	families := make([]metricFamily, 0, len(r.families))
+	for _, family := range r.families {
+		families = append(families, family)
+	}
+	return families
+}
+
+// handleMetrics serves the daemon's run metrics together with the request
+// metrics of the access log.
+func (s *guideServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	families := append(s.metrics.snapshot(), s.access.families()...)
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(formatMetrics(families))
+}
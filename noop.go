@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// FeedValidators is what a run remembers about a feed to tell whether the
+// next run gets the same data: the HTTP validators and a hash of the body,
+// for servers that send neither ETag nor Last-Modified.
+type FeedValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	SHA256       string `json:"sha256"`
+}
+
+// downloadFeed fetches and parses url, conditionally when previous has
+// validators. unchanged reports a 304 or a body identical to last time; the
+// feed is nil after a 304, unless cache has a copy. With a copy in cache,
+// its validators are sent instead of previous, and a 304 is answered from
+// it; a full download replaces it. A download an earlier run broke off is
+// resumed rather than started again (see feedDiskCache.resume). Runs
+// sharing the cache take turns at a feed (see feedDiskCache.lock).
+func downloadFeed(url string, previous FeedValidators, cache feedDiskCache) (tv *TV, validators FeedValidators, unchanged bool, err error) {
+	unlock, err := cache.lock(url)
+	if err != nil {
+		return nil, previous, false, err
+	}
+	defer unlock()
+	if cached, found := cache.load(url); found {
+		previous = cached
+	}
+	resp, resumed := cache.resume(url)
+	if !resumed {
+		header := make(http.Header)
+		if previous.ETag != "" {
+			header.Set("If-None-Match", previous.ETag)
+		}
+		if previous.LastModified != "" {
+			header.Set("If-Modified-Since", previous.LastModified)
+		}
+		if resp, err = httpGet(url, header); err != nil {
+			return nil, previous, false, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		if _, found := cache.load(url); !found {
+			return nil, previous, true, nil
+		}
+		body, err := cache.read(url)
+		if err == nil {
+			tv, err = decodeEPGWithin(url, bytes.NewReader(body))
+		}
+		if err != nil {
+			logMessage(fmt.Sprintf("   ⚠️  Cached copy of %s unreadable (%v), downloading it again", url, err))
+			return downloadFeed(url, FeedValidators{}, feedDiskCache{})
+		}
+		logMessage("   ♻️  Not modified upstream, read from the feed cache")
+		return tv, previous, true, nil
+	}
+
+	body, err := cache.readBody(url, resp)
+	if err != nil {
+		return nil, previous, false, err
+	}
+	sum := sha256.Sum256(body)
+	validators = FeedValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		SHA256:       hex.EncodeToString(sum[:]),
+	}
+	if tv, err = decodeEPGWithin(url, bytes.NewReader(body)); err != nil {
+		return nil, previous, false, err
+	}
+	if err := cache.save(url, body, validators); err != nil {
+		logMessage(fmt.Sprintf("   ⚠️  Could not cache %s: %v", url, err))
+	}
+	return tv, validators, previous.SHA256 != "" && validators.SHA256 == previous.SHA256, nil
+}
+
+// inputsFingerprint hashes everything besides the feeds that decides a run's
+// output: the configuration files and lineups, the options (except where
+// notifications go and the log file), the day being generated and the
+// build. Two runs with the same fingerprint and unchanged feeds write the
+// same files.
+func inputsFingerprint(opts *GenerateOptions, today time.Time) string {
+	h := sha256.New()
+	io.WriteString(h, today.Format("2006-01-02")+"\n")
+
+	settings := *opts
+	settings.Force = false
+	settings.SlackWebhook, settings.Pushgateway, settings.LogFile = "", "", ""
+	if data, err := json.Marshal(settings); err == nil {
+		h.Write(data)
+	}
+	files := []string{opts.FilterFile, opts.AliasFile, opts.ChannelIDFile, opts.LogoFile, opts.OverlapFile, opts.CatchupFile, opts.SourcesFile}
+	lineups, _ := filepath.Glob(filepath.Join(opts.LineupDir, "*.txt"))
+	for _, file := range append(files, lineups...) {
+		data, _ := os.ReadFile(file)
+		io.WriteString(h, "\n"+file+"\n")
+		h.Write(data)
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				io.WriteString(h, "\n"+setting.Key+"="+setting.Value)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// outputsPresent reports whether the previous run's files are still where
+// this run would write them. Only local directories and zip archives can be
+// checked; other outputs always regenerate.
+func outputsPresent(target string) bool {
+	switch {
+	case strings.HasPrefix(target, "zip://"):
+		_, err := os.Stat(strings.TrimPrefix(target, "zip://"))
+		return err == nil
+	case strings.Contains(target, "://"):
+		return false
+	}
+	_, err := os.Stat(filepath.Join(target, manifestFile))
+	return err == nil
+}
+
+// probeSources asks every feed whether it changed since the validators
+// recorded by the last run. It returns the feeds it downloaded in the
+// process, so the run need not fetch them again, their new validators, and
+// whether every feed was unchanged. Sources other than XMLTV feeds cannot
+// tell, so they count as changed.
+func probeSources(providers []Provider, store *StateStore, cache feedDiskCache) (map[string]*TV, map[string]FeedValidators, bool) {
+	fetched := make(map[string]*TV)
+	validators := make(map[string]FeedValidators)
+	for _, provider := range providers {
+		previous, found := store.FeedValidators(provider.URL)
+		if !found || !provider.isXMLTV() {
+			return fetched, validators, false
+		}
+		tv, current, unchanged, err := downloadFeed(provider.URL, previous, cache)
+		if err != nil {
+			return fetched, validators, false
+		}
+		validators[provider.URL] = current
+		if tv != nil {
+			fetched[provider.URL] = tv
+		}
+		if !unchanged {
+			return fetched, validators, false
+		}
+	}
+	return fetched, validators, true
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// Airing is a programme with resolved start and end instants.
+type Airing struct {
+	ProgramJSON
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// airings resolves the 12-hour times of a day's schedule into instants. A
+// programme whose end is not after its start crosses midnight; for the first
+// programme that means it began the previous evening. The schedule's own
+// timezone, when it has one, replaces loc.
+func airings(schedule *ChannelJSON, loc *time.Location) []Airing {
+	if schedule.Timezone != "" {
+		if tz, err := time.LoadLocation(schedule.Timezone); err == nil {
+			loc = tz
+		}
+	}
+	day, err := time.ParseInLocation("2006-01-02", schedule.Date, loc)
+	if err != nil {
+		return nil
+	}
+
+	result := make([]Airing, 0, len(schedule.Programs))
+	for i, prog := range schedule.Programs {
+		start, errStart := time.ParseInLocation("03:04 PM", prog.StartTime, loc)
+		end, errEnd := time.ParseInLocation("03:04 PM", prog.EndTime, loc)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		startAt := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		endAt := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+		if !endAt.After(startAt) {
+			if i == 0 {
+				startAt = startAt.AddDate(0, 0, -1)
+			} else {
+				endAt = endAt.AddDate(0, 0, 1)
+			}
+		}
+		result = append(result, Airing{ProgramJSON: prog, Start: startAt, End: endAt})
+	}
+	return result
+}
+
+// nowAndNext finds the programme airing at now and the one after it, looking
+// at the schedules of now's date and the day before.
+func nowAndNext(days map[string]*ChannelJSON, now time.Time, loc *time.Location) (*Airing, *Airing) {
+	var current, next *Airing
+	for _, date := range []string{now.AddDate(0, 0, -1).Format("2006-01-02"), now.Format("2006-01-02"), now.AddDate(0, 0, 1).Format("2006-01-02")} {
+		schedule, exists := days[date]
+		if !exists {
+			continue
+		}
+		for _, airing := range airings(schedule, loc) {
+			airing := airing
+			if !airing.Start.After(now) && airing.End.After(now) {
+				current = &airing
+			} else if airing.Start.After(now) && (next == nil || airing.Start.Before(next.Start)) {
+				next = &airing
+			}
+		}
+	}
+	return current, next
+}
+
+// ChannelNow is the now/next summary for one channel.
+type ChannelNow struct {
+	ChannelID   string  `json:"channel_id"`
+	ChannelName string  `json:"channel_name"`
+	Slug        string  `json:"slug"`
+	Now         *Airing `json:"now"`
+	Next        *Airing `json:"next"`
+}
+
+func (s *guideServer) channelNow(guide *Guide, channel string, now time.Time) (ChannelNow, bool) {
+	slug, days := guide.lookup(channel)
+	if days == nil {
+		return ChannelNow{}, false
+	}
+	summary := ChannelNow{Slug: slug}
+	for _, schedule := range days {
+		summary.ChannelID = schedule.ChannelID
+		summary.ChannelName = schedule.ChannelName
+		break
+	}
+	summary.Now, summary.Next = nowAndNext(days, now, s.loc)
+	return summary, true
+}
+
+// LiveProgramme is the compact programme form used by /now.
+type LiveProgramme struct {
+	ShowName string `json:"show_name"`
+	ShowLogo string `json:"show_logo,omitempty"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	// Progress is the elapsed share of the programme in percent, set for
+	// the programme on air.
+	Progress *int `json:"progress,omitempty"`
+}
+
+// LiveChannel is one channel's entry in /now.
+type LiveChannel struct {
+	ChannelID   string         `json:"channel_id"`
+	ChannelName string         `json:"channel_name"`
+	ChannelLogo string         `json:"channel_logo,omitempty"`
+	Slug        string         `json:"slug"`
+	Now         *LiveProgramme `json:"now"`
+	Next        *LiveProgramme `json:"next"`
+}
+
+func liveProgramme(airing *Airing, now time.Time) *LiveProgramme {
+	if airing == nil {
+		return nil
+	}
+	live := &LiveProgramme{
+		ShowName: airing.ShowName,
+		ShowLogo: airing.ShowLogo,
+		Start:    airing.Start.Format(time.RFC3339),
+		End:      airing.End.Format(time.RFC3339),
+	}
+	if !airing.Start.After(now) && airing.End.After(now) {
+		progress := int(now.Sub(airing.Start) * 100 / airing.End.Sub(airing.Start))
+		live.Progress = &progress
+	}
+	return live
+}
+
+// handleNow returns what is on now and next on every channel in one
+// response, for "Live Now" rails.
+func (s *guideServer) handleNow(w http.ResponseWriter, r *http.Request) {
+	guide := s.guide.Load()
+	now := time.Now().In(s.loc)
+
+	channels := make([]LiveChannel, 0, len(guide.Schedules))
+	for _, slug := range guide.slugs() {
+		days := guide.Schedules[slug]
+		entry := LiveChannel{Slug: slug}
+		for _, schedule := range days {
+			entry.ChannelID = schedule.ChannelID
+			entry.ChannelName = schedule.ChannelName
+			entry.ChannelLogo = schedule.ChannelLogo
+			break
+		}
+		current, next := nowAndNext(days, now, s.loc)
+		entry.Now = liveProgramme(current, now)
+		entry.Next = liveProgramme(next, now)
+		channels = append(channels, entry)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"time":     now.Format(time.RFC3339),
+		"channels": channels,
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lastCopy returns url's cached copy and when it was downloaded, whether or
+// not the server gave validators for it.
+func (c feedDiskCache) lastCopy(url string) (*TV, time.Time, error) {
+	if c.dir == "" {
+		return nil, time.Time{}, fmt.Errorf("no --feed-cache to read it from")
+	}
+	body, _ := c.paths(url)
+	info, err := os.Stat(body)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, fmt.Errorf("no cached copy in %s", c.dir)
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	tv, err := decodeEPGWithin(url, bytes.NewReader(data))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return tv, info.ModTime(), nil
+}
+
+// lastCopyFeed stands the feed cache's last copy of provider's feed in for a
+// download: always with --offline, and otherwise when downloadErr says the
+// download failed. The copy's time is recorded in stale, so the channels
+// built from it are marked stale_since. With no copy, the download error
+// stands.
+func lastCopyFeed(provider Provider, cache feedDiskCache, offline bool, downloadErr error, stale map[string]time.Time) (*TV, error) {
+	tv, cachedAt, err := cache.lastCopy(provider.URL)
+	if err != nil {
+		if offline {
+			return nil, fmt.Errorf("offline: %v", err)
+		}
+		return nil, downloadErr
+	}
+	runMu.Lock()
+	stale[provider.Name] = cachedAt
+	runMu.Unlock()
+	if offline {
+		logMessage(fmt.Sprintf("   📴 Offline: read the copy downloaded %s", cachedAt.Format(time.RFC3339)))
+		return tv, nil
+	}
+	warn(warnCachedFeed, provider.Name, fmt.Sprintf("   📴 %s could not be downloaded (%v); using the copy downloaded %s ago", provider.Label, downloadErr, time.Since(cachedAt).Round(time.Minute)))
+	return tv, nil
+}
+
+// staleSince is the oldest cached copy a schedule built from providers was
+// read from, or "" when every feed it used was fresh.
+func staleSince(providers []ProviderRef, stale map[string]time.Time) string {
+	var oldest time.Time
+	for _, ref := range providers {
+		if cachedAt, found := stale[ref.Source]; found && (oldest.IsZero() || cachedAt.Before(oldest)) {
+			oldest = cachedAt
+		}
+	}
+	if oldest.IsZero() {
+		return ""
+	}
+	return oldest.Format(time.RFC3339)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutputFS is where generated files are written. Names are slash-separated
+// paths relative to the output root, such as "output-today/sony-sab.json".
+type OutputFS interface {
+	WriteFile(name string, data []byte) error
+	// RemoveAll deletes everything under dir, where the backend supports it.
+	RemoveAll(dir string) error
+	Close() error
+}
+
+// openOutput selects a backend from an --output value:
+//
+//	.  or  /some/dir          local directory (default ".")
+//	mem://                    in memory
+//	zip://guide.zip           a single zip archive
+//	s3://bucket/prefix        an S3-compatible bucket
+func openOutput(target string) (OutputFS, error) {
+	switch {
+	case target == "mem://":
+		return newMemFS(), nil
+	case strings.HasPrefix(target, "zip://"):
+		return newZipFS(strings.TrimPrefix(target, "zip://"))
+	case strings.HasPrefix(target, "s3://"):
+		return newS3FS(strings.TrimPrefix(target, "s3://"))
+	case strings.Contains(target, "://"):
+		return nil, fmt.Errorf("unsupported output %q", target)
+	}
+	return localFS{root: target}, nil
+}
+
+// localFS writes below a directory on disk.
+type localFS struct {
+	root string
+}
+
+func (l localFS) WriteFile(name string, data []byte) error {
+	p := filepath.Join(l.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// ReadFile reads back a previously written file.
+func (l localFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(l.root, filepath.FromSlash(name)))
+}
+
+func (l localFS) RemoveAll(dir string) error {
+	return os.RemoveAll(filepath.Join(l.root, filepath.FromSlash(dir)))
+}
+
+func (l localFS) Close() error { return nil }
+
+// MemFS keeps outputs in memory, for embedding or inspecting a run without
+// touching the disk.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newMemFS() *MemFS {
+	return &MemFS{files: make(map[string][]byte)}
+}
+
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for name := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			delete(m.files, name)
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Close() error { return nil }
+
+// Files returns the written file names in sorted order.
+func (m *MemFS) Files() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadFile returns a written file's contents.
+func (m *MemFS) ReadFile(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, exists := m.files[name]
+	return data, exists
+}
+
+// zipEpoch is the modification time stamped on every zip entry, so that
+// archives with the same contents are byte-for-byte identical. It is the
+// earliest time the zip format can represent.
+var zipEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// zipFS streams every file into one zip archive, finalized on Close. Entries
+// appear in the order they are written, which follows filter.txt, and carry
+// fixed timestamps and permissions. The archive is written next to its final
+// name and moved into place on Close, so readers never see a partial one.
+type zipFS struct {
+	filename string
+	file     *os.File
+	zw       *zip.Writer
+	closed   bool
+}
+
+func newZipFS(filename string) (*zipFS, error) {
+	if filename == "" {
+		return nil, fmt.Errorf("zip output needs a file name, e.g. zip://epg.zip")
+	}
+	f, err := os.Create(filename + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &zipFS{filename: filename, file: f, zw: zip.NewWriter(f)}, nil
+}
+
+func (z *zipFS) WriteFile(name string, data []byte) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: zipEpoch}
+	header.SetMode(0644)
+	w, err := z.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// RemoveAll is a no-op: the archive is created empty.
+func (z *zipFS) RemoveAll(dir string) error { return nil }
+
+func (z *zipFS) Close() error {
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+	err := z.zw.Close()
+	if closeErr := z.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(z.file.Name())
+		return err
+	}
+	return os.Rename(z.file.Name(), z.filename)
+}
+
+// s3FS uploads each file with a SigV4-signed PUT. Credentials come from
+// AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY (and optional AWS_SESSION_TOKEN),
+// the region from AWS_REGION (default us-east-1), and S3_ENDPOINT selects an
+// S3-compatible service such as MinIO or R2 (path-style addressing).
+type s3FS struct {
+	bucket    string
+	prefix    string
+	endpoint  string
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+	client    *http.Client
+}
+
+func newS3FS(target string) (*s3FS, error) {
+	bucket, prefix, _ := strings.Cut(target, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 output needs a bucket, e.g. s3://my-bucket/epg")
+	}
+	s := &s3FS{
+		bucket:    bucket,
+		prefix:    strings.Trim(prefix, "/"),
+		region:    os.Getenv("AWS_REGION"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		endpoint:  strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+		client:    &http.Client{Timeout: 60 * time.Second},
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.endpoint == "" {
+		s.endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.region)
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("s3 output needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+func (s *s3FS) WriteFile(name string, data []byte) error {
+	key := path.Join(s.prefix, name)
+	req, err := http.NewRequest(http.MethodPut, s.endpoint+"/"+s.bucket+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeFor(name))
+	s.sign(req, data, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 PUT %s: %s %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// RemoveAll is a no-op: objects are overwritten in place, and stale ones are
+// left for bucket lifecycle rules.
+func (s *s3FS) RemoveAll(dir string) error { return nil }
+
+func (s *s3FS) Close() error { return nil }
+
+// sign adds an AWS Signature Version 4 Authorization header.
+func (s *s3FS) sign(req *http.Request, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if s.token != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		value := req.Header.Get(h)
+		if h == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func contentTypeFor(name string) string {
+	switch path.Ext(name) {
+	case ".json":
+		return "application/json"
+	case ".html":
+		return "text/html; charset=utf-8"
+	case ".xml":
+		return "application/xml"
+	}
+	return "application/octet-stream"
+}
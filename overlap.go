@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Overlap strategies decide what is published for a channel that more than
+// one source carries.
+const (
+	// overlapPreferPriority keeps the first match, in strategy then provider
+	// order.
+	overlapPreferPriority = "prefer-priority"
+	// overlapPreferCoverage keeps the source with the most airtime listed
+	// for the days being generated.
+	overlapPreferCoverage = "prefer-coverage"
+	// overlapMerge takes each day from the source listing the most airtime
+	// that day, fills its gaps with programmes from the other sources that
+	// do not overlap it, and fills in missing descriptions and images from
+	// the same slot in another source. It is the default.
+	overlapMerge = "merge"
+)
+
+func parseOverlapStrategy(value string) (string, error) {
+	switch strategy := strings.ToLower(strings.TrimSpace(value)); strategy {
+	case overlapPreferPriority, overlapPreferCoverage, overlapMerge:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown overlap strategy %q (want %s, %s or %s)", value, overlapPreferPriority, overlapPreferCoverage, overlapMerge)
+}
+
+// loadOverlapRules reads per-channel `channel = strategy` overrides, keyed by
+// normalized channel name (as written in filter.txt, or the output name). A
+// missing file yields no overrides.
+func loadOverlapRules(filename string) (map[string]string, error) {
+	rules := make(map[string]string)
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		strategy, err := parseOverlapStrategy(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		rules[normalizeChannelName(strings.TrimSpace(parts[0]))] = strategy
+	}
+	return rules, nil
+}
+
+// overlapStrategyFor returns the strategy for rule: its override if it has
+// one, else the global strategy.
+func overlapStrategyFor(rule FilterRule, global string, overrides map[string]string) string {
+	if strategy, exists := overrides[normalizeChannelName(rule.OriginalName)]; exists {
+		return strategy
+	}
+	if strategy, exists := overrides[normalizeChannelName(rule.OutputName)]; exists {
+		return strategy
+	}
+	return global
+}
+
+// exactStrategies are the match strategies that find the channel a rule
+// names and no other. resolveOverlap only combines the primary match with
+// channels they find in the other sources, so a substring or token match
+// never brings in another channel's programmes.
+var exactStrategies = map[string]bool{"id": true, "chno": true, "alias": true, "name": true, "cache": true}
+
+// resolveOverlap looks the rule up in the sources other than primary's and,
+// when the channel is found there too by an exact strategy, applies
+// strategy. lookup must not be interactive. The window bounds the airtime
+// compared by prefer-coverage; tolerance is how close merge puts
+// near-duplicates it collapses.
+func resolveOverlap(strategy string, primary *Match, rule FilterRule, lookup Matcher, sources []*EPGSource, windowStart, windowEnd time.Time, loc *time.Location, tolerance time.Duration) *Match {
+	primary.Overlap = strategy
+	if strategy == overlapPreferPriority {
+		return primary
+	}
+
+	candidates := []*Match{primary}
+	for _, src := range sources {
+		if src.Name == primary.Source {
+			continue
+		}
+		match := lookup.Match(rule, []*EPGSource{src})
+		if match == nil {
+			continue
+		}
+		if !exactStrategies[match.Strategy] {
+			logMessage(fmt.Sprintf("   ⏭️  Not combining with %s's %s: found only by %s matching", src.Name, match.Channel.DisplayName, match.Strategy))
+			continue
+		}
+		candidates = append(candidates, match)
+	}
+	if len(candidates) == 1 {
+		return primary
+	}
+
+	coverage := make([]time.Duration, len(candidates))
+	others := make([]string, 0, len(candidates)-1)
+	for i, candidate := range candidates {
+		coverage[i] = airtime(candidate.Programmes, windowStart, windowEnd, loc)
+		if i > 0 {
+			others = append(others, fmt.Sprintf("%s (%.1fh)", candidate.Source, coverage[i].Hours()))
+		}
+	}
+	logMessage(fmt.Sprintf("   🔀 Also in %s; %s has %.1fh", strings.Join(others, ", "), primary.Source, coverage[0].Hours()))
+
+	switch strategy {
+	case overlapPreferCoverage:
+		best := 0
+		for i := range candidates {
+			if coverage[i] > coverage[best] {
+				best = i
+			}
+		}
+		winner := *candidates[best]
+		winner.Overlap = strategy
+		return &winner
+
+	case overlapMerge:
+		return mergeCandidates(candidates, windowStart, windowEnd, loc, tolerance)
+	}
+	return primary
+}
+
+// mergeCandidates builds one schedule from the candidates, which are in
+// priority order. Each day of the window starts from the candidate with the
+// most airtime that day, ties going to the higher priority; the gaps left are
+// filled from the others in priority order, and programmes without a
+// description or image get them from a programme starting at the same time
+// in another candidate. A programme of one candidate that another already
+// lists under the same title within tolerance (see nearDuplicate) is
+// collapsed into that listing. provider_ids lists every contributor.
+func mergeCandidates(candidates []*Match, windowStart, windowEnd time.Time, loc *time.Location, tolerance time.Duration) *Match {
+	merged := *candidates[0]
+	merged.Programmes = make([]Programme, 0, len(candidates[0].Programmes))
+	contributed := make([]int, len(candidates))
+	refs := make([]ProviderRef, len(candidates))
+	for i, candidate := range candidates {
+		refs[i] = ProviderRef{Source: candidate.Source, ID: candidate.Channel.ID}
+	}
+	collapsed := 0
+	fill := func(extra []Programme) int {
+		added, duplicates := fillGaps(&merged.Programmes, extra, loc, tolerance)
+		for _, pair := range duplicates {
+			collapsedProgrammes = append(collapsedProgrammes, CollapsedProgramme{
+				Channel: merged.Channel.DisplayName,
+				Title:   pair.kept.Title,
+				Kept:    programmeSource(refs, pair.kept) + " " + pair.kept.Start + "–" + pair.kept.Stop,
+				Dropped: programmeSource(refs, pair.dropped) + " " + pair.dropped.Start + "–" + pair.dropped.Stop,
+			})
+		}
+		collapsed += len(duplicates)
+		return added
+	}
+
+	for day := windowStart; day.Before(windowEnd); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		best, bestAirtime := 0, airtime(candidates[0].Programmes, day, next, loc)
+		for i, candidate := range candidates[1:] {
+			if covered := airtime(candidate.Programmes, day, next, loc); covered > bestAirtime {
+				best, bestAirtime = i+1, covered
+			}
+		}
+		if best != 0 {
+			logMessage(fmt.Sprintf("   📅 %s: %s lists the most (%.1fh)", day.Format("2006-01-02"), candidates[best].Source, bestAirtime.Hours()))
+		}
+		contributed[best] += fill(programmesDuring(candidates[best].Programmes, day, next, loc))
+	}
+	for i, candidate := range candidates {
+		added := fill(candidate.Programmes)
+		contributed[i] += added
+		if added > 0 && i > 0 {
+			logMessage(fmt.Sprintf("   🧩 Merged %d programmes from %s", added, candidate.Source))
+		}
+	}
+
+	if collapsed > 0 {
+		logMessage(fmt.Sprintf("   🪞 Collapsed %d near-duplicate programmes listed by more than one source (see detailed log)", collapsed))
+	}
+
+	details := 0
+	for i := range merged.Programmes {
+		prog := &merged.Programmes[i]
+		if strings.TrimSpace(prog.Desc) != "" && len(prog.Icons) > 0 {
+			continue
+		}
+		for c, candidate := range candidates {
+			if slot, found := sameSlot(candidate.Programmes, *prog, loc); found && slot.Channel != prog.Channel {
+				filled := false
+				if strings.TrimSpace(prog.Desc) == "" && strings.TrimSpace(slot.Desc) != "" {
+					prog.Desc, filled = slot.Desc, true
+				}
+				if len(prog.Icons) == 0 && len(slot.Icons) > 0 {
+					prog.Icons, filled = slot.Icons, true
+				}
+				if filled {
+					contributed[c]++
+					details++
+				}
+			}
+		}
+	}
+	if details > 0 {
+		logMessage(fmt.Sprintf("   ✨ Filled in descriptions or images of %d programmes from the other sources", details))
+	}
+
+	merged.Providers = make([]ProviderRef, 0, len(candidates))
+	for i := range candidates {
+		if i == 0 || contributed[i] > 0 {
+			merged.Providers = append(merged.Providers, refs[i])
+		}
+	}
+	return &merged
+}
+
+// programmesDuring returns the programmes airing at some point in
+// [start, end).
+func programmesDuring(programmes []Programme, start, end time.Time, loc *time.Location) []Programme {
+	during := make([]Programme, 0)
+	for _, prog := range programmes {
+		progStart, errStart := parseEPGTime(prog.Start, loc)
+		progEnd, errEnd := parseEPGTime(prog.Stop, loc)
+		if errStart == nil && errEnd == nil && progStart.Before(end) && progEnd.After(start) {
+			during = append(during, prog)
+		}
+	}
+	return during
+}
+
+// sameSlot finds the programme in programmes starting when prog does.
+func sameSlot(programmes []Programme, prog Programme, loc *time.Location) (Programme, bool) {
+	start, err := parseEPGTime(prog.Start, loc)
+	if err != nil {
+		return Programme{}, false
+	}
+	for _, other := range programmes {
+		if otherStart, err := parseEPGTime(other.Start, loc); err == nil && otherStart.Equal(start) {
+			return other, true
+		}
+	}
+	return Programme{}, false
+}
+
+// airtime sums how much of [start, end) the programmes cover.
+func airtime(programmes []Programme, start, end time.Time, loc *time.Location) time.Duration {
+	var total time.Duration
+	for _, prog := range programmes {
+		progStart, errStart := parseEPGTime(prog.Start, loc)
+		progEnd, errEnd := parseEPGTime(prog.Stop, loc)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		if progStart.Before(start) {
+			progStart = start
+		}
+		if progEnd.After(end) {
+			progEnd = end
+		}
+		if progEnd.After(progStart) {
+			total += progEnd.Sub(progStart)
+		}
+	}
+	return total
+}
+
+// CollapsedProgramme is a programme merge left out as a near-duplicate of
+// one another source already listed, for the detailed log. Kept and Dropped
+// give each copy's source and times.
+type CollapsedProgramme struct {
+	Channel string
+	Title   string
+	Kept    string
+	Dropped string
+}
+
+var collapsedProgrammes []CollapsedProgramme
+
+// duplicatePair is a programme fillGaps collapsed into one already in base.
+type duplicatePair struct {
+	kept, dropped Programme
+}
+
+// fillGaps appends the extra programmes that do not overlap any programme
+// already in base, returning how many were added. Near-duplicates of a
+// programme in base are not added but collapsed into it, filling in its
+// description and images when it has none, and returned.
+func fillGaps(base *[]Programme, extra []Programme, loc *time.Location, tolerance time.Duration) (int, []duplicatePair) {
+	type span struct{ start, end time.Time }
+	taken := make([]span, 0, len(*base))
+	for _, prog := range *base {
+		start, errStart := parseEPGTime(prog.Start, loc)
+		end, errEnd := parseEPGTime(prog.Stop, loc)
+		if errStart == nil && errEnd == nil {
+			taken = append(taken, span{start, end})
+		}
+	}
+
+	added := 0
+	duplicates := make([]duplicatePair, 0)
+	for _, prog := range extra {
+		start, errStart := parseEPGTime(prog.Start, loc)
+		end, errEnd := parseEPGTime(prog.Stop, loc)
+		if errStart != nil || errEnd != nil || !end.After(start) {
+			continue
+		}
+		if i := nearDuplicate(*base, prog, start, end, loc, tolerance); i >= 0 {
+			kept := &(*base)[i]
+			if strings.TrimSpace(kept.Desc) == "" {
+				kept.Desc = prog.Desc
+			}
+			if len(kept.Icons) == 0 {
+				kept.Icons = prog.Icons
+			}
+			duplicates = append(duplicates, duplicatePair{kept: *kept, dropped: prog})
+			continue
+		}
+		overlaps := false
+		for _, s := range taken {
+			if start.Before(s.end) && end.After(s.start) {
+				overlaps = true
+				break
+			}
+		}
+		if overlaps {
+			continue
+		}
+		*base = append(*base, prog)
+		taken = append(taken, span{start, end})
+		added++
+	}
+	return added, duplicates
+}
+
+// nearDuplicate returns the index of the programme in base that prog, airing
+// from start to end, repeats, or -1. A repeat comes from another source
+// (another channel ID), has the same title, and airs within tolerance of the
+// other's times, such as the same news bulletin listed just after a
+// feed's copy of it because one feed's clock is off. Programmes whose
+// episode numbers differ are different episodes, even back to back.
+func nearDuplicate(base []Programme, prog Programme, start, end time.Time, loc *time.Location, tolerance time.Duration) int {
+	if tolerance <= 0 {
+		return -1
+	}
+	title := normalizeChannelName(prog.Title)
+	for i, other := range base {
+		if other.Channel == prog.Channel || title == "" || normalizeChannelName(other.Title) != title {
+			continue
+		}
+		if episode, otherEpisode := prog.episode(), other.episode(); episode != "" && otherEpisode != "" && episode != otherEpisode {
+			continue
+		}
+		otherStart, errStart := parseEPGTime(other.Start, loc)
+		otherEnd, errEnd := parseEPGTime(other.Stop, loc)
+		if errStart == nil && errEnd == nil && start.Before(otherEnd.Add(tolerance)) && end.After(otherStart.Add(-tolerance)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nonInteractive returns the chain without the prompt strategy, for looking
+// a rule up in further sources without asking again.
+func (c MatcherChain) nonInteractive() MatcherChain {
+	chain := make(MatcherChain, 0, len(c))
+	for _, m := range c {
+		if _, interactive := m.(promptMatcher); !interactive {
+			chain = append(chain, m)
+		}
+	}
+	return chain
+}
+
+// programmeSource names the provider a programme came from, for merged
+// schedules where providers differ between programmes.
+func programmeSource(providers []ProviderRef, prog Programme) string {
+	for _, ref := range providers {
+		if ref.ID == prog.Channel {
+			return ref.Source
+		}
+	}
+	return providers[0].Source
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pageFileName matches the second and later pages of a channel file:
+// "star-plus.2.json".
+var pageFileName = regexp.MustCompile(`^(.+)\.([2-9]|[1-9][0-9]+)\.json$`)
+
+// pageFile returns the file of page of a channel published as file: the
+// file itself for the first page, then "star-plus.2.json" and so on.
+func pageFile(file string, page int) string {
+	if page <= 1 {
+		return file
+	}
+	return strings.TrimSuffix(file, ".json") + "." + strconv.Itoa(page) + ".json"
+}
+
+// parsePageFile splits "star-plus.2.json" into the channel's slug and the
+// page number; other channel files are page 1.
+func parsePageFile(name string) (string, int) {
+	if m := pageFileName.FindStringSubmatch(name); m != nil {
+		page, _ := strconv.Atoi(m[2])
+		return m[1], page
+	}
+	return strings.TrimSuffix(name, ".json"), 1
+}
+
+// paginate splits a day's schedule into pages of at most max programmes
+// each, for --max-programmes, linked by next_page. A schedule that fits, or
+// max 0, stays one unnumbered file.
+func paginate(schedule ChannelJSON, max int, file string) []ChannelJSON {
+	if max <= 0 || len(schedule.Programs) <= max {
+		return []ChannelJSON{schedule}
+	}
+	count := (len(schedule.Programs) + max - 1) / max
+	pages := make([]ChannelJSON, 0, count)
+	for i := 0; i < count; i++ {
+		page := schedule
+		page.Programs = schedule.Programs[i*max : min((i+1)*max, len(schedule.Programs))]
+		page.Page, page.Pages = i+1, count
+		if i+1 < count {
+			page.NextPage = pageFile(file, i+2)
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// maxProgrammesFor is the page size of rule's files: its filter.yaml
+// max_programmes, or --max-programmes.
+func maxProgrammesFor(rule FilterRule, opts *GenerateOptions) int {
+	if rule.MaxProgrammes > 0 {
+		return rule.MaxProgrammes
+	}
+	return opts.MaxProgrammes
+}
+
+// joinPages puts a paginated day back together from its first page and the
+// later pages loaded alongside it. Only pages of the same date that the
+// first one counts are used, so pages left behind by a run that wrote fewer
+// are ignored.
+func joinPages(first *ChannelJSON, later []*ChannelJSON) *ChannelJSON {
+	sort.Slice(later, func(i, j int) bool { return later[i].Page < later[j].Page })
+	joined := *first
+	joined.Programs = append([]ProgramJSON(nil), first.Programs...)
+	if len(first.Descriptions) > 0 {
+		joined.Descriptions = make(map[string]string, len(first.Descriptions))
+		for key, text := range first.Descriptions {
+			joined.Descriptions[key] = text
+		}
+	}
+	for _, page := range later {
+		if page.Date != first.Date || page.Page > first.Pages {
+			continue
+		}
+		joined.Programs = append(joined.Programs, page.Programs...)
+		for key, text := range page.Descriptions {
+			if joined.Descriptions == nil {
+				joined.Descriptions = make(map[string]string)
+			}
+			joined.Descriptions[key] = text
+		}
+	}
+	joined.Page, joined.Pages, joined.NextPage = 0, 0, ""
+	return &joined
+}
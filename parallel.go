@@ -0,0 +1,36 @@
+package main
+
+import "sync"
+
+// runMu guards the per-run state that concurrent feed downloads add to: the
+// log, the warnings, the throttle events and the stale feeds.
+var runMu sync.Mutex
+
+// fetchProviders calls fetch for every provider, with at most concurrency
+// calls in flight, and returns the results in provider order, so what is
+// done with them afterwards does not depend on which feed finished first.
+// Downloads are mostly waiting on the network, so with 4-5 sources this
+// takes about as long as the slowest one rather than all of them together.
+func fetchProviders[T any](providers []Provider, concurrency int, fetch func(provider Provider) T) []T {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]T, len(providers))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(providers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = fetch(providers[i])
+			}
+		}()
+	}
+	for i := range providers {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
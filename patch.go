@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// patchSuffix names a channel file's patch: sony-sab.json gets
+// sony-sab.patch.json next to it.
+const patchSuffix = ".patch.json"
+
+// PatchOperation is one RFC 6902 JSON Patch operation.
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// MarshalJSON leaves the value out of remove operations only; added and
+// replaced values may themselves be null.
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	type plain PatchOperation
+	return json.Marshal(plain(op))
+}
+
+// patchFS writes an RFC 6902 patch next to every channel file it had a
+// previous copy of, taking that copy to the new one, so clients holding the
+// previous run's file can download the patch instead of the whole file.
+type patchFS struct {
+	OutputFS
+	previous map[string][]byte
+	written  int
+}
+
+// newPatchFS wraps out, reading the current copy of each named channel file
+// from the backend before the run replaces them. It reports false when the
+// backend cannot read files back, in which case no patches can be made.
+func newPatchFS(out, backend OutputFS, names []string) (*patchFS, bool) {
+	p := &patchFS{OutputFS: out, previous: make(map[string][]byte)}
+	reader, ok := backend.(interface {
+		ReadFile(name string) ([]byte, error)
+	})
+	if !ok {
+		return p, false
+	}
+	for _, name := range names {
+		if data, err := reader.ReadFile(name); err == nil {
+			p.previous[name] = data
+		}
+	}
+	return p, true
+}
+
+func (p *patchFS) WriteFile(name string, data []byte) error {
+	if err := p.OutputFS.WriteFile(name, data); err != nil {
+		return err
+	}
+	previous, exists := p.previous[name]
+	if !exists {
+		return nil
+	}
+	ops, err := jsonPatch(previous, data)
+	if err != nil {
+		return fmt.Errorf("patch for %s: %v", name, err)
+	}
+	patch, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	p.written++
+	return p.OutputFS.WriteFile(strings.TrimSuffix(name, ".json")+patchSuffix, patch)
+}
+
+// jsonPatch returns the operations taking the JSON document from to to. When
+// from has a date, the patch starts by testing it, so a client holding
+// another day's file fails to apply the patch instead of corrupting it.
+func jsonPatch(from, to []byte) ([]PatchOperation, error) {
+	var a, b any
+	if err := decodeJSONNumbers(from, &a); err != nil {
+		return nil, err
+	}
+	if err := decodeJSONNumbers(to, &b); err != nil {
+		return nil, err
+	}
+	ops := make([]PatchOperation, 0)
+	if object, ok := a.(map[string]any); ok {
+		if date, exists := object["date"]; exists {
+			ops = append(ops, PatchOperation{Op: "test", Path: "/date", Value: date})
+		}
+	}
+	return diffJSON("", a, b, ops), nil
+}
+
+func decodeJSONNumbers(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// diffJSON appends the operations taking a to b at path. Objects are
+// compared key by key and arrays by their longest common subsequence, so a
+// programme added or dropped mid-schedule costs one operation rather than
+// rewriting everything after it.
+func diffJSON(path string, a, b any, ops []PatchOperation) []PatchOperation {
+	switch a := a.(type) {
+	case map[string]any:
+		if b, ok := b.(map[string]any); ok {
+			return diffObjects(path, a, b, ops)
+		}
+	case []any:
+		if b, ok := b.([]any); ok {
+			return diffArrays(path, a, b, ops)
+		}
+	}
+	if !jsonEqual(a, b) {
+		ops = append(ops, PatchOperation{Op: "replace", Path: path, Value: b})
+	}
+	return ops
+}
+
+func diffObjects(path string, a, b map[string]any, ops []PatchOperation) []PatchOperation {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, exists := b[key]; exists {
+			ops = diffJSON(path+"/"+escapePointer(key), a[key], value, ops)
+		} else {
+			ops = append(ops, PatchOperation{Op: "remove", Path: path + "/" + escapePointer(key)})
+		}
+	}
+	added := make([]string, 0)
+	for key := range b {
+		if _, exists := a[key]; !exists {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+	for _, key := range added {
+		ops = append(ops, PatchOperation{Op: "add", Path: path + "/" + escapePointer(key), Value: b[key]})
+	}
+	return ops
+}
+
+func diffArrays(path string, a, b []any, ops []PatchOperation) []PatchOperation {
+	encodedA, encodedB := encodeElements(a), encodeElements(b)
+	equal := func(i, j int) bool { return encodedA[i] == encodedB[j] }
+
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if equal(i, j) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// index is the position in the array as patched so far
+	i, j, index := 0, 0, 0
+	for i < len(a) || j < len(b) {
+		at := fmt.Sprintf("%s/%d", path, index)
+		switch {
+		case i < len(a) && j < len(b) && equal(i, j):
+			i, j, index = i+1, j+1, index+1
+		case i < len(a) && j < len(b) && lcs[i+1][j+1] == lcs[i][j]:
+			// Neither element is kept: change one into the other
+			ops = diffJSON(at, a[i], b[j], ops)
+			i, j, index = i+1, j+1, index+1
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			ops = append(ops, PatchOperation{Op: "add", Path: at, Value: b[j]})
+			j, index = j+1, index+1
+		default:
+			ops = append(ops, PatchOperation{Op: "remove", Path: at})
+			i++
+		}
+	}
+	return ops
+}
+
+// encodeElements encodes each element once, for comparing arrays.
+func encodeElements(values []any) []string {
+	encoded := make([]string, len(values))
+	for i, value := range values {
+		data, _ := json.Marshal(value)
+		encoded[i] = string(data)
+	}
+	return encoded
+}
+
+func jsonEqual(a, b any) bool {
+	x, errA := json.Marshal(a)
+	y, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901).
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// extinfAttribute is one key="value" attribute of an #EXTINF line.
+var extinfAttribute = regexp.MustCompile(`([A-Za-z0-9_-]+)="([^"]*)"`)
+
+// isPlaylistFilter reports whether filename is an IPTV playlist used as the
+// filter.
+func isPlaylistFilter(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".m3u" || ext == ".m3u8"
+}
+
+// parsePlaylist makes a filter rule for every channel of an M3U playlist.
+// An entry matches on its tvg-id when a feed has that channel ID, and
+// otherwise on its tvg-name or title like a filter.txt name; it is written
+// to a slug of that name, or of the tvg-id when the name has no Latin
+// letters or digits. tvg-logo and group-title become the rule's logo and
+// serve group. Entries naming a channel already listed, such as the HD and
+// SD streams of one channel, are skipped.
+func parsePlaylist(data []byte) []FilterRule {
+	rules := make([]FilterRule, 0)
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		info, found := strings.CutPrefix(strings.TrimSpace(line), "#EXTINF:")
+		if !found {
+			continue
+		}
+		attributes := make(map[string]string)
+		for _, attribute := range extinfAttribute.FindAllStringSubmatch(info, -1) {
+			attributes[strings.ToLower(attribute[1])] = strings.TrimSpace(attribute[2])
+		}
+		// The title follows the first comma outside the attributes
+		_, title, _ := strings.Cut(extinfAttribute.ReplaceAllString(info, ""), ",")
+		title = strings.TrimSpace(title)
+
+		rule := FilterRule{OriginalName: attributes["tvg-name"], ChannelID: attributes["tvg-id"]}
+		if rule.OriginalName == "" {
+			rule.OriginalName = title
+		}
+		if rule.OriginalName == "" {
+			rule.OriginalName = rule.ChannelID
+		}
+		if rule.OutputName = channelSlug(rule.OriginalName); rule.OutputName == "" {
+			rule.OutputName = channelSlug(rule.ChannelID)
+		}
+		key := rule.ChannelID
+		if key == "" {
+			key = normalizeChannelName(rule.OriginalName)
+		}
+		if rule.OutputName == "" || seen[key] || seen[rule.OutputName] {
+			continue
+		}
+		seen[key], seen[rule.OutputName] = true, true
+
+		if logo := attributes["tvg-logo"]; strings.HasPrefix(logo, "https://") || strings.HasPrefix(logo, "http://") {
+			rule.Logo = logo
+		}
+		if group := attributes["group-title"]; group != "" {
+			rule.Groups = []string{group}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// playlistMatch finds a playlist rule's tvg-id among the sources' channel
+// IDs.
+func playlistMatch(rule FilterRule, sources []*EPGSource) *Match {
+	if rule.ChannelID == "" {
+		return nil
+	}
+	for _, src := range sources {
+		if ch, exists := src.ChannelsByID[rule.ChannelID]; exists {
+			return newMatch(src, ch, "tvg-id")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// feedPoliteness spaces out and slows down the requests to each host, so
+// scheduled runs do not hammer community-hosted mirrors into banning them.
+// Interval is the least time between the starts of two requests to one
+// host, retries, resumes and checksum files included; Rate caps in bytes per
+// second how fast one host's feeds are read, across concurrent downloads.
+// Zero disables either.
+type feedPoliteness struct {
+	Interval time.Duration
+	Rate     int
+}
+
+// politeness is the current run's policy, set by startWatchdog.
+var politeness feedPoliteness
+
+// hostTurns is when each host may next be requested and when the bytes
+// already read from it are paid for at the rate limit. They outlive a run,
+// so a daemon's back-to-back runs stay polite too.
+var hostTurns = struct {
+	mu        sync.Mutex
+	requested map[string]time.Time
+	drained   map[string]time.Time
+}{requested: make(map[string]time.Time), drained: make(map[string]time.Time)}
+
+// feedHost returns the host politeness is counted by, or "" for a local
+// file.
+func feedHost(feedURL string) string {
+	if _, local := localFeedPath(feedURL); local {
+		return ""
+	}
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// awaitHostTurn waits until feedURL's host may be requested again and takes
+// the turn, returning early with the context's error when the run is
+// canceled.
+func awaitHostTurn(feedURL string) error {
+	host := feedHost(feedURL)
+	if politeness.Interval <= 0 || host == "" {
+		return nil
+	}
+	hostTurns.mu.Lock()
+	turn := time.Now()
+	if next := hostTurns.requested[host].Add(politeness.Interval); next.After(turn) {
+		turn = next
+	}
+	hostTurns.requested[host] = turn
+	hostTurns.mu.Unlock()
+	if wait := time.Until(turn); wait > 0 {
+		return sleepFeed(wait)
+	}
+	return nil
+}
+
+// throttledBody reads a response body from feedURL's host at no more than
+// the rate limit.
+type throttledBody struct {
+	io.ReadCloser
+	host string
+}
+
+// throttle wraps body in a throttledBody when there is a rate limit.
+func throttle(feedURL string, body io.ReadCloser) io.ReadCloser {
+	host := feedHost(feedURL)
+	if politeness.Rate <= 0 || host == "" {
+		return body
+	}
+	return &throttledBody{ReadCloser: body, host: host}
+}
+
+// Read reads as much as one second of the rate allows and then waits until
+// the host's bytes so far are paid for.
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > politeness.Rate {
+		p = p[:politeness.Rate]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	hostTurns.mu.Lock()
+	drained := time.Now()
+	if previous := hostTurns.drained[b.host]; previous.After(drained) {
+		drained = previous
+	}
+	drained = drained.Add(time.Duration(n) * time.Second / time.Duration(politeness.Rate))
+	hostTurns.drained[b.host] = drained
+	hostTurns.mu.Unlock()
+	if wait := time.Until(drained); wait > 0 {
+		if sleepErr := sleepFeed(wait); sleepErr != nil {
+			return n, sleepErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ImageCheck is the outcome of warming one image URL.
+type ImageCheck struct {
+	URL    string   `json:"url"`
+	Status int      `json:"status,omitempty"`
+	Error  string   `json:"error,omitempty"`
+	Files  []string `json:"files"`
+}
+
+// QualityReport lists problems found in the published data.
+type QualityReport struct {
+	GeneratedAt   string       `json:"generated_at,omitempty"`
+	ImagesChecked int          `json:"images_checked"`
+	DeadImages    []ImageCheck `json:"dead_images"`
+}
+
+// imageRefs maps image URLs to the files referencing them.
+type imageRefs map[string]map[string]bool
+
+func (refs imageRefs) add(url, file string) {
+	if url == "" {
+		return
+	}
+	if refs[url] == nil {
+		refs[url] = make(map[string]bool)
+	}
+	refs[url][file] = true
+}
+
+// prewarmImages requests every image in files, with at most concurrency
+// requests in flight, so a fronting CDN caches them before clients ask. It
+// returns the images that failed.
+func prewarmImages(files imageRefs, concurrency int) []ImageCheck {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	urls := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	dead := make([]ImageCheck, 0)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for url := range urls {
+				status, err := warmImage(client, url)
+				if err == nil && status < 400 {
+					continue
+				}
+				check := ImageCheck{URL: url, Status: status}
+				if err != nil {
+					check.Error = err.Error()
+				}
+				for file := range files[url] {
+					check.Files = append(check.Files, file)
+				}
+				sort.Strings(check.Files)
+				mu.Lock()
+				dead = append(dead, check)
+				mu.Unlock()
+			}
+		}()
+	}
+	for url := range files {
+		urls <- url
+	}
+	close(urls)
+	wg.Wait()
+
+	sort.Slice(dead, func(i, j int) bool {
+		return dead[i].URL < dead[j].URL
+	})
+	return dead
+}
+
+// warmImage issues a HEAD request, falling back to GET for servers that do
+// not allow HEAD.
+func warmImage(client *http.Client, url string) (int, error) {
+	resp, err := client.Head(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+		return resp.StatusCode, nil
+	}
+
+	resp, err = client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func saveQualityReport(out OutputFS, filename string, report QualityReport) error {
+	jsonData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return out.WriteFile(filename, jsonData)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is one named set of generate flags, such as the filter list,
+// output, timezone and optional fields for one consuming app.
+type Profile struct {
+	Name string
+	Args []string
+}
+
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// defaultProfilesFile is profiles.yaml when it exists, else profiles.txt.
+func defaultProfilesFile() string {
+	if _, err := os.Stat("profiles.yaml"); err == nil {
+		return "profiles.yaml"
+	}
+	return "profiles.txt"
+}
+
+// loadProfiles reads a profiles file: profiles.yaml (see parseProfilesYAML)
+// or `name: flags` lines, e.g. `app-a: --filter filter-a.txt --output out/a`.
+// Flag values in the line format cannot contain spaces.
+func loadProfiles(filename string) ([]Profile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if isYAMLFilter(filename) {
+		profiles, err := parseProfilesYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		if len(profiles) == 0 {
+			return nil, fmt.Errorf("%s defines no profiles", filename)
+		}
+		return profiles, nil
+	}
+
+	profiles := make([]Profile, 0)
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %q: expected `name: flags`", line)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !profileName.MatchString(name) {
+			return nil, fmt.Errorf("invalid profile name %q: use lowercase letters, digits, - and _", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("profile %q defined twice", name)
+		}
+		seen[name] = true
+		profiles = append(profiles, Profile{Name: name, Args: strings.Fields(parts[1])})
+	}
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("%s defines no profiles", filename)
+	}
+	return profiles, nil
+}
+
+// profileDocument is profiles.yaml. Each profile names its own filter,
+// output and sources, the settings that differ between apps; any other
+// generate flag goes in flags.
+type profileDocument struct {
+	Profiles []profileEntry `yaml:"profiles"`
+}
+
+type profileEntry struct {
+	Name     string   `yaml:"name"`
+	Filter   string   `yaml:"filter"`
+	Output   string   `yaml:"output"`
+	Sources  string   `yaml:"sources"`
+	Timezone string   `yaml:"timezone"`
+	State    string   `yaml:"state"`
+	Flags    []string `yaml:"flags"`
+}
+
+// parseProfilesYAML turns profiles.yaml into profiles, in file order.
+// Unknown keys are rejected, as in filter.yaml.
+func parseProfilesYAML(data []byte) ([]Profile, error) {
+	var doc profileDocument
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	profiles := make([]Profile, 0, len(doc.Profiles))
+	seen := make(map[string]bool)
+	for i, entry := range doc.Profiles {
+		name := strings.TrimSpace(entry.Name)
+		if !profileName.MatchString(name) {
+			return nil, fmt.Errorf("profile %d: invalid name %q: use lowercase letters, digits, - and _", i+1, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("profile %q defined twice", name)
+		}
+		seen[name] = true
+
+		args := make([]string, 0, len(entry.Flags)+5)
+		for _, setting := range []struct{ flag, value string }{
+			{"filter", entry.Filter},
+			{"output", entry.Output},
+			{"sources", entry.Sources},
+			{"timezone", entry.Timezone},
+			{"state", entry.State},
+		} {
+			if value := strings.TrimSpace(setting.value); value != "" {
+				args = append(args, "--"+setting.flag+"="+value)
+			}
+		}
+		profiles = append(profiles, Profile{Name: name, Args: append(args, entry.Flags...)})
+	}
+	return profiles, nil
+}
+
+// runProfiles implements `epg profiles`: it runs every profile in the
+// profiles file one after another, downloading each feed once for all of
+// them. Generate flags given on the command line apply to every profile;
+// a profile's own flags take precedence.
+func runProfiles(args []string) error {
+	fs := flag.NewFlagSet("profiles", flag.ContinueOnError)
+	file := fs.String("profiles", defaultProfilesFile(), "profiles file: profiles.yaml, or one `name: flags` per line")
+	selected := fs.String("profile", "", "comma-separated profiles to run, or all (default all)")
+	registerGenerateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	shared := make([]string, 0)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "profiles" && f.Name != "profile" {
+			shared = append(shared, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+
+	profiles, err := loadProfiles(*file)
+	if err != nil {
+		return err
+	}
+	if *selected != "" && *selected != "all" {
+		wanted := make(map[string]bool)
+		for _, name := range strings.Split(*selected, ",") {
+			wanted[strings.TrimSpace(name)] = true
+		}
+		chosen := make([]Profile, 0, len(wanted))
+		for _, profile := range profiles {
+			if wanted[profile.Name] {
+				chosen = append(chosen, profile)
+				delete(wanted, profile.Name)
+			}
+		}
+		for name := range wanted {
+			return fmt.Errorf("unknown profile %q", name)
+		}
+		profiles = chosen
+	}
+
+	// Parse every profile before running any, so a typo fails fast
+	runs := make([]*GenerateOptions, len(profiles))
+	outputs := make(map[string]string)
+	for i, profile := range profiles {
+		pfs := flag.NewFlagSet(profile.Name, flag.ContinueOnError)
+		opts := registerGenerateFlags(pfs)
+		if err := pfs.Parse(append(append([]string{}, shared...), profile.Args...)); err != nil {
+			return fmt.Errorf("profile %s: %v", profile.Name, err)
+		}
+		if pfs.NArg() > 0 {
+			return fmt.Errorf("profile %s: unexpected argument %q", profile.Name, pfs.Arg(0))
+		}
+		// Each profile keeps its own run history unless told otherwise
+		stateSet := false
+		pfs.Visit(func(f *flag.Flag) {
+			stateSet = stateSet || f.Name == "state"
+		})
+		if !stateSet {
+			opts.StateFile = "epg-state-" + profile.Name + ".db"
+		}
+		if previous, exists := outputs[opts.Output]; exists {
+			return fmt.Errorf("profiles %s and %s both write to %s; give each its own --output", previous, profile.Name, opts.Output)
+		}
+		outputs[opts.Output] = profile.Name
+		runs[i] = opts
+	}
+
+	feeds := newFeedCache()
+	feeds.pinned = true
+	defer func() { logName = "epg-parser" }()
+
+	// The runs' errors are kept, so --strict exit codes survive
+	failed := make([]error, 0)
+	for i, profile := range profiles {
+		fmt.Printf("\n👥 Profile %s (%d of %d)\n", profile.Name, i+1, len(profiles))
+		runs[i].feeds = feeds
+		logName = "epg-parser-" + profile.Name
+		if err := runGenerate(runs[i]); err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", profile.Name, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d profiles failed:\n%w", len(failed), len(profiles), errors.Join(failed...))
+	}
+	fmt.Printf("\n🎉 %d profiles generated\n", len(profiles))
+	return nil
+}
+
+// wantsProfiles reports whether args select profiles with --profile or
+// --profiles, so a plain generation can hand over to runProfiles.
+func wantsProfiles(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && (name == "profile" || name == "profiles") {
+			return true
+		}
+	}
+	return false
+}
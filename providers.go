@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Provider is one XMLTV feed. Providers are tried in order when matching, so
+// earlier ones win when several carry the same channel.
+type Provider struct {
+	// Name identifies the provider in logs, provider_ids and the state database.
+	Name  string
+	Label string
+	URL   string
+	// Type is the source type, xmltv when empty; other types are fetched
+	// through the Source registered for them in sourceTypes.
+	Type string
+	// Required providers degrade the run when they cannot be downloaded: it
+	// continues with the other sources, but reports the failure and fails
+	// --strict. Other providers are skipped with a warning.
+	Required bool
+	// CleanName strips provider-specific decoration from a display name before
+	// it is normalized, so "117 STAR PLUS SD" indexes as "Star Plus".
+	CleanName func(name string) string
+	// Header is sent with every request for the feed: API keys, cookies,
+	// User-Agent and Authorization from sources.yaml.
+	Header http.Header
+	// MinSize and Checksum are checked against each download before it is
+	// parsed; see integrity.go. MinSize 0 takes --min-feed-size.
+	MinSize  int
+	Checksum string
+	// CACert is trusted for the feed besides --ca-cert, and
+	// InsecureSkipVerify does not check its certificate; see feedtls.go.
+	CACert             string
+	InsecureSkipVerify bool
+}
+
+// Source feeds, in priority order.
+const (
+	jioEPGURL  = "https://avkb.short.gy/jioepg.xml.gz"
+	tataEPGURL = "https://avkb.short.gy/tsepg.xml.gz"
+)
+
+var (
+	// Airtel mirrors append the platform to some names: "Colors HD - Airtel",
+	// "Zee TV (Airtel DTH)".
+	airtelSuffix = regexp.MustCompile(`(?i)\s*(-\s*airtel.*|\(\s*airtel[^)]*\))\s*$`)
+	// DishTV mirrors carry the channel number and an explicit SD marker:
+	// "117 - STAR PLUS SD", "Sony SAB (128)".
+	dishLeadingNumber  = regexp.MustCompile(`^\s*\d+\s*[-.:]?\s+`)
+	dishTrailingNumber = regexp.MustCompile(`\s*\(\s*\d+\s*\)\s*$`)
+	dishSDMarker       = regexp.MustCompile(`(?i)\s+SD\s*$`)
+	// DD Free Dish mirrors tag the platform and spell out Doordarshan:
+	// "Doordarshan National (Free Dish)", "DD Sports - DD FreeDish".
+	freeDishSuffix    = regexp.MustCompile(`(?i)\s*(-\s*(dd\s*)?free\s*dish.*|\(\s*(dd\s*)?free\s*dish[^)]*\))\s*$`)
+	doordarshanPrefix = regexp.MustCompile(`(?i)^\s*doordarshan\s+`)
+	// Sun Direct mirrors carry the channel number in brackets and the
+	// platform: "[113] Sun TV HD", "KTV - Sun Direct".
+	sunDirectNumber = regexp.MustCompile(`^\s*\[\s*\d+\s*\]\s*|\s*\[\s*\d+\s*\]\s*$`)
+	sunDirectSuffix = regexp.MustCompile(`(?i)\s*(-\s*sun\s*direct.*|\(\s*sun\s*direct[^)]*\))\s*$`)
+)
+
+// builtinProviders are the providers this tool knows about. Airtel, DishTV,
+// DD Free Dish and Sun Direct have no public feed of their own; they are
+// enabled by giving the URL of an XMLTV mirror in the sources file.
+var builtinProviders = []Provider{
+	{Name: "Jio", Label: "Jio TV", URL: jioEPGURL, Required: true},
+	{Name: "Tata", Label: "Tata Play", URL: tataEPGURL, Required: true},
+	{Name: "Airtel", Label: "Airtel Digital TV", CleanName: func(name string) string {
+		return airtelSuffix.ReplaceAllString(name, "")
+	}},
+	{Name: "DishTV", Label: "DishTV", CleanName: func(name string) string {
+		name = dishLeadingNumber.ReplaceAllString(name, "")
+		name = dishTrailingNumber.ReplaceAllString(name, "")
+		return dishSDMarker.ReplaceAllString(name, "")
+	}},
+	{Name: "DDFreeDish", Label: "DD Free Dish", CleanName: func(name string) string {
+		name = freeDishSuffix.ReplaceAllString(name, "")
+		return doordarshanPrefix.ReplaceAllString(name, "DD ")
+	}},
+	{Name: "SunDirect", Label: "Sun Direct", CleanName: func(name string) string {
+		name = sunDirectNumber.ReplaceAllString(name, "")
+		return sunDirectSuffix.ReplaceAllString(name, "")
+	}},
+}
+
+// loadProviders returns the built-in providers with URLs from filename
+// applied. Each line is `name = URL`: a built-in name (case-insensitive) sets
+// or overrides its feed, an empty URL disables it, and any other name adds an
+// optional provider after the built-in ones. Providers without a URL are left
+// out. A missing file keeps the defaults. EPG_SOURCE_<NAME> variables are
+// applied last, over either kind of sources file.
+func loadProviders(filename string) ([]Provider, error) {
+	if isSourcesConfig(filename) {
+		providers, err := loadSourcesConfig(filename)
+		if err != nil {
+			return nil, err
+		}
+		return enabledProviders(applySourceEnv(providers)), nil
+	}
+
+	providers := make([]Provider, len(builtinProviders))
+	copy(providers, builtinProviders)
+
+	data, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %q: expected `name = URL`", line)
+		}
+		name, url := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		found := false
+		for i := range providers {
+			if strings.EqualFold(providers[i].Name, name) {
+				providers[i].URL = url
+				found = true
+				break
+			}
+		}
+		if !found {
+			providers = append(providers, Provider{Name: name, Label: name, URL: url})
+		}
+	}
+	return enabledProviders(applySourceEnv(providers)), nil
+}
+
+// providers loads the run's feeds from the sources file, applies
+// --providers and --disable-providers to them and registers their request
+// headers and download checks.
+func (o *GenerateOptions) providers() ([]Provider, error) {
+	providers, err := loadProviders(o.SourcesFile)
+	if err != nil {
+		return nil, err
+	}
+	if providers, err = orderProviders(providers, o.ProviderOrder, o.DisabledProviders); err != nil {
+		return nil, err
+	}
+	minSize, err := parseByteSize(o.MinFeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --min-feed-size: %v", err)
+	}
+	if err := markInsecure(providers, o.InsecureSkipVerify); err != nil {
+		return nil, err
+	}
+	registerFeedHeaders(providers)
+	registerFeedChecks(providers, minSize)
+	if err := registerFeedTLS(providers, o.CACert); err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+// orderProviders reorders and filters providers for one run. order is a
+// comma-separated list of provider names (case-insensitive): only those are
+// consulted, in that order. disabled names providers to leave out. Either may
+// be empty. Naming a provider that is not enabled is an error, so a typo
+// does not silently change the run.
+func orderProviders(providers []Provider, order, disabled string) ([]Provider, error) {
+	find := func(name string) (int, error) {
+		for i, p := range providers {
+			if strings.EqualFold(p.Name, name) {
+				return i, nil
+			}
+		}
+		names := make([]string, 0, len(providers))
+		for _, p := range providers {
+			names = append(names, p.Name)
+		}
+		return -1, fmt.Errorf("unknown provider %q (enabled: %s)", name, strings.Join(names, ", "))
+	}
+
+	if strings.TrimSpace(order) != "" {
+		ordered := make([]Provider, 0, len(providers))
+		seen := make(map[int]bool)
+		for _, name := range strings.Split(order, ",") {
+			i, err := find(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("--providers: %v", err)
+			}
+			if !seen[i] {
+				seen[i] = true
+				ordered = append(ordered, providers[i])
+			}
+		}
+		providers = ordered
+	}
+
+	if strings.TrimSpace(disabled) != "" {
+		for _, name := range strings.Split(disabled, ",") {
+			i, err := find(strings.TrimSpace(name))
+			if err != nil {
+				return nil, fmt.Errorf("--disable-providers: %v", err)
+			}
+			providers = append(providers[:i:i], providers[i+1:]...)
+		}
+		if len(providers) == 0 {
+			return nil, fmt.Errorf("--disable-providers leaves no provider enabled")
+		}
+	}
+	return providers, nil
+}
+
+// enabledProviders leaves out the providers without a URL.
+func enabledProviders(providers []Provider) []Provider {
+	enabled := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		if p.URL != "" {
+			enabled = append(enabled, p)
+		}
+	}
+	return enabled
+}
+
+// sourcesConfig is the schema of sources.yaml (or sources.json), which lists
+// every feed of the run instead of adjusting the built-in ones.
+type sourcesConfig struct {
+	Sources []sourceEntry `yaml:"sources" json:"sources"`
+}
+
+type sourceEntry struct {
+	Name  string `yaml:"name" json:"name"`
+	Label string `yaml:"label,omitempty" json:"label,omitempty"`
+	URL   string `yaml:"url" json:"url"`
+	// Type is xmltv when omitted; see sourceTypes for the others.
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// Priority orders the feeds, lowest first; feeds without one follow in
+	// file order.
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
+	// Required defaults to true for Jio and Tata and false otherwise.
+	Required *bool `yaml:"required,omitempty" json:"required,omitempty"`
+	// Headers, UserAgent and Auth are sent with every request for the
+	// feed, for private feeds; see sourceauth.go.
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	UserAgent string            `yaml:"user_agent,omitempty" json:"user_agent,omitempty"`
+	Auth      *sourceAuth       `yaml:"auth,omitempty" json:"auth,omitempty"`
+	// MinSize and Checksum verify each download; see integrity.go.
+	MinSize  string `yaml:"min_size,omitempty" json:"min_size,omitempty"`
+	Checksum string `yaml:"checksum,omitempty" json:"checksum,omitempty"`
+	// CACert and InsecureSkipVerify set how the feed's TLS certificate is
+	// checked; see feedtls.go.
+	CACert             string `yaml:"ca_cert,omitempty" json:"ca_cert,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty" json:"insecure_skip_verify,omitempty"`
+}
+
+// isSourcesConfig reports whether filename is a sources.yaml or sources.json
+// rather than a sources.txt.
+func isSourcesConfig(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// loadSourcesConfig reads a sources.yaml or sources.json. Only the feeds it
+// lists are used; one named after a built-in provider keeps that provider's
+// label, requiredness and name cleaning unless overridden. A missing file
+// keeps the defaults.
+func loadSourcesConfig(filename string) ([]Provider, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return enabledProviders(builtinProviders), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config sourcesConfig
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&config)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&config)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	entries := config.Sources
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].Priority, entries[j].Priority
+		return a != 0 && (b == 0 || a < b)
+	})
+	providers := make([]Provider, 0, len(entries))
+	for i, entry := range entries {
+		name, url := strings.TrimSpace(entry.Name), strings.TrimSpace(entry.URL)
+		if name == "" {
+			return nil, fmt.Errorf("source %d: name is required", i+1)
+		}
+		if entry.Priority < 0 {
+			return nil, fmt.Errorf("%s: priority must be positive", name)
+		}
+		if url == "" {
+			continue
+		}
+		sourceType := strings.ToLower(strings.TrimSpace(entry.Type))
+		if _, exists := sourceTypes[sourceType]; !exists && sourceType != "" && sourceType != xmltvSource {
+			return nil, fmt.Errorf("%s: unknown source type %q (known: %s)", name, entry.Type, sourceTypeNames())
+		}
+		if (sourceType == "" || sourceType == xmltvSource) && !validFeedURL(url) {
+			return nil, fmt.Errorf("%s: invalid URL %q: expected http(s)://, file:// or a local path", name, url)
+		}
+		for _, p := range providers {
+			if strings.EqualFold(p.Name, name) {
+				return nil, fmt.Errorf("%s: listed twice", name)
+			}
+		}
+
+		provider := Provider{Name: name, Label: name}
+		for _, builtin := range builtinProviders {
+			if strings.EqualFold(builtin.Name, name) {
+				provider = builtin
+				break
+			}
+		}
+		provider.URL, provider.Type = url, sourceType
+		if entry.Label != "" {
+			provider.Label = strings.TrimSpace(entry.Label)
+		}
+		if entry.Required != nil {
+			provider.Required = *entry.Required
+		}
+		if provider.Header, err = entry.requestHeader(); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if provider.MinSize, err = parseByteSize(entry.MinSize); err != nil {
+			return nil, fmt.Errorf("%s: min_size: %v", name, err)
+		}
+		if provider.Checksum = strings.TrimSpace(entry.Checksum); provider.Checksum != "" && !sha256Checksum.MatchString(provider.Checksum) && !strings.HasPrefix(provider.Checksum, "https://") && !strings.HasPrefix(provider.Checksum, "http://") {
+			return nil, fmt.Errorf("%s: checksum must be sha256:<64 hex digits> or the URL of a checksum file", name)
+		}
+		provider.CACert, provider.InsecureSkipVerify = strings.TrimSpace(entry.CACert), entry.InsecureSkipVerify
+		providers = append(providers, provider)
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("%s lists no sources with a URL", filename)
+	}
+	return providers, nil
+}
+
+// indexName normalizes a provider display name for the name indexes.
+func (p Provider) indexName(name string) string {
+	if p.CleanName != nil {
+		name = p.CleanName(name)
+	}
+	return normalizeChannelName(name)
+}
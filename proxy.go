@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// proxySchemes are the proxies --proxy accepts. socks5h resolves host names
+// on the proxy, for feeds whose hosts only resolve from there.
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// feedProxyFor is how feedClient picks a request's proxy, for feedError.
+var feedProxyFor = http.ProxyFromEnvironment
+
+// feedProxy returns how feed requests pick their proxy: through --proxy when
+// it is set, and otherwise from HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func feedProxy(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	if proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --proxy: %v", err)
+	}
+	if !contains(proxySchemes, u.Scheme) || u.Host == "" {
+		return nil, fmt.Errorf("invalid --proxy %q: expected %s://host:port", u.Redacted(), strings.Join(proxySchemes, "|"))
+	}
+	return http.ProxyURL(u), nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Recurrence values emitted with --recurrence.
+const (
+	recurrenceDaily  = "daily"
+	recurrenceWeekly = "weekly"
+	recurrenceOneOff = "one-off"
+)
+
+// recurrenceDailyDays is how many of the seven days before a schedule's day
+// a title must have aired on to be daily. Four lets in the weekday serials
+// that skip the weekend, and keeps out shows repeated once or twice.
+const recurrenceDailyDays = 4
+
+// recurrenceHistory is which archived days each channel has a schedule for
+// and, by normalized title, which of those days the title aired on.
+type recurrenceHistory struct {
+	days   map[string][]time.Time
+	titles map[string]map[string][]time.Time
+}
+
+// loadRecurrenceHistory reads every channel file index lists back from the
+// archive in out. Without a readable archive the history is empty and no
+// programme is tagged.
+func loadRecurrenceHistory(out OutputFS, index ArchiveIndex) *recurrenceHistory {
+	history := &recurrenceHistory{days: make(map[string][]time.Time), titles: make(map[string]map[string][]time.Time)}
+	reader, ok := out.(interface {
+		ReadFile(name string) ([]byte, error)
+	})
+	if !ok {
+		return history
+	}
+	for _, day := range index.Days {
+		date, err := time.Parse("2006-01-02", day.Date)
+		if err != nil {
+			continue
+		}
+		for _, slug := range day.Channels {
+			aired := make(map[string]bool)
+			for page, pages := 1, 1; page <= pages; page++ {
+				data, err := reader.ReadFile(day.Path + "/" + pageFile(slug+".json", page))
+				if err != nil {
+					break
+				}
+				var channel ChannelJSON
+				if json.Unmarshal(data, &channel) != nil {
+					break
+				}
+				pages = channel.Pages
+				for _, prog := range channel.Programs {
+					if title := normalizeChannelName(prog.ShowName); title != "" {
+						aired[title] = true
+					}
+				}
+			}
+			if len(aired) == 0 {
+				continue
+			}
+			history.days[slug] = append(history.days[slug], date)
+			if history.titles[slug] == nil {
+				history.titles[slug] = make(map[string][]time.Time)
+			}
+			for title := range aired {
+				history.titles[slug][title] = append(history.titles[slug][title], date)
+			}
+		}
+	}
+	return history
+}
+
+// recurrence tells whether title airs daily or weekly on channel slug, or
+// is a one-off, judging by the week before date: daily when it aired on at
+// least recurrenceDailyDays of those days, weekly when it aired on date's
+// weekday in an earlier week, and one-off otherwise, premieres included.
+// Until the archive reaches a week back from date there is too little to
+// tell a weekly show from a one-off, and "" is returned.
+func (h *recurrenceHistory) recurrence(slug, title string, date time.Time) string {
+	if h == nil {
+		return ""
+	}
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	weekBefore := date.AddDate(0, 0, -7)
+	covered := false
+	for _, day := range h.days[slug] {
+		if !day.After(weekBefore) {
+			covered = true
+			break
+		}
+	}
+	if !covered {
+		return ""
+	}
+	lastWeek, sameWeekday := 0, false
+	for _, day := range h.titles[slug][normalizeChannelName(title)] {
+		if !day.Before(date) {
+			continue
+		}
+		if !day.Before(weekBefore) {
+			lastWeek++
+		}
+		if day.Weekday() == date.Weekday() {
+			sameWeekday = true
+		}
+	}
+	switch {
+	case lastWeek >= recurrenceDailyDays:
+		return recurrenceDaily
+	case sameWeekday:
+		return recurrenceWeekly
+	default:
+		return recurrenceOneOff
+	}
+}
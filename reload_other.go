@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyReload never delivers: Windows has no SIGHUP, so the configuration
+// is only loaded at startup.
+func notifyReload() <-chan os.Signal {
+	return make(chan os.Signal)
+}
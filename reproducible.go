@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"time"
+)
+
+// canonicalFS re-encodes every JSON file written through it with its keys
+// in sorted order, for --canonical. Together with leaving out the time of
+// the run, this makes identical feeds and configuration give byte-identical
+// files, so published artifacts can be deduplicated by content hash.
+type canonicalFS struct {
+	OutputFS
+}
+
+func (c canonicalFS) WriteFile(name string, data []byte) error {
+	if path.Ext(name) == ".json" {
+		canonical, err := canonicalJSON(data)
+		if err != nil {
+			return err
+		}
+		data = canonical
+	}
+	return c.OutputFS.WriteFile(name, data)
+}
+
+// canonicalJSON re-encodes a JSON document with sorted keys and two-space
+// indentation. Numbers are kept as written.
+func canonicalJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	canonical, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasSuffix(data, []byte("\n")) {
+		canonical = append(canonical, '\n')
+	}
+	return canonical, nil
+}
+
+// newestFeedDate is the latest date the feeds say they were generated, the
+// time --canonical stamps a run's outputs with instead of the clock.
+func newestFeedDate(feeds []archivedFeed) (time.Time, bool) {
+	var newest time.Time
+	for _, feed := range feeds {
+		if generated, ok := feed.TV.generatedAt(); ok && generated.After(newest) {
+			newest = generated
+		}
+	}
+	return newest, !newest.IsZero()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SearchHit is a single programme matching a search query.
+type SearchHit struct {
+	Channel string
+	File    string
+	Date    string
+	Program ProgramJSON
+}
+
+// runSearch implements `epg search <query> [--date today|tomorrow|YYYY-MM-DD|all]`.
+// It scans the generated output directories below --output, so no network
+// access is needed.
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	dateFlag := fs.String("date", "today", "date to search: today, tomorrow, YYYY-MM-DD or all")
+	opts := &GenerateOptions{}
+	registerOutputFlags(fs, opts)
+	opts.envErr = applyEnvDefaults(fs)
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("usage: epg search <query> [--date today|tomorrow|YYYY-MM-DD|all]")
+	}
+	query := strings.Join(positional, " ")
+	if err := opts.validateLayout(); err != nil {
+		return err
+	}
+	dirs, err := opts.localDayDirs("search")
+	if err != nil {
+		return err
+	}
+
+	loc, _, err := loadTimezone(opts.Timezone, opts.TimezoneFallback)
+	if err != nil {
+		return err
+	}
+	date, err := resolveSearchDate(*dateFlag, time.Now().In(loc))
+	if err != nil {
+		return err
+	}
+
+	hits, err := searchOutputs(query, date, dirs)
+	if err != nil {
+		return err
+	}
+
+	label := date
+	if label == "" {
+		label = "all dates"
+	}
+	if len(hits) == 0 {
+		fmt.Printf("🔍 No programmes matching %q on %s\n", query, label)
+		return nil
+	}
+
+	fmt.Printf("🔍 %d programmes matching %q on %s\n", len(hits), query, label)
+	lastKey := ""
+	for _, hit := range hits {
+		key := hit.Date + "/" + hit.File
+		if key != lastKey {
+			fmt.Printf("\n📺 %s (%s, %s)\n", hit.Channel, hit.File, hit.Date)
+			lastKey = key
+		}
+		fmt.Printf("   %s - %s  %s\n", hit.Program.StartTime, hit.Program.EndTime, hit.Program.ShowName)
+	}
+	return nil
+}
+
+// resolveSearchDate turns the --date flag into a YYYY-MM-DD string.
+// An empty result means every date.
+func resolveSearchDate(value string, now time.Time) (string, error) {
+	switch strings.ToLower(value) {
+	case "today":
+		return now.Format("2006-01-02"), nil
+	case "tomorrow":
+		return now.AddDate(0, 0, 1).Format("2006-01-02"), nil
+	case "all", "":
+		return "", nil
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return "", fmt.Errorf("invalid --date %q: expected today, tomorrow, all or YYYY-MM-DD", value)
+	}
+	return value, nil
+}
+
+// searchOutputs returns every programme in dirs whose show name contains
+// query (case-insensitive), restricted to date unless date is empty.
+func searchOutputs(query, date string, dirs []string) ([]SearchHit, error) {
+	needle := strings.ToLower(query)
+	hits := make([]SearchHit, 0)
+
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		// Later pages of a paginated day are searched with the first, as
+		// one channel
+		type firstPage struct {
+			slug    string
+			channel *ChannelJSON
+		}
+		firsts := make([]firstPage, 0, len(files))
+		later := make(map[string][]*ChannelJSON)
+		for _, file := range files {
+			if strings.HasSuffix(file, patchSuffix) {
+				continue
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var channel ChannelJSON
+			if err := json.Unmarshal(data, &channel); err != nil {
+				continue
+			}
+			if date != "" && channel.Date != date {
+				continue
+			}
+			slug, page := parsePageFile(filepath.Base(file))
+			if page > 1 {
+				later[slug] = append(later[slug], &channel)
+				continue
+			}
+			firsts = append(firsts, firstPage{slug, &channel})
+		}
+		for _, first := range firsts {
+			channel := first.channel
+			if channel.Pages > 1 {
+				channel = joinPages(channel, later[first.slug])
+			}
+			for _, prog := range channel.Programs {
+				if strings.Contains(strings.ToLower(prog.ShowName), needle) {
+					hits = append(hits, SearchHit{
+						Channel: channel.ChannelName,
+						File:    first.slug + ".json",
+						Date:    channel.Date,
+						Program: prog,
+					})
+				}
+			}
+		}
+	}
+
+	// Keep programmes grouped per channel/day in file order
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Date != hits[j].Date {
+			return hits[i].Date < hits[j].Date
+		}
+		return hits[i].File < hits[j].File
+	})
+
+	return hits, nil
+}
+
+// parseInterspersed parses flags that may appear before or after positional
+// arguments, returning the positional arguments in order.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Guide is an immutable snapshot of the generated schedules. Refreshes build
+// a new Guide and swap it in, so handlers never observe a partial update.
+type Guide struct {
+	LoadedAt time.Time
+	// Schedules maps output slug -> date (YYYY-MM-DD) -> schedule.
+	Schedules map[string]map[string]*ChannelJSON
+	// ByChannelID maps canonical channel IDs to output slugs.
+	ByChannelID map[string]string
+	// Groups maps a group name to its channels, as listed in the groups file.
+	Groups map[string][]string
+	// Files are the generated files served under /files; see hosting.go.
+	Files map[string]bool
+}
+
+// loadGuide reads every channel file in dirs into a new Guide.
+func loadGuide(dirs []string) (*Guide, error) {
+	guide := &Guide{
+		LoadedAt:    time.Now(),
+		Schedules:   make(map[string]map[string]*ChannelJSON),
+		ByChannelID: make(map[string]string),
+	}
+
+	for _, dir := range dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		// Later pages of a paginated day are joined onto the first
+		later := make(map[string][]*ChannelJSON)
+		for _, file := range files {
+			// Patches (--patches) sit next to the files they patch
+			if strings.HasSuffix(file, patchSuffix) {
+				continue
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var channel ChannelJSON
+			if err := json.Unmarshal(data, &channel); err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+
+			slug, page := parsePageFile(filepath.Base(file))
+			if page > 1 {
+				later[slug] = append(later[slug], &channel)
+				continue
+			}
+			if guide.Schedules[slug] == nil {
+				guide.Schedules[slug] = make(map[string]*ChannelJSON)
+			}
+			guide.Schedules[slug][channel.Date] = &channel
+			if channel.ChannelID != "" {
+				guide.ByChannelID[channel.ChannelID] = slug
+			}
+		}
+		for slug, pages := range later {
+			for date, first := range guide.Schedules[slug] {
+				if first.Pages > 1 {
+					guide.Schedules[slug][date] = joinPages(first, pages)
+				}
+			}
+		}
+	}
+	return guide, nil
+}
+
+// localDayDirs returns the day folders below --output, for command, which
+// reads the outputs back from disk and so cannot use a remote output.
+func (o *GenerateOptions) localDayDirs(command string) ([]string, error) {
+	if strings.Contains(o.Output, "://") {
+		return nil, fmt.Errorf("%s reads the outputs from disk, so --output must be a local directory, not %s", command, o.Output)
+	}
+	dirs := make([]string, 0, o.Days)
+	for _, day := range o.outputDays() {
+		dirs = append(dirs, filepath.Join(o.Output, day.Dir))
+	}
+	return dirs, nil
+}
+
+// lookup resolves a channel by slug (with or without .json) or canonical ID.
+func (g *Guide) lookup(channel string) (string, map[string]*ChannelJSON) {
+	slug := strings.TrimSuffix(channel, ".json")
+	if days, exists := g.Schedules[slug]; exists {
+		return slug, days
+	}
+	if slug, exists := g.ByChannelID[channel]; exists {
+		return slug, g.Schedules[slug]
+	}
+	return "", nil
+}
+
+// slugs returns the channel slugs in sorted order.
+func (g *Guide) slugs() []string {
+	slugs := make([]string, 0, len(g.Schedules))
+	for slug := range g.Schedules {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	return slugs
+}
+
+type guideServer struct {
+	guide      atomic.Pointer[Guide]
+	loc        *time.Location
+	dirs       []string
+	groupsFile string
+	// filterFile may add groups of its own (filter.yaml `groups:`).
+	filterFile string
+	// metrics are the daemon's run metrics, served at /metrics with the
+	// request metrics of access.
+	metrics runMetricsRegistry
+	access  *accessLog
+	// adminToken enables the /admin endpoints; aliasFile is the file they
+	// edit. wake asks the daemon for a run now, and is nil without one.
+	// aliasWatch is set when the daemon watches aliasFile itself, and
+	// aliasMatch when --match uses the aliases at all.
+	adminToken string
+	aliasFile  string
+	wake       chan struct{}
+	aliasWatch bool
+	aliasMatch bool
+	// outputRoot is the local --output directory, for the archive and the
+	// files /files serves; basicAuth is the user:password asked for. See
+	// hosting.go.
+	outputRoot string
+	basicAuth  string
+}
+
+// refresh loads the output directories and groups into a staging Guide and
+// publishes it with a single pointer swap.
+func (s *guideServer) refresh() error {
+	staged, err := loadGuide(s.dirs)
+	if err != nil {
+		return err
+	}
+	if staged.Groups, err = loadGroups(s.groupsFile); err != nil {
+		return fmt.Errorf("%s: %v", s.groupsFile, err)
+	}
+	if isYAMLFilter(s.filterFile) || isPlaylistFilter(s.filterFile) {
+		rules, err := loadFilterRules(s.filterFile)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.filterFile, err)
+		}
+		for name, channels := range filterGroups(rules) {
+			staged.Groups[name] = append(staged.Groups[name], channels...)
+		}
+	}
+	if s.outputRoot != "" {
+		staged.Files = publishedFiles(s.outputRoot)
+	}
+	s.guide.Store(staged)
+	return nil
+}
+
+// reload refreshes the guide after a generation run, logging the outcome.
+func (s *guideServer) reload(what string) {
+	if err := s.refresh(); err != nil {
+		logMessage(fmt.Sprintf("❌ Error reloading outputs: %v", err))
+		return
+	}
+	logMessage(fmt.Sprintf("🔄 %s: %d channels", what, len(s.guide.Load().Schedules)))
+}
+
+func (s *guideServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /channels", s.handleChannels)
+	mux.HandleFunc("GET /epg/{channel}", s.handleEPG)
+	mux.HandleFunc("GET /now", s.handleNow)
+	mux.HandleFunc("GET /group/{name}/now", s.handleGroupNow)
+	mux.HandleFunc("GET /group/{name}/epg", s.handleGroupEPG)
+	mux.HandleFunc("GET /archive", s.handleArchive)
+	mux.HandleFunc("GET /archive/{date}/{channel}", s.handleArchiveSchedule)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /openapi.json", handleOpenAPI)
+	mux.HandleFunc("GET /docs", handleDocs)
+	mux.HandleFunc("GET /files/{path...}", s.handleFile)
+	s.adminRoutes(mux)
+	return s.withAccessLog(s.withBasicAuth(mux))
+}
+
+func (s *guideServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	guide := s.guide.Load()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":    "ok",
+		"channels":  len(guide.Schedules),
+		"loaded_at": guide.LoadedAt.Format(time.RFC3339),
+	})
+}
+
+func (s *guideServer) handleChannels(w http.ResponseWriter, r *http.Request) {
+	guide := s.guide.Load()
+	type channelSummary struct {
+		ChannelID   string   `json:"channel_id"`
+		ChannelName string   `json:"channel_name"`
+		Slug        string   `json:"slug"`
+		Dates       []string `json:"dates"`
+	}
+
+	summaries := make([]channelSummary, 0, len(guide.Schedules))
+	for _, slug := range guide.slugs() {
+		summary := channelSummary{Slug: slug, Dates: make([]string, 0)}
+		for date, schedule := range guide.Schedules[slug] {
+			summary.ChannelID = schedule.ChannelID
+			summary.ChannelName = schedule.ChannelName
+			summary.Dates = append(summary.Dates, date)
+		}
+		sort.Strings(summary.Dates)
+		summaries = append(summaries, summary)
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *guideServer) handleEPG(w http.ResponseWriter, r *http.Request) {
+	guide := s.guide.Load()
+	channel, ext := cutScheduleFormat(r.PathValue("channel"))
+	slug, days := guide.lookup(channel)
+	if days == nil {
+		writeError(w, http.StatusNotFound, "unknown channel")
+		return
+	}
+	if ext != "" {
+		s.handleScheduleFormat(w, r, slug, days, ext)
+		return
+	}
+
+	date, ok := s.requestDate(w, r)
+	if !ok {
+		return
+	}
+	fields, ok := requestFields(w, r)
+	if !ok {
+		return
+	}
+	schedule, exists := days[date]
+	if !exists {
+		writeError(w, http.StatusNotFound, "no schedule for "+date)
+		return
+	}
+	writeJSON(w, http.StatusOK, projectSchedule(schedule, fields, s.loc))
+}
+
+// requestDate resolves the ?date= parameter (default today), writing a 400
+// response when it is invalid.
+func (s *guideServer) requestDate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	value := r.URL.Query().Get("date")
+	if value == "" {
+		value = "today"
+	}
+	date, err := resolveSearchDate(value, time.Now().In(s.loc))
+	if err != nil || date == "" {
+		writeError(w, http.StatusBadRequest, "invalid date: expected today, tomorrow or YYYY-MM-DD")
+		return "", false
+	}
+	return date, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// runServe implements `epg serve`. It serves the generated outputs over HTTP
+// and, with --refresh, also runs as a daemon that regenerates them on an
+// interval and swaps the new guide in once it is complete. --volatile-refresh
+// additionally re-publishes fast-changing channels more often.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	var hosting hostingOptions
+	fs.StringVar(&hosting.Addr, "addr", ":8080", "listen address")
+	refresh := fs.Duration("refresh", 0, "regenerate outputs at this interval, e.g. 6h (0 serves existing files only)")
+	volatileRefresh := fs.Duration("volatile-refresh", 0, "with --refresh, re-publish the channels in --volatile at this shorter interval, e.g. 1h")
+	volatileFile := fs.String("volatile", "volatile.txt", "channels (one per line, as in filter.txt) refreshed every --volatile-refresh")
+	watchAliasFile := fs.Duration("watch-aliases", 5*time.Second, "with --refresh, poll --aliases this often (no inotify, so network filesystems work too) and re-publish only the channels whose aliases changed (0 disables)")
+	groupsFile := fs.String("groups", "groups.txt", "channel groups served under /group/{name}")
+	adminToken := fs.String("admin-token", os.Getenv("EPG_ADMIN_TOKEN"), "bearer token enabling the /admin endpoints (default $EPG_ADMIN_TOKEN; empty disables them)")
+	accessLogFile := fs.String("access-log", "-", "write a JSON line per request (route, channel, status, latency, client) to this file; - for standard output, empty to disable")
+	fs.StringVar(&hosting.CertFile, "tls-cert", "", "serve HTTPS with this certificate file (PEM, with --tls-key)")
+	fs.StringVar(&hosting.KeyFile, "tls-key", "", "private key file for --tls-cert")
+	domains := fs.String("tls-domains", "", "comma-separated host names to serve HTTPS for with certificates from Let's Encrypt, e.g. epg.example.com (use with --addr :443)")
+	fs.StringVar(&hosting.CertCache, "tls-cache", defaultTLSCache, "directory keeping the Let's Encrypt account and certificates between restarts (inside --cache-dir when relative)")
+	fs.StringVar(&hosting.Email, "tls-email", "", "contact address given to Let's Encrypt for expiry notices")
+	fs.StringVar(&hosting.ACMEAddr, "acme-addr", ":80", "with --tls-domains, answer Let's Encrypt's HTTP challenges and redirect to HTTPS on this address (empty disables)")
+	fs.StringVar(&hosting.BasicAuth, "basic-auth", os.Getenv("EPG_BASIC_AUTH"), "user:password required for everything but /healthz and /admin (default $EPG_BASIC_AUTH; empty disables)")
+	opts := registerGenerateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	for _, domain := range strings.Split(*domains, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			hosting.Domains = append(hosting.Domains, domain)
+		}
+	}
+	hosting.CertCache = opts.cachePath(hosting.CertCache)
+	if err := hosting.validate(); err != nil {
+		return err
+	}
+
+	if err := opts.validateLayout(); err != nil {
+		return err
+	}
+	loc, fellBack, err := loadTimezone(opts.Timezone, opts.TimezoneFallback)
+	if err != nil {
+		return err
+	}
+	if fellBack {
+		fmt.Printf("⚠️  Timezone %s is not available on this system; using the fixed offset %s\n", opts.Timezone, loc)
+	}
+
+	dirs, err := opts.localDayDirs("serve")
+	if err != nil {
+		return err
+	}
+	access, err := openAccessLog(*accessLogFile)
+	if err != nil {
+		return fmt.Errorf("opening access log: %v", err)
+	}
+	server := &guideServer{loc: loc, dirs: dirs, groupsFile: *groupsFile, filterFile: opts.FilterFile, adminToken: *adminToken, aliasFile: opts.AliasFile, aliasMatch: matchesAliases(opts.MatchStrategies), outputRoot: opts.Output, access: access, basicAuth: hosting.BasicAuth}
+	if err := server.refresh(); err != nil {
+		return fmt.Errorf("loading outputs: %v", err)
+	}
+	logMessage(fmt.Sprintf("📡 Serving %d channels on %s://%s (access log: %s)", len(server.guide.Load().Schedules), hosting.scheme(), hosting.Addr, access))
+	if hosting.BasicAuth != "" && hosting.scheme() == "http" {
+		logMessage("⚠️  --basic-auth without TLS sends the password in the clear; put the server behind HTTPS or use --tls-domains")
+	}
+
+	if *refresh > 0 {
+		config, err := newConfigHolder(opts)
+		if err != nil {
+			return err
+		}
+		go config.reloadOnSignal()
+		server.wake = make(chan struct{}, 1)
+		opts.Hooks.OnRunFinished = server.metrics.record
+		var aliasChanges chan []string
+		if *watchAliasFile > 0 && !server.aliasMatch {
+			logMessage(fmt.Sprintf("⚠️  Not watching %s: --match %s has no alias strategy, so its aliases are not used", opts.AliasFile, opts.MatchStrategies))
+		} else if *watchAliasFile > 0 {
+			aliasChanges = make(chan []string)
+			server.aliasWatch = true
+			go watchAliases(opts.AliasFile, *watchAliasFile, aliasChanges)
+		}
+		go runDaemon(server, opts, daemonSchedule{
+			FullEvery:     *refresh,
+			VolatileEvery: *volatileRefresh,
+			VolatileFile:  *volatileFile,
+			AliasChanges:  aliasChanges,
+		}, config)
+	}
+
+	return hosting.listen(server.routes())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+)
+
+// publishedFile is one generated file listed in index.html and sitemap.xml.
+type publishedFile struct {
+	Path       string
+	Channel    string
+	Date       string
+	Programmes int
+}
+
+// saveStaticIndex writes index.html and sitemap.xml so static hosts without
+// directory listings still let people and crawlers discover the files.
+// baseURL is prefixed to sitemap locations, which must be absolute.
+func saveStaticIndex(out OutputFS, published []publishedFile, baseURL, generatedAt string) error {
+	files := make([]publishedFile, len(published))
+	copy(files, published)
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].Date != files[j].Date {
+			return files[i].Date < files[j].Date
+		}
+		return files[i].Path < files[j].Path
+	})
+
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>EPG Guide Files</title>\n</head>\n<body>\n")
+	page.WriteString("<h1>EPG Guide Files</h1>\n")
+	page.WriteString(fmt.Sprintf("<p>Generated %s</p>\n", html.EscapeString(generatedAt)))
+
+	currentDate := ""
+	for _, f := range files {
+		if f.Date != currentDate {
+			if currentDate != "" {
+				page.WriteString("</ul>\n")
+			}
+			page.WriteString(fmt.Sprintf("<h2>%s</h2>\n<ul>\n", html.EscapeString(f.Date)))
+			currentDate = f.Date
+		}
+		page.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(f.Path), html.EscapeString(f.Channel)))
+	}
+	if currentDate != "" {
+		page.WriteString("</ul>\n")
+	}
+	page.WriteString("</body>\n</html>\n")
+
+	if err := out.WriteFile("index.html", []byte(page.String())); err != nil {
+		return err
+	}
+
+	type sitemapURL struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	}
+	type urlSet struct {
+		XMLName xml.Name     `xml:"urlset"`
+		XMLNS   string       `xml:"xmlns,attr"`
+		URLs    []sitemapURL `xml:"url"`
+	}
+
+	base := strings.TrimSuffix(baseURL, "/")
+	set := urlSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	set.URLs = append(set.URLs, sitemapURL{Loc: base + "/index.html", LastMod: generatedAt[:10]})
+	for _, f := range files {
+		set.URLs = append(set.URLs, sitemapURL{Loc: base + "/" + f.Path, LastMod: generatedAt[:10]})
+	}
+
+	data, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	return out.WriteFile("sitemap.xml", append([]byte(xml.Header), append(data, '\n')...))
+}
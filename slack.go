@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// coverageDropThreshold is the share of programmes a channel may lose
+// between runs before the report calls it out.
+const coverageDropThreshold = 0.25
+
+// slackListLimit caps the lines per report section; Slack rejects section
+// text over 3000 characters.
+const slackListLimit = 20
+
+// RunReport summarises a run for notifications.
+type RunReport struct {
+	Title         string
+	Processed     int
+	SavedToday    int
+	SavedTomorrow int
+	Skipped       int
+	Failures      []string
+	// DeadSources are alerts for sources that failed run after run at the
+	// same URL, which need their URL updated rather than a retry.
+	DeadSources   []string
+	CoverageDrops []CoverageDrop
+	NewUnmatched  []string
+	// ReplacedLineups are schedules that changed almost entirely since the
+	// previous run, usually a feed bug.
+	ReplacedLineups []ScheduleChange
+	Links           []ReportLink
+}
+
+// CoverageDrop is a channel that lists markedly fewer programmes than in the
+// previous run.
+type CoverageDrop struct {
+	Channel string
+	Before  int
+	After   int
+}
+
+type ReportLink struct {
+	Text string
+	URL  string
+}
+
+// compareRuns finds channels whose programme count fell by at least
+// coverageDropThreshold, and rules unmatched now that were matched (or not
+// tried) last time.
+func compareRuns(previous, current RunMetadata) ([]CoverageDrop, []string) {
+	drops := make([]CoverageDrop, 0)
+	for channel, before := range previous.Programmes {
+		after, exists := current.Programmes[channel]
+		if !exists && !contains(current.Unmatched, channel) {
+			continue // not part of this run
+		}
+		if before > 0 && float64(before-after) >= coverageDropThreshold*float64(before) {
+			drops = append(drops, CoverageDrop{Channel: channel, Before: before, After: after})
+		}
+	}
+	sort.Slice(drops, func(i, j int) bool {
+		return drops[i].Channel < drops[j].Channel
+	})
+
+	newUnmatched := make([]string, 0)
+	for _, channel := range current.Unmatched {
+		if !contains(previous.Unmatched, channel) {
+			newUnmatched = append(newUnmatched, channel)
+		}
+	}
+	return drops, newUnmatched
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// slackBlocks formats the report as a Slack Block Kit message.
+func slackBlocks(report RunReport) map[string]any {
+	status := "✅"
+	if len(report.Failures) > 0 || len(report.DeadSources) > 0 || len(report.CoverageDrops) > 0 || len(report.NewUnmatched) > 0 || len(report.ReplacedLineups) > 0 {
+		status = "⚠️"
+	}
+	summary := fmt.Sprintf("*%d* processed · *%d* today · *%d* tomorrow · *%d* skipped",
+		report.Processed, report.SavedToday, report.SavedTomorrow, report.Skipped)
+
+	blocks := []map[string]any{
+		{"type": "header", "text": map[string]any{"type": "plain_text", "text": status + " " + report.Title}},
+		{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": summary}},
+	}
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		if len(lines) > slackListLimit {
+			lines = append(lines[:slackListLimit:slackListLimit], fmt.Sprintf("…and %d more", len(lines)-slackListLimit))
+		}
+		blocks = append(blocks,
+			map[string]any{"type": "divider"},
+			map[string]any{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": "*" + title + "*\n" + strings.Join(lines, "\n")}},
+		)
+	}
+
+	section("🪦 Sources likely dead: update their URLs", bulleted(report.DeadSources))
+	section("Failures", bulleted(report.Failures))
+	drops := make([]string, len(report.CoverageDrops))
+	for i, drop := range report.CoverageDrops {
+		drops[i] = fmt.Sprintf("• %s: %d → %d programmes", drop.Channel, drop.Before, drop.After)
+	}
+	section("Coverage drops", drops)
+	section("Newly unmatched channels", bulleted(report.NewUnmatched))
+	replaced := make([]string, len(report.ReplacedLineups))
+	for i, change := range report.ReplacedLineups {
+		replaced[i] = fmt.Sprintf("• %s (%s): %.0f%% of %d slots changed", change.Channel, change.Date, change.Changed*100, change.Slots)
+	}
+	section("Replaced lineups", replaced)
+
+	if len(report.Links) > 0 {
+		buttons := make([]map[string]any, len(report.Links))
+		for i, link := range report.Links {
+			buttons[i] = map[string]any{
+				"type": "button",
+				"text": map[string]any{"type": "plain_text", "text": link.Text},
+				"url":  link.URL,
+			}
+		}
+		blocks = append(blocks, map[string]any{"type": "actions", "elements": buttons})
+	}
+
+	// text is the fallback shown in notifications.
+	return map[string]any{"text": report.Title + ": " + strings.ReplaceAll(summary, "*", ""), "blocks": blocks}
+}
+
+func bulleted(lines []string) []string {
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = "• " + line
+	}
+	return result
+}
+
+// postSlack sends the report to a Slack incoming webhook.
+func postSlack(webhook string, report RunReport) error {
+	body, err := json.Marshal(slackBlocks(report))
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack webhook returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// notifySlack posts the report when a webhook is configured. Failing to
+// notify is logged but does not fail the run.
+func notifySlack(opts *GenerateOptions, report RunReport) {
+	if opts.SlackWebhook == "" {
+		return
+	}
+	if err := postSlack(opts.SlackWebhook, report); err != nil {
+		logMessage(fmt.Sprintf("⚠️  Could not send Slack report: %v", err))
+		return
+	}
+	logMessage("📣 Slack report sent")
+}
+
+// reportLinks points the report's buttons at the published files.
+func reportLinks(baseURL string, prewarm bool) []ReportLink {
+	if baseURL == "" {
+		return nil
+	}
+	base := strings.TrimSuffix(baseURL, "/")
+	links := []ReportLink{
+		{Text: "Guide index", URL: base + "/index.html"},
+		{Text: "Analytics", URL: base + "/analytics.json"},
+	}
+	if prewarm {
+		links = append(links, ReportLink{Text: "Quality report", URL: base + "/quality-report.json"})
+	}
+	return links
+}
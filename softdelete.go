@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// removedChannels are the channel files of channels that no filter rule
+// writes any more, kept for --removed-grace after the previous run published
+// them rather than vanishing at once, so clients holding them in a cache
+// have time to notice. Each is the previous copy, marked deprecated.
+type removedChannels struct {
+	files map[string]*ChannelJSON
+	// expired are the channels whose grace period is over, by slug.
+	expired []string
+}
+
+// keptRemovedChannels reads back, before the output folders are cleared,
+// the files the previous run published in dirs for channels whose slug is
+// not in current, and marks them deprecated from now unless they already
+// were. A channel deprecated longer than grace ago is not kept. Nothing is
+// kept when grace is 0 or the output cannot be read back.
+func keptRemovedChannels(backend OutputFS, dirs []string, current map[string]bool, grace time.Duration, now time.Time) removedChannels {
+	removed := removedChannels{files: make(map[string]*ChannelJSON)}
+	if grace <= 0 {
+		return removed
+	}
+	reader, ok := backend.(interface {
+		ReadFile(name string) ([]byte, error)
+	})
+	previous := loadManifest(backend)
+	if !ok || previous == nil {
+		return removed
+	}
+	inDirs := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		inDirs[dir] = true
+	}
+	expired := make(map[string]bool)
+	for name := range previous.Files {
+		dir, file := path.Split(name)
+		if !inDirs[strings.TrimSuffix(dir, "/")] || strings.HasSuffix(file, patchSuffix) {
+			continue
+		}
+		slug, _ := parsePageFile(file)
+		if current[slug] {
+			continue
+		}
+		data, err := reader.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var schedule ChannelJSON
+		if json.Unmarshal(data, &schedule) != nil {
+			continue
+		}
+		if !schedule.Deprecated {
+			schedule.Deprecated, schedule.DeprecatedSince = true, now.Format(time.RFC3339)
+		}
+		if since, err := time.Parse(time.RFC3339, schedule.DeprecatedSince); err == nil && now.Sub(since) > grace {
+			expired[slug] = true
+			continue
+		}
+		removed.files[name] = &schedule
+	}
+	for slug := range expired {
+		removed.expired = append(removed.expired, slug)
+	}
+	sort.Strings(removed.expired)
+	return removed
+}
+
+// names returns the kept files in order.
+func (r removedChannels) names() []string {
+	names := make([]string, 0, len(r.files))
+	for name := range r.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// identities lists the kept channels for channels.json, once each.
+func (r removedChannels) identities() []ChannelIdentity {
+	seen := make(map[string]bool)
+	identities := make([]ChannelIdentity, 0)
+	for _, name := range r.names() {
+		schedule := r.files[name]
+		slug, _ := parsePageFile(path.Base(name))
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		identities = append(identities, ChannelIdentity{
+			ID:         schedule.ChannelID,
+			Name:       schedule.ChannelName,
+			File:       slug + ".json",
+			Providers:  schedule.ProviderIDs,
+			Deprecated: true,
+		})
+	}
+	return identities
+}
+
+// save writes the kept files back through out.
+func (r removedChannels) save(out OutputFS) error {
+	for _, name := range r.names() {
+		data, err := json.MarshalIndent(r.files[name], "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := out.WriteFile(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
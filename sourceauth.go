@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sourceAuth is the Authorization a feed needs: a bearer token, or a user
+// name and password for basic authentication.
+type sourceAuth struct {
+	Bearer   string `yaml:"bearer,omitempty" json:"bearer,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+}
+
+// feedHeaders are the configured headers of each feed URL, added by httpGet
+// to every request for it. The providers a run loads register theirs.
+var feedHeaders = make(map[string]http.Header)
+
+// registerFeedHeaders makes httpGet send each provider's headers.
+func registerFeedHeaders(providers []Provider) {
+	headers := make(map[string]http.Header)
+	for _, p := range providers {
+		if len(p.Header) > 0 {
+			headers[p.URL] = p.Header
+		}
+	}
+	feedHeaders = headers
+}
+
+// requestHeader builds the headers of a sources.yaml entry. Values may name
+// environment variables as ${NAME}, so keys and passwords can stay out of
+// the file; an unset variable is an error rather than an empty header.
+func (e sourceEntry) requestHeader() (http.Header, error) {
+	header := make(http.Header)
+	for key, value := range e.Headers {
+		value, err := expandSecret(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %v", key, err)
+		}
+		header.Set(key, value)
+	}
+	if e.UserAgent != "" {
+		value, err := expandSecret(e.UserAgent)
+		if err != nil {
+			return nil, fmt.Errorf("user_agent: %v", err)
+		}
+		header.Set("User-Agent", value)
+	}
+	if e.Auth != nil {
+		value, err := e.Auth.authorization()
+		if err != nil {
+			return nil, fmt.Errorf("auth: %v", err)
+		}
+		header.Set("Authorization", value)
+	}
+	return header, nil
+}
+
+// authorization returns the Authorization header value.
+func (a sourceAuth) authorization() (string, error) {
+	switch {
+	case a.Bearer != "" && (a.Username != "" || a.Password != ""):
+		return "", fmt.Errorf("give either bearer or username and password, not both")
+	case a.Bearer != "":
+		token, err := expandSecret(a.Bearer)
+		return "Bearer " + token, err
+	case a.Username != "":
+		user, err := expandSecret(a.Username)
+		if err != nil {
+			return "", err
+		}
+		password, err := expandSecret(a.Password)
+		if err != nil {
+			return "", err
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)), nil
+	}
+	return "", fmt.Errorf("expected bearer, or username and password")
+}
+
+// expandSecret replaces ${NAME} in value with the environment variable.
+func expandSecret(value string) (string, error) {
+	var missing []string
+	expanded := os.Expand(value, func(name string) string {
+		v, set := os.LookupEnv(name)
+		if !set {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
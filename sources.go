@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// xmltvSource is the default source type: a gzipped or plain XMLTV document
+// over HTTP or in a local file, with conditional requests, resumed downloads
+// and the feed cache.
+const xmltvSource = "xmltv"
+
+// Source is a provider feed of another type, such as a JSON EPG API or a
+// guide page to scrape. It returns the schedule as the TV document an XMLTV
+// feed would decode to, so matching and output work on it unchanged.
+type Source interface {
+	// Fetch gets the provider's current schedule. ctx ends when the
+	// download timeout passes.
+	Fetch(ctx context.Context) (*TV, error)
+}
+
+// sourceTypes build the Source of each provider type other than xmltv,
+// keyed by the type name used in sources.yaml. A new provider type is added
+// by registering its constructor here; the provider's URL is passed on for
+// the source to interpret.
+var sourceTypes = map[string]func(provider Provider) (Source, error){
+	"stdin": func(Provider) (Source, error) { return stdinSource{}, nil },
+}
+
+// sourceTypeNames lists the known source types, for error messages.
+func sourceTypeNames() string {
+	names := []string{xmltvSource}
+	for name := range sourceTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return strings.Join(names, ", ")
+}
+
+// isXMLTV reports whether p is fetched as an XMLTV feed rather than through
+// a registered Source.
+func (p Provider) isXMLTV() bool {
+	return p.Type == "" || p.Type == xmltvSource
+}
+
+// fetchSource fetches a provider that is not an XMLTV feed through its
+// Source, within the download timeout.
+func fetchSource(provider Provider) (*TV, error) {
+	build, exists := sourceTypes[provider.Type]
+	if !exists {
+		return nil, fmt.Errorf("unknown source type %q (known: %s)", provider.Type, sourceTypeNames())
+	}
+	source, err := build(provider)
+	if err != nil {
+		return nil, err
+	}
+	ctx := feedContext
+	if timeouts.Download > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeouts.Download)
+		defer cancel()
+	}
+	tv, err := source.Fetch(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = &stageTimeoutError{Stage: "download", URL: provider.URL, Limit: timeouts.Download}
+		logMessage(fmt.Sprintf("   ⏱️  %s: %v", provider.URL, err))
+	}
+	if err == nil && tv == nil {
+		err = fmt.Errorf("%s source returned no schedule", provider.Type)
+	}
+	return tv, err
+}
+
+// encodeEPG encodes tv as a gzipped XMLTV document, so `epg fetch` can save
+// any source type in the same form as a downloaded feed.
+func encodeEPG(tv *TV) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, xml.Header)
+	if err := xml.NewEncoder(zw).Encode(tv); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stdinProvider is the only feed of a --stdin run.
+var stdinProvider = Provider{Name: "Stdin", Label: "stdin", URL: "-", Type: "stdin", Required: true}
+
+// stdinSource reads a gzipped or plain XMLTV document from standard input,
+// for pipelines such as `curl -s URL | epg generate --stdin`.
+type stdinSource struct{}
+
+func (stdinSource) Fetch(ctx context.Context) (*TV, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, parseError{errors.New("nothing on standard input")}
+	}
+	return decodeEPGWithin("stdin", bytes.NewReader(data))
+}
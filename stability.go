@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lineupReplacedThreshold is the share of a day's slots that may change
+// between runs before the report flags the lineup as replaced. Real schedule
+// edits touch a few slots; a provider swapping in another channel's
+// programmes changes nearly all of them.
+const lineupReplacedThreshold = 0.8
+
+// minStabilitySlots is the smallest schedule judged for replacement; a
+// handful of slots changes wholesale too easily.
+const minStabilitySlots = 4
+
+// ScheduleChange is how much of one channel's schedule for a date differs
+// from the previous run.
+type ScheduleChange struct {
+	Channel string
+	Date    string
+	// Changed is the share of slots (0–1) present in only one of the runs.
+	Changed float64
+	Slots   int
+}
+
+// scheduleSlots fingerprints programmes as "15:04 title" slots in loc.
+func scheduleSlots(programmes []Programme, loc *time.Location) []string {
+	slots := make([]string, 0, len(programmes))
+	for _, prog := range programmes {
+		start, err := parseEPGTime(prog.Start, loc)
+		if err != nil {
+			continue
+		}
+		slots = append(slots, start.Format("15:04")+" "+strings.TrimSpace(prog.Title))
+	}
+	sort.Strings(slots)
+	return slots
+}
+
+// slotChange returns the share of slots in before or after that are not in
+// both.
+func slotChange(before, after []string) float64 {
+	remaining := make(map[string]int, len(before))
+	for _, slot := range before {
+		remaining[slot]++
+	}
+	common := 0
+	for _, slot := range after {
+		if remaining[slot] > 0 {
+			remaining[slot]--
+			common++
+		}
+	}
+	union := len(before) + len(after) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(union-common) / float64(union)
+}
+
+// compareSchedules measures, for every date and channel both runs published,
+// how much the schedule changed. Results are sorted by date, then by the
+// largest change.
+func compareSchedules(previous, current RunMetadata) []ScheduleChange {
+	changes := make([]ScheduleChange, 0)
+	for date, channels := range current.Slots {
+		before, exists := previous.Slots[date]
+		if !exists {
+			continue
+		}
+		for channel, slots := range channels {
+			previousSlots, exists := before[channel]
+			if !exists {
+				continue
+			}
+			changes = append(changes, ScheduleChange{
+				Channel: channel,
+				Date:    date,
+				Changed: slotChange(previousSlots, slots),
+				Slots:   len(slots),
+			})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Date != changes[j].Date {
+			return changes[i].Date < changes[j].Date
+		}
+		if changes[i].Changed != changes[j].Changed {
+			return changes[i].Changed > changes[j].Changed
+		}
+		return changes[i].Channel < changes[j].Channel
+	})
+	return changes
+}
+
+// replacedLineups returns the changes large enough to suggest a provider
+// replaced the channel's lineup.
+func replacedLineups(changes []ScheduleChange) []ScheduleChange {
+	replaced := make([]ScheduleChange, 0)
+	for _, change := range changes {
+		if change.Slots >= minStabilitySlots && change.Changed >= lineupReplacedThreshold {
+			replaced = append(replaced, change)
+		}
+	}
+	return replaced
+}
+
+// logScheduleStability logs a line per date listing the channels whose
+// schedule changed, and a warning per replaced lineup.
+func logScheduleStability(changes []ScheduleChange) {
+	if len(changes) == 0 {
+		return
+	}
+	byDate := make(map[string][]string)
+	total := make(map[string]int)
+	dates := make([]string, 0)
+	for _, change := range changes {
+		if total[change.Date] == 0 {
+			dates = append(dates, change.Date)
+		}
+		total[change.Date]++
+		if change.Changed > 0 {
+			byDate[change.Date] = append(byDate[change.Date], fmt.Sprintf("%s %.0f%%", change.Channel, change.Changed*100))
+		}
+	}
+	for _, date := range dates {
+		changed := byDate[date]
+		line := fmt.Sprintf("📊 %s schedules vs previous run: %d of %d channels unchanged", date, total[date]-len(changed), total[date])
+		if len(changed) > 0 {
+			line += "; changed: " + strings.Join(changed, ", ")
+		}
+		logMessage(line)
+	}
+	for _, change := range replacedLineups(changes) {
+		logMessage(fmt.Sprintf("🚨 %s lineup for %s looks replaced: %.0f%% of %d slots changed since the previous run", change.Channel, change.Date, change.Changed*100, change.Slots))
+	}
+}
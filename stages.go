@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The stage commands split a generation run so CI can run and check each
+// part on its own: `epg fetch` saves the feeds, `epg match` shows what each
+// filter rule resolves to, `epg generate` writes the outputs and `epg
+// validate` checks the configuration without touching the network. match and
+// generate read the saved feeds with --feeds.
+
+// defaultFeedsDir is where `epg fetch` saves feeds when --feeds is not given.
+const defaultFeedsDir = "feeds"
+
+// fetchedFeedsIndex lists the feeds in a --feeds directory.
+const fetchedFeedsIndex = "feeds.json"
+
+// fetchedFeed is one feed saved by `epg fetch`.
+type fetchedFeed struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	File      string `json:"file"`
+	SHA256    string `json:"sha256"`
+	FetchedAt string `json:"fetched_at"`
+}
+
+// runGenerateCommand implements `epg generate`, the run the binary does when
+// given no command. Unlike the bare binary it exits non-zero on any failed
+// run, which is what CI wants.
+func runGenerateCommand(args []string) error {
+	if wantsProfiles(args) {
+		return runProfiles(args)
+	}
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	opts := registerGenerateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return runGenerate(opts)
+}
+
+// runFetch implements `epg fetch`: it downloads every enabled feed into
+// --feeds (default feeds/) with an index of what came from where. A required
+// feed that cannot be downloaded fails the command; optional ones are
+// skipped with a warning.
+func runFetch(args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	opts := registerGenerateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.envErr != nil {
+		return opts.envErr
+	}
+	stopWatchdog, err := startWatchdog(opts)
+	if err != nil {
+		return err
+	}
+	defer stopWatchdog()
+	if opts.Chaos != "" {
+		stop, err := startChaos(opts.Chaos)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+	dir := opts.FeedsDir
+	if dir == "" {
+		dir = defaultFeedsDir
+	}
+
+	providers, err := opts.providers()
+	if err != nil {
+		return fmt.Errorf("loading %s: %v", opts.SourcesFile, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	type download struct {
+		feed     fetchedFeed
+		channels int
+		err      error
+	}
+	downloads := fetchProviders(providers, opts.Downloads, func(provider Provider) download {
+		fmt.Printf("📥 Downloading %s EPG...\n", provider.Label)
+		feed, channels, err := fetchFeed(provider, dir)
+		return download{feed, channels, err}
+	})
+	feeds := make([]fetchedFeed, 0, len(providers))
+	var firstFailure error
+	for i, provider := range providers {
+		feed, channels, err := downloads[i].feed, downloads[i].channels, downloads[i].err
+		if err != nil && firstFailure == nil {
+			firstFailure = &sourceError{Label: provider.Label, Err: err}
+		}
+		if err != nil && provider.Required {
+			fmt.Printf("❌ Error downloading %s EPG: %v; continuing with the other sources\n", provider.Label, err)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("⚠️  Skipping %s EPG: %v\n", provider.Label, err)
+			continue
+		}
+		fmt.Printf("✅ %s: %d channels saved to %s\n", provider.Label, channels, filepath.Join(dir, feed.File))
+		feeds = append(feeds, feed)
+	}
+	if len(feeds) == 0 && firstFailure != nil {
+		return firstFailure
+	}
+
+	data, err := json.MarshalIndent(feeds, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, fetchedFeedsIndex), append(data, '\n')); err != nil {
+		return err
+	}
+	fmt.Printf("\n🎉 %d feeds saved in %s; use --feeds %s with match or generate\n", len(feeds), dir, dir)
+	return nil
+}
+
+// fetchFeedBody returns provider's feed as gzipped or plain XMLTV, and the
+// schedule it decodes to.
+func fetchFeedBody(provider Provider) ([]byte, *TV, error) {
+	if !provider.isXMLTV() {
+		tv, err := fetchSource(provider)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := encodeEPG(tv)
+		return body, tv, err
+	}
+	resp, err := httpGet(provider.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := readFeedBody(provider.URL, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	tv, err := decodeEPGWithin(provider.URL, bytes.NewReader(body))
+	return body, tv, err
+}
+
+// fetchFeed downloads provider's feed into dir, checking it parses before
+// replacing any earlier copy, and returns its index entry and channel count.
+// Other source types are saved as the XMLTV their schedule encodes to.
+func fetchFeed(provider Provider, dir string) (fetchedFeed, int, error) {
+	body, tv, err := fetchFeedBody(provider)
+	if err != nil {
+		return fetchedFeed{}, 0, err
+	}
+
+	sum := sha256.Sum256(body)
+	feed := fetchedFeed{
+		Name:      provider.Name,
+		URL:       provider.URL,
+		File:      strings.ToLower(provider.Name) + ".xml.gz",
+		SHA256:    hex.EncodeToString(sum[:]),
+		FetchedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := writeFileAtomic(filepath.Join(dir, feed.File), body); err != nil {
+		return fetchedFeed{}, 0, err
+	}
+	return feed, len(tv.Channels), nil
+}
+
+// loadFetchedFeeds reads the feeds `epg fetch` saved in dir into a pinned
+// cache keyed by URL, so a run uses them instead of downloading. Feeds not
+// in dir are still downloaded.
+func loadFetchedFeeds(dir string) (*feedCache, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fetchedFeedsIndex))
+	if err != nil {
+		return nil, fmt.Errorf("%v (run `epg fetch --feeds %s` first)", err, dir)
+	}
+	var feeds []fetchedFeed
+	if err := json.Unmarshal(data, &feeds); err != nil {
+		return nil, fmt.Errorf("%s: %v", fetchedFeedsIndex, err)
+	}
+
+	cache := newFeedCache()
+	cache.pinned = true
+	for _, feed := range feeds {
+		file, err := os.Open(filepath.Join(dir, filepath.Base(feed.File)))
+		if err != nil {
+			return nil, err
+		}
+		tv, err := decodeEPG(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", feed.File, err)
+		}
+		cache.feeds[feed.URL] = &cachedFeed{TV: tv}
+	}
+	return cache, nil
+}
+
+// matchSetup is what resolving filter rules needs: the loaded sources and
+// rules, the matcher and the overlap settings, for commands that match
+// without generating.
+type matchSetup struct {
+	opts         *GenerateOptions
+	loc          *time.Location
+	today        time.Time
+	rules        []FilterRule
+	sources      []*EPGSource
+	matcher      MatcherChain
+	overlap      string
+	overlapRules map[string]string
+	store        *StateStore
+}
+
+// prepareMatch parses a command's generate flags and loads the configuration
+// and feeds (from --feeds, or downloaded) it names. The caller closes the
+// returned store.
+func prepareMatch(fs *flag.FlagSet, args []string) (*matchSetup, error) {
+	opts := registerGenerateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if err := opts.validateLayout(); err != nil {
+		return nil, err
+	}
+	loc, fellBack, err := loadTimezone(opts.Timezone, opts.TimezoneFallback)
+	if err != nil {
+		return nil, err
+	}
+	if fellBack {
+		fmt.Printf("⚠️  Timezone %s is not available on this system; using the fixed offset %s\n", opts.Timezone, loc)
+	}
+	if _, err := startWatchdog(opts); err != nil {
+		return nil, err
+	}
+	now := time.Now().In(loc)
+	setup := &matchSetup{opts: opts, loc: loc, today: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)}
+
+	providers, err := opts.providers()
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %v", opts.SourcesFile, err)
+	}
+	lineups, err := loadLineups(opts.LineupDir)
+	if err != nil {
+		return nil, fmt.Errorf("loading lineups: %v", err)
+	}
+	if !opts.AllChannels {
+		if setup.rules, err = loadFilterRules(opts.FilterFile); err != nil {
+			return nil, fmt.Errorf("loading %s: %v", opts.FilterFile, err)
+		}
+	}
+	aliases, err := loadAliases(opts.AliasFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %v", opts.AliasFile, err)
+	}
+	if setup.overlap, err = parseOverlapStrategy(opts.Overlap); err != nil {
+		return nil, fmt.Errorf("invalid --overlap: %v", err)
+	}
+	if setup.overlapRules, err = loadOverlapRules(opts.OverlapFile); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", opts.OverlapFile, err)
+	}
+	if setup.store, err = openStateStore(opts.statePath()); err != nil {
+		return nil, fmt.Errorf("opening %s: %v", opts.statePath(), err)
+	}
+	if setup.matcher, err = buildMatcherChain(opts.MatchStrategies, aliases, setup.store); err != nil {
+		setup.store.Close()
+		return nil, fmt.Errorf("invalid --match: %v", err)
+	}
+	// Nothing is published, so there is no one to ask
+	setup.matcher = setup.matcher.nonInteractive()
+
+	feeds := opts.feeds
+	if opts.FeedsDir != "" {
+		if feeds, err = loadFetchedFeeds(opts.FeedsDir); err != nil {
+			setup.store.Close()
+			return nil, err
+		}
+	}
+	type download struct {
+		tv  *TV
+		err error
+	}
+	downloads := fetchProviders(providers, opts.Downloads, func(provider Provider) download {
+		logMessage(fmt.Sprintf("📥 Loading %s EPG...", provider.Label))
+		tv, err := feeds.fetchProvider(provider)
+		return download{tv, err}
+	})
+	var firstFailure error
+	for i, provider := range providers {
+		tv, err := downloads[i].tv, downloads[i].err
+		if err != nil && firstFailure == nil {
+			firstFailure = &sourceError{Label: provider.Label, Err: err}
+		}
+		if err != nil && provider.Required {
+			logMessage(fmt.Sprintf("❌ Error downloading %s EPG: %v; continuing with the other sources", provider.Label, err))
+			continue
+		}
+		if err != nil {
+			logMessage(fmt.Sprintf("⚠️  Skipping %s EPG: %v", provider.Label, err))
+			continue
+		}
+		src := newEPGSource(provider, tv)
+		if lineup, exists := lineups[strings.ToLower(provider.Name)]; exists {
+			indexLineup(src, provider, lineup)
+		}
+		setup.sources = append(setup.sources, src)
+	}
+	if len(setup.sources) == 0 && firstFailure != nil {
+		setup.store.Close()
+		return nil, firstFailure
+	}
+	if opts.AllChannels {
+		setup.rules, _ = discoverRules(providers, setup.sources)
+	}
+	if opts.partial() {
+		setup.rules = selectFilterRules(setup.rules, opts.Only, opts.Skip)
+	}
+	return setup, nil
+}
+
+// ruleDays returns the zone and first day of rule's window: the run's,
+// unless the rule has its own timezone.
+func (m *matchSetup) ruleDays(rule FilterRule) (*time.Location, time.Time) {
+	if rule.Timezone == "" {
+		return m.loc, m.today
+	}
+	loc := ruleLocation(rule, m.loc)
+	return loc, time.Date(m.today.Year(), m.today.Month(), m.today.Day(), 0, 0, 0, 0, loc)
+}
+
+// runMatch implements `epg match`: it resolves every filter rule as a run
+// would and prints the channel each one matched, without writing outputs or
+// recording matches. It fails when any rule matches nothing, so CI catches a
+// channel renamed upstream before it reaches the published files.
+func runMatch(args []string) error {
+	setup, err := prepareMatch(flag.NewFlagSet("match", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	defer setup.store.Close()
+
+	fmt.Printf("\n🧩 Matching %d rules (%s)\n", len(setup.rules), setup.matcher.Name())
+	unmatched := make([]string, 0)
+	for _, rule := range setup.rules {
+		loc, today := setup.ruleDays(rule)
+		ruleSources := pinnedSources(setup.sources, rule.Source)
+		match := setup.matcher.Match(rule, ruleSources)
+		if match == nil {
+			unmatched = append(unmatched, rule.OriginalName)
+			fmt.Printf("❌ %s: not found\n", rule.OriginalName)
+			continue
+		}
+		strategy := overlapStrategyFor(rule, setup.overlap, setup.overlapRules)
+		match = resolveOverlap(strategy, match, rule, setup.matcher, ruleSources, today, today.AddDate(0, 0, setup.opts.Days), loc, setup.opts.DuplicateTolerance)
+		fmt.Printf("✅ %s → %s (from %s, ID: %s, via %s, %s)\n", rule.OriginalName, match.Channel.DisplayName, match.sources(), match.Channel.ID, match.Strategy, match.Overlap)
+	}
+
+	if len(unmatched) > 0 {
+		return fmt.Errorf("%d of %d rules matched no channel: %s", len(unmatched), len(setup.rules), strings.Join(unmatched, ", "))
+	}
+	fmt.Printf("\n🎉 All %d rules matched\n", len(setup.rules))
+	return nil
+}
+
+// runValidate implements `epg validate`: the checks of `epg doctor` that
+// need no network, disk or state, so CI can check a change to filter.txt or
+// the other configuration files before it is merged.
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	opts := registerGenerateFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	fmt.Println("🔎 Validating configuration...")
+	checks := []doctorCheck{
+		checkEnvironment(opts.envErr),
+		checkLayout(opts),
+		checkTimezone(opts.Timezone, opts.TimezoneFallback),
+		checkSourcesFile(opts),
+		checkFilterFile(opts.FilterFile),
+		checkAliasFile(opts.AliasFile),
+		checkLogoFile(opts.LogoFile),
+		checkLineups(opts.LineupDir),
+	}
+	if failed := printChecks(checks); failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	fmt.Println("\n🎉 Configuration is valid")
+	return nil
+}
+
+// checkLayout checks --days and the output folders.
+func checkLayout(opts *GenerateOptions) doctorCheck {
+	check := doctorCheck{Name: "Output layout"}
+	if err := opts.validateFolders(); err != nil {
+		check.Detail = err.Error()
+		check.Fix = fmt.Sprintf("use --days 1 to %d and different --output-today and --output-tomorrow folders inside --output", maxDays)
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%d days into %s", opts.Days, opts.Output)
+	return check
+}
+
+// checkSourcesFile checks the sources file parses and, with --providers and
+// --disable-providers, enables a feed.
+func checkSourcesFile(opts *GenerateOptions) doctorCheck {
+	check := doctorCheck{Name: "Sources"}
+	filename := opts.SourcesFile
+	providers, err := opts.providers()
+	if err != nil {
+		check.Detail = err.Error()
+		check.Fix = "fix " + filename + ": one `name = URL` per line"
+		if isSourcesConfig(filename) {
+			check.Fix = "fix " + filename + ": a `sources` list of entries with a name, url and optional priority"
+		}
+		return check
+	}
+	if len(providers) == 0 {
+		check.Detail = "every feed is disabled"
+		check.Fix = "give at least one provider a URL in " + filename
+		return check
+	}
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.Name)
+	}
+	check.OK = true
+	check.Detail = strings.Join(names, ", ")
+	return check
+}
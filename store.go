@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketMeta         = []byte("meta")
+	bucketHistory      = []byte("history")
+	bucketMatchCache   = []byte("match_cache")
+	bucketSourceHealth = []byte("source_health")
+	bucketETags        = []byte("etags")
+	bucketSlugs        = []byte("slugs")
+	bucketRuns         = []byte("runs")
+
+	keySchemaVersion = []byte("schema_version")
+)
+
+// legacyHistoryFile is the airing history written by earlier versions,
+// imported into the state store by the version 2 migration.
+const legacyHistoryFile = "epg-history.json"
+
+// stateMigrations upgrade the store one schema version at a time; entry i
+// moves a store from version i to i+1. Append new steps, never edit old ones.
+var stateMigrations = []func(tx *bolt.Tx) error{
+	// 0 -> 1: create the buckets
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketMeta, bucketHistory, bucketMatchCache, bucketSourceHealth, bucketETags, bucketSlugs, bucketRuns} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 1 -> 2: import the legacy epg-history.json
+	func(tx *bolt.Tx) error {
+		data, err := os.ReadFile(legacyHistoryFile)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var legacy AiringHistory
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return fmt.Errorf("importing %s: %v", legacyHistoryFile, err)
+		}
+		bucket := tx.Bucket(bucketHistory)
+		for slug, seen := range legacy.Channels {
+			value, err := json.Marshal(seen)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(slug), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// StateStore is the embedded bbolt database holding everything that must
+// survive between runs: airing history, match cache, source health, HTTP
+// validators, the slug registry and last-run metadata. All methods are safe
+// to call on a nil store, which disables persistence. A read-only store, as
+// used by --dry-run, reads as usual and silently drops writes.
+type StateStore struct {
+	db       *bolt.DB
+	readOnly bool
+}
+
+// openStateStore opens (or creates) the store at path and applies pending
+// migrations. An empty path returns a nil store.
+func openStateStore(path string) (*StateStore, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	store := &StateStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *StateStore) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		version := 0
+		if raw := meta.Get(keySchemaVersion); raw != nil {
+			if version, err = strconv.Atoi(string(raw)); err != nil {
+				return fmt.Errorf("invalid schema version %q", raw)
+			}
+		}
+		if version > len(stateMigrations) {
+			return fmt.Errorf("state schema version %d is newer than this binary supports (%d)", version, len(stateMigrations))
+		}
+		for ; version < len(stateMigrations); version++ {
+			if err := stateMigrations[version](tx); err != nil {
+				return fmt.Errorf("migration %d -> %d: %v", version, version+1, err)
+			}
+		}
+		return meta.Put(keySchemaVersion, []byte(strconv.Itoa(version)))
+	})
+}
+
+func (s *StateStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// getJSON decodes the value at bucket/key into v, reporting whether it existed.
+func (s *StateStore) getJSON(bucket []byte, key string, v any) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	var raw []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if value := tx.Bucket(bucket).Get([]byte(key)); value != nil {
+			raw = append([]byte(nil), value...)
+		}
+		return nil
+	})
+	if err != nil || raw == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+func (s *StateStore) putJSON(bucket []byte, key string, v any) error {
+	if s == nil || s.readOnly {
+		return nil
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), value)
+	})
+}
+
+// CachedMatch is the channel a filter rule resolved to in an earlier run.
+type CachedMatch struct {
+	Source    string `json:"source"`
+	ChannelID string `json:"channel_id"`
+	Strategy  string `json:"strategy"`
+	MatchedAt string `json:"matched_at"`
+}
+
+func (s *StateStore) CachedMatch(rule FilterRule) (CachedMatch, bool) {
+	var cached CachedMatch
+	found, err := s.getJSON(bucketMatchCache, normalizeChannelName(rule.OriginalName), &cached)
+	return cached, found && err == nil
+}
+
+func (s *StateStore) RecordMatch(rule FilterRule, match *Match) error {
+	return s.putJSON(bucketMatchCache, normalizeChannelName(rule.OriginalName), CachedMatch{
+		Source:    match.Source,
+		ChannelID: match.Channel.ID,
+		Strategy:  match.Strategy,
+		MatchedAt: time.Now().Format(time.RFC3339),
+	})
+}
+
+// SourceHealth tracks download outcomes per source across runs. The failure
+// streak belongs to URL: a new URL starts a fresh record.
+type SourceHealth struct {
+	URL                 string `json:"url,omitempty"`
+	LastSuccess         string `json:"last_success,omitempty"`
+	LastFailure         string `json:"last_failure,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+	LastKind            string `json:"last_kind,omitempty"`
+	FailingSince        string `json:"failing_since,omitempty"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+}
+
+// PruneMatchCache deletes match cache entries last confirmed before cutoff,
+// which belong to rules no longer in filter.txt or channels no longer found.
+// With dryRun it only counts them.
+func (s *StateStore) PruneMatchCache(cutoff time.Time, dryRun bool) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+	pruned := 0
+	prune := func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketMatchCache)
+		stale := make([][]byte, 0)
+		err := bucket.ForEach(func(key, value []byte) error {
+			var cached CachedMatch
+			if err := json.Unmarshal(value, &cached); err != nil {
+				stale = append(stale, append([]byte(nil), key...))
+				return nil
+			}
+			if matchedAt, err := time.Parse(time.RFC3339, cached.MatchedAt); err != nil || matchedAt.Before(cutoff) {
+				stale = append(stale, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		pruned = len(stale)
+		if dryRun {
+			return nil
+		}
+		for _, key := range stale {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if dryRun {
+		return pruned, s.db.View(prune)
+	}
+	return pruned, s.db.Update(prune)
+}
+
+// compactStateFile rewrites the database at path without free pages and
+// returns the file sizes before and after. It needs exclusive access.
+func compactStateFile(path string) (int64, int64, error) {
+	before, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	src, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: true})
+	if err != nil {
+		return 0, 0, err
+	}
+	tmp := path + ".compact"
+	dst, err := bolt.Open(tmp, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		src.Close()
+		return 0, 0, err
+	}
+	err = bolt.Compact(dst, src, 64*1024)
+	src.Close()
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, 0, err
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return before.Size(), after.Size(), nil
+}
+
+// RecordSourceResult records one run's download outcome for the source at
+// url and returns its updated health.
+func (s *StateStore) RecordSourceResult(name, url string, downloadErr error) (SourceHealth, error) {
+	var health SourceHealth
+	if _, err := s.getJSON(bucketSourceHealth, name, &health); err != nil {
+		return health, err
+	}
+	if health.URL != url {
+		health = SourceHealth{URL: url}
+	}
+	now := time.Now().Format(time.RFC3339)
+	if downloadErr == nil {
+		health.LastSuccess = now
+		health.FailingSince = ""
+		health.ConsecutiveFailures = 0
+	} else {
+		if health.ConsecutiveFailures == 0 {
+			health.FailingSince = now
+		}
+		health.LastFailure = now
+		health.LastError = downloadErr.Error()
+		health.LastKind = failureKind(downloadErr)
+		health.ConsecutiveFailures++
+	}
+	return health, s.putJSON(bucketSourceHealth, name, health)
+}
+
+// RegisterSlug records the canonical ID published under slug and returns the
+// ID previously registered for it, if it was different.
+func (s *StateStore) RegisterSlug(slug, channelID string) (string, error) {
+	var previous string
+	if _, err := s.getJSON(bucketSlugs, slug, &previous); err != nil {
+		return "", err
+	}
+	if previous == channelID {
+		return "", nil
+	}
+	return previous, s.putJSON(bucketSlugs, slug, channelID)
+}
+
+// FeedValidators returns what the last run recorded about the feed at url.
+func (s *StateStore) FeedValidators(url string) (FeedValidators, bool) {
+	var validators FeedValidators
+	found, err := s.getJSON(bucketETags, url, &validators)
+	return validators, found && err == nil
+}
+
+func (s *StateStore) RecordFeedValidators(url string, validators FeedValidators) error {
+	return s.putJSON(bucketETags, url, validators)
+}
+
+// RunMetadata summarises the most recent generation run.
+type RunMetadata struct {
+	StartedAt     string `json:"started_at"`
+	FinishedAt    string `json:"finished_at"`
+	Processed     int    `json:"processed"`
+	SavedToday    int    `json:"saved_today"`
+	SavedTomorrow int    `json:"saved_tomorrow"`
+	Skipped       int    `json:"skipped"`
+	// Programmes counts today's and tomorrow's programmes per output slug,
+	// and Unmatched lists the slugs of rules that found no channel.
+	Programmes map[string]int `json:"programmes,omitempty"`
+	Unmatched  []string       `json:"unmatched,omitempty"`
+	// Slots fingerprints each published schedule, by date and slug, for
+	// measuring how much the next run changes it.
+	Slots map[string]map[string][]string `json:"slots,omitempty"`
+	// Inputs fingerprints the configuration of a full run; runs with the
+	// same inputs and unchanged feeds are skipped.
+	Inputs string `json:"inputs,omitempty"`
+}
+
+func (s *StateStore) RecordRun(run RunMetadata) error {
+	return s.putJSON(bucketRuns, "last", run)
+}
+
+func (s *StateStore) LastRun() (RunMetadata, bool) {
+	var run RunMetadata
+	found, err := s.getJSON(bucketRuns, "last", &run)
+	return run, found && err == nil
+}
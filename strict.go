@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Exit codes, so a CI job can tell why a run failed. The bare binary only
+// uses them with --strict or when a critical channel is missing; commands
+// such as `epg generate` always do.
+const (
+	// exitFailure is any other failure, including missing critical
+	// channels.
+	exitFailure = 1
+	// exitDownload is a run none of whose feeds could be downloaded.
+	exitDownload = 3
+	// exitParse is a run whose first failed feed downloaded but could not
+	// be parsed, and no other feed could be read.
+	exitParse = 4
+	// exitPartial is a run that wrote its outputs but failed --strict or
+	// --min-output.
+	exitPartial = 5
+)
+
+// errPartialRun fails a run that wrote its outputs but did not pass the
+// --strict and --min-output checks.
+var errPartialRun = errors.New("partial success")
+
+// sourceError is the first feed that failed in a run that could read none,
+// which aborts the run.
+type sourceError struct {
+	Label string
+	Err   error
+}
+
+func (e *sourceError) Error() string { return e.Label + " EPG: " + e.Err.Error() }
+
+func (e *sourceError) Unwrap() error { return e.Err }
+
+// parseError marks a feed that downloaded but is not a readable gzipped
+// XMLTV document. It reads as the underlying error.
+type parseError struct {
+	err error
+}
+
+func (e parseError) Error() string { return e.err.Error() }
+
+func (e parseError) Unwrap() error { return e.err }
+
+// exitCode maps a failed run's error to the process exit code.
+func exitCode(err error) int {
+	var source *sourceError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &source):
+		if errors.As(source.Err, new(parseError)) {
+			return exitParse
+		}
+		return exitDownload
+	case errors.Is(err, errPartialRun):
+		return exitPartial
+	default:
+		return exitFailure
+	}
+}
+
+// strictProblems returns why a run fails --strict, which allows no unmatched
+// rules and no failed required sources, and --min-output, the share of rules
+// that must produce output.
+func strictProblems(opts *GenerateOptions, processed, withOutput int, unmatched, degraded []string) []string {
+	problems := make([]string, 0)
+	if opts.Strict && len(degraded) > 0 {
+		problems = append(problems, fmt.Sprintf("required sources failed (%s)", strings.Join(degraded, ", ")))
+	}
+	if opts.Strict && len(unmatched) > 0 {
+		problems = append(problems, fmt.Sprintf("%d rules unmatched (%s)", len(unmatched), strings.Join(unmatched, ", ")))
+	}
+	if opts.MinOutput > 0 && processed > 0 {
+		if share := float64(withOutput) * 100 / float64(processed); share < opts.MinOutput {
+			problems = append(problems, fmt.Sprintf("only %.0f%% of channels produced output (%d of %d), below --min-output %.0f%%", share, withOutput, processed, opts.MinOutput))
+		}
+	}
+	return problems
+}
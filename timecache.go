@@ -0,0 +1,61 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// epgTimeCacheSize bounds the parsed timestamps kept in memory. A feed's
+// timestamps repeat heavily, each stop being the next programme's start, and
+// a day of programmes for every channel fits comfortably.
+const epgTimeCacheSize = 16384
+
+// epgTimes is the process-wide cache behind parseEPGTime.
+var epgTimes = newEPGTimeCache(epgTimeCacheSize)
+
+// epgTimeCache is a least-recently-used cache of parsed XMLTV timestamps,
+// keyed by the raw string, so filtering, sorting and output do not parse the
+// same strings over and over. Values are UTC instants; callers convert them
+// to their own zone. Parse errors are cached too.
+type epgTimeCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type epgTimeEntry struct {
+	raw string
+	t   time.Time
+	err error
+}
+
+func newEPGTimeCache(size int) *epgTimeCache {
+	return &epgTimeCache{size: size, order: list.New(), entries: make(map[string]*list.Element, size)}
+}
+
+func (c *epgTimeCache) parse(raw string) (time.Time, error) {
+	c.mu.Lock()
+	if element, found := c.entries[raw]; found {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*epgTimeEntry)
+		c.mu.Unlock()
+		return entry.t, entry.err
+	}
+	c.mu.Unlock()
+
+	t, err := parseEPGInstant(raw)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, found := c.entries[raw]; !found {
+		c.entries[raw] = c.order.PushFront(&epgTimeEntry{raw: raw, t: t, err: err})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*epgTimeEntry).raw)
+		}
+	}
+	return t, err
+}
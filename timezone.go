@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultTimezoneFallback is IST, the default --timezone, which has no
+// daylight saving and so is exactly a fixed offset.
+const defaultTimezoneFallback = "+05:30"
+
+// loadTimezone loads name, or when the system has no zone database for it,
+// the fixed UTC offset fallback (+05:30 or +0530). It reports whether the
+// fallback was used so callers can warn that daylight saving is not applied.
+// An empty fallback keeps the load error.
+func loadTimezone(name, fallback string) (*time.Location, bool, error) {
+	loc, err := time.LoadLocation(name)
+	if err == nil {
+		return loc, false, nil
+	}
+	if fallback == "" {
+		return nil, false, fmt.Errorf("loading timezone %s: %v", name, err)
+	}
+	offset, offsetErr := parseUTCOffset(strings.TrimSpace(fallback))
+	if offsetErr != nil {
+		return nil, false, fmt.Errorf("loading timezone %s: %v; --timezone-fallback: %v", name, err, offsetErr)
+	}
+	label := strings.ReplaceAll(strings.TrimSpace(fallback), ":", "")
+	return time.FixedZone("UTC"+label[:3]+":"+label[3:], int(offset.Seconds())), true, nil
+}
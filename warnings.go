@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Warning codes, logged in front of each warning and listed in the run
+// summary, so monitoring can filter on a kind of warning instead of
+// matching log text. Codes are never reused for another meaning.
+const (
+	warnUnmatchedChannel = "W001" // a filter rule matched no channel
+	warnLowCoverage      = "W002" // a channel has no programmes, or far fewer than last run
+	warnBadTimestamps    = "W003" // a feed's timestamps lack or mix offsets, or lack stops
+	warnSourceFailed     = "W004" // a required source failed; the run is degraded
+	warnSourceSkipped    = "W005" // an optional source failed and was skipped
+	warnSourceDead       = "W006" // a source has failed run after run
+	warnLineupMissing    = "W007" // lineup channel numbers are not in the feed
+	warnOverBudget       = "W008" // a file is over --max-file-size after trimming
+	warnThrottled        = "W009" // a source answered 429 or 503
+	warnIDChanged        = "W010" // a published file changed channel_id
+	warnPinnedSource     = "W011" // a rule is pinned to a source that was not loaded
+	warnStaleFeed        = "W012" // a feed was generated longer ago than --max-feed-age
+	warnCachedFeed       = "W013" // a feed could not be downloaded and its cached copy was used
+)
+
+// Warning is one coded warning of a run. Subject is the channel or source it
+// is about.
+type Warning struct {
+	Code    string `json:"code"`
+	Subject string `json:"subject,omitempty"`
+	Message string `json:"message"`
+}
+
+// runWarnings are the warnings of the current run.
+var runWarnings []Warning
+
+// warn logs line with code inserted after its leading emoji, e.g. "❌ W001
+// Channel not found: Star Plus", and records it for the run summary.
+func warn(code, subject, line string) {
+	rest := strings.TrimLeft(line, "\n ")
+	at := len(line) - len(rest)
+	if emoji, text, found := strings.Cut(rest, " "); found {
+		at += len(emoji) + 1 + len(text) - len(strings.TrimLeft(text, " "))
+	}
+	logMessage(line[:at] + code + " " + line[at:])
+	runMu.Lock()
+	runWarnings = append(runWarnings, Warning{Code: code, Subject: subject, Message: line[at:]})
+	runMu.Unlock()
+}
+
+// warningCounts counts warnings by code.
+func warningCounts(warnings []Warning) map[string]int {
+	counts := make(map[string]int)
+	for _, w := range warnings {
+		counts[w.Code]++
+	}
+	return counts
+}
+
+// RunSummary is NAME-summary.json, written next to the run log: the run's
+// counts and every warning, by code.
+type RunSummary struct {
+	FinishedAt    string         `json:"finished_at"`
+	Processed     int            `json:"processed"`
+	SavedToday    int            `json:"saved_today"`
+	SavedTomorrow int            `json:"saved_tomorrow"`
+	Skipped       int            `json:"skipped"`
+	Degraded      []string       `json:"degraded_sources"`
+	WarningCounts map[string]int `json:"warning_counts"`
+	Warnings      []Warning      `json:"warnings"`
+}
+
+// saveRunSummary writes summary next to the run log, unless the run writes
+// no log files.
+func saveRunSummary(summary RunSummary) {
+	if logName == "" {
+		return
+	}
+	if summary.Warnings == nil {
+		summary.Warnings = make([]Warning, 0)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err == nil {
+		err = os.WriteFile(logName+"-summary.json", append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Printf("❌ Error saving run summary: %v\n", err)
+	}
+}
+
+// logWarningCounts adds the warning counts to the final summary.
+func logWarningCounts(warnings []Warning) {
+	counts := warningCounts(warnings)
+	if len(counts) == 0 {
+		return
+	}
+	codes := make([]string, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%s ×%d", code, counts[code])
+	}
+	logMessage(fmt.Sprintf("   ⚠️  Warnings: %s", strings.Join(parts, ", ")))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// feedTimeouts limits each stage of getting a feed, so a stalled server
+// fails the feed instead of hanging the run. Zero leaves a stage unlimited.
+type feedTimeouts struct {
+	Connect  time.Duration
+	Headers  time.Duration
+	Download time.Duration
+	Decode   time.Duration
+}
+
+// timeouts are the limits of the current run, set by startWatchdog.
+var timeouts feedTimeouts
+
+// feedRetries is how a failed feed request is retried: up to Attempts more
+// times, waiting Backoff, then twice as long each time, with jitter.
+type feedRetries struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+// retries is the retry policy of the current run, set by startWatchdog.
+var retries feedRetries
+
+// feedContext cancels the current run's feed requests and the waits
+// between them; it is GenerateOptions.Context, set by startWatchdog.
+var feedContext = context.Background()
+
+// stageTimeoutError is a feed stage that ran past its limit.
+type stageTimeoutError struct {
+	Stage string
+	URL   string
+	Limit time.Duration
+}
+
+func (e *stageTimeoutError) Error() string {
+	return fmt.Sprintf("%s stage timed out after %s", e.Stage, e.Limit)
+}
+
+// startWatchdog applies opts' stage timeouts, retries, proxy, politeness and
+// context to feed requests and returns the function that restores the
+// previous ones.
+func startWatchdog(opts *GenerateOptions) (func(), error) {
+	proxy, err := feedProxy(opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	var roots *x509.CertPool
+	if opts.CACert != "" {
+		if roots, err = loadCAPool(opts.CACert); err != nil {
+			return nil, fmt.Errorf("invalid --ca-cert: %v", err)
+		}
+	}
+	rate, err := parseByteSize(opts.MaxDownloadRate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --max-download-rate: %v", err)
+	}
+	previous, previousClient, previousRetries, previousContext, previousProxy, previousPoliteness, previousTempDir := timeouts, feedClient, retries, feedContext, feedProxyFor, politeness, feedTempDir
+	feedTempDir = opts.tempDir()
+	retries = feedRetries{Attempts: opts.Retries, Backoff: opts.RetryBackoff}
+	politeness = feedPoliteness{Interval: opts.HostInterval, Rate: rate}
+	feedContext = context.Background()
+	if opts.Context != nil {
+		feedContext = opts.Context
+	}
+	timeouts = feedTimeouts{
+		Connect:  opts.ConnectTimeout,
+		Headers:  opts.HeaderTimeout,
+		Download: opts.DownloadTimeout,
+		Decode:   opts.DecodeTimeout,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeouts.Connect, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeouts.Connect
+	transport.ResponseHeaderTimeout = timeouts.Headers
+	transport.Proxy = proxy
+	if roots != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	feedClient, feedProxyFor = &http.Client{Transport: transport}, proxy
+	return func() {
+		timeouts, feedClient, retries, feedContext, feedProxyFor, politeness, feedTempDir = previous, previousClient, previousRetries, previousContext, previousProxy, previousPoliteness, previousTempDir
+	}, nil
+}
+
+// retryDelay is the wait before retry number attempt (from 0): the backoff
+// doubled for each earlier retry, of which a random half is waited, so
+// runs failing together do not retry in step.
+func retryDelay(attempt int) time.Duration {
+	delay := retries.Backoff << attempt
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryable reports whether a failed request is worth repeating: a host
+// that does not resolve is not, and a canceled run stops retrying.
+func retryable(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+	return feedContext.Err() == nil
+}
+
+// sleepFeed waits d, returning early with the context's error when the run
+// is canceled.
+func sleepFeed(d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-feedContext.Done():
+		return feedContext.Err()
+	}
+}
+
+// requestTimeout turns a connect or header timeout from the transport into
+// a stageTimeoutError naming the stage, and logs it.
+func requestTimeout(url string, err error) error {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return err
+	}
+	stage := &stageTimeoutError{Stage: "headers", URL: url, Limit: timeouts.Headers}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		stage.Stage, stage.Limit = "connect", timeouts.Connect
+	}
+	logMessage(fmt.Sprintf("   ⏱️  %s: %v", url, stage))
+	return stage
+}
+
+// watchBody closes resp's body once deadline passes, so a read stalled on a
+// silent connection returns. The returned function stops the watch and
+// reports whether it had already fired.
+func watchBody(resp *http.Response, deadline time.Time) func() bool {
+	if deadline.IsZero() {
+		return func() bool { return false }
+	}
+	timer := time.AfterFunc(time.Until(deadline), func() { resp.Body.Close() })
+	return func() bool { return !timer.Stop() }
+}
+
+// decodeEPGWithin decodes a feed like decodeEPG, giving up once the decode
+// stage limit passes. The abandoned decode finishes in the background.
+// Failures are parseErrors around a feedError naming url.
+func decodeEPGWithin(url string, body io.Reader) (*TV, error) {
+	if timeouts.Decode <= 0 {
+		tv, err := decodeEPG(body)
+		if err != nil {
+			return nil, parseError{feedAt(url, err)}
+		}
+		return tv, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeouts.Decode)
+	defer cancel()
+
+	type result struct {
+		tv  *TV
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		tv, err := decodeEPG(body)
+		done <- result{tv, err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, parseError{feedAt(url, r.err)}
+		}
+		return r.tv, nil
+	case <-ctx.Done():
+		err := &stageTimeoutError{Stage: "decode", URL: url, Limit: timeouts.Decode}
+		logMessage(fmt.Sprintf("   ⏱️  %s: %v", url, err))
+		return nil, parseError{feedFailure(url, stageParse, -1, err)}
+	}
+}
+
+// feedAt names url in a decodeEPG error.
+func feedAt(url string, err error) error {
+	var failure *feedError
+	if errors.As(err, &failure) {
+		failure.URL = url
+		return failure
+	}
+	return feedFailure(url, stageParse, -1, err)
+}
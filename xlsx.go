@@ -0,0 +1,295 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gridDays is how many days, from today, the weekly grid covers. Days the
+// feeds do not reach are left empty.
+const gridDays = 7
+
+// maxSheetName is Excel's limit on worksheet names.
+const maxSheetName = 31
+
+// weeklyGrid collects the channels of a run for the --xlsx workbook: one
+// sheet per channel, with a row per time slot and a column per day.
+type weeklyGrid struct {
+	slot   time.Duration
+	sheets []gridSheet
+}
+
+type gridSheet struct {
+	name  string
+	days  []time.Time
+	cells [][]string // [slot][day]
+}
+
+func newWeeklyGrid(slot time.Duration) *weeklyGrid {
+	return &weeklyGrid{slot: slot}
+}
+
+// parseGridSlot validates --xlsx-slot: at least 5 minutes and dividing the
+// day evenly, so every day has the same rows.
+func parseGridSlot(value string) (time.Duration, error) {
+	slot, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if slot < 5*time.Minute || (24*time.Hour)%slot != 0 {
+		return 0, fmt.Errorf("%s must be at least 5m and divide 24h evenly", value)
+	}
+	return slot, nil
+}
+
+// add lays out a channel's programmes from today on, in loc. A cell lists
+// each programme starting in its slot as "19:30 Title"; a slot in which
+// nothing starts shows the programme still airing as "… Title".
+func (g *weeklyGrid) add(name string, programmes []Programme, today time.Time, loc *time.Location) {
+	type airing struct {
+		start, stop time.Time
+		title       string
+	}
+	airings := make([]airing, 0, len(programmes))
+	for _, prog := range programmes {
+		start, err := parseEPGTime(prog.Start, loc)
+		if err != nil {
+			continue
+		}
+		stop, err := parseEPGTime(prog.Stop, loc)
+		if err != nil || !stop.After(start) {
+			continue
+		}
+		airings = append(airings, airing{start: start, stop: stop, title: prog.Title})
+	}
+	sort.SliceStable(airings, func(i, j int) bool {
+		return airings[i].start.Before(airings[j].start)
+	})
+
+	rows := int(24 * time.Hour / g.slot)
+	sheet := gridSheet{name: name, days: make([]time.Time, gridDays), cells: make([][]string, rows)}
+	for row := range sheet.cells {
+		sheet.cells[row] = make([]string, gridDays)
+	}
+	found := false
+	for day := range sheet.days {
+		date := today.AddDate(0, 0, day)
+		sheet.days[day] = date
+		for row := 0; row < rows; row++ {
+			slotStart := date.Add(time.Duration(row) * g.slot)
+			slotEnd := slotStart.Add(g.slot)
+			starting := make([]string, 0)
+			continuing := ""
+			for _, a := range airings {
+				if !a.start.Before(slotEnd) {
+					break
+				}
+				switch {
+				case !a.start.Before(slotStart):
+					starting = append(starting, a.start.Format("15:04")+" "+a.title)
+				case a.stop.After(slotStart):
+					continuing = "… " + a.title
+				}
+			}
+			switch {
+			case len(starting) > 0:
+				sheet.cells[row][day] = strings.Join(starting, "\n")
+				found = true
+			case continuing != "":
+				sheet.cells[row][day] = continuing
+				found = true
+			}
+		}
+	}
+	if found {
+		g.sheets = append(g.sheets, sheet)
+	}
+}
+
+// sheetNames returns a distinct, Excel-safe name for every sheet.
+func (g *weeklyGrid) sheetNames() []string {
+	names := make([]string, len(g.sheets))
+	used := make(map[string]bool)
+	for i, sheet := range g.sheets {
+		name := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return '-'
+			}
+			return r
+		}, sheet.name)
+		name = strings.Trim(strings.TrimSpace(name), "'")
+		if name == "" {
+			name = "Channel"
+		}
+		base := []rune(name)
+		if len(base) > maxSheetName {
+			base = base[:maxSheetName]
+		}
+		candidate := string(base)
+		for n := 2; used[strings.ToLower(candidate)]; n++ {
+			suffix := fmt.Sprintf(" (%d)", n)
+			keep := base
+			if len(keep)+len(suffix) > maxSheetName {
+				keep = keep[:maxSheetName-len(suffix)]
+			}
+			candidate = string(keep) + suffix
+		}
+		used[strings.ToLower(candidate)] = true
+		names[i] = candidate
+	}
+	return names
+}
+
+// Save writes the workbook to out. It is a plain SpreadsheetML package with
+// inline strings, which Excel, LibreOffice and Google Sheets all open.
+func (g *weeklyGrid) Save(out OutputFS, filename string) error {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	names := g.sheetNames()
+
+	parts := map[string]string{
+		"[Content_Types].xml":        contentTypesXML(len(g.sheets)),
+		"_rels/.rels":                rootRelsXML,
+		"xl/workbook.xml":            workbookXML(names),
+		"xl/_rels/workbook.xml.rels": workbookRelsXML(len(g.sheets)),
+		"xl/styles.xml":              stylesXML,
+	}
+	for i, sheet := range g.sheets {
+		parts[fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1)] = g.sheetXML(sheet)
+	}
+	order := make([]string, 0, len(parts))
+	for name := range parts {
+		order = append(order, name)
+	}
+	sort.Strings(order)
+	for _, name := range order {
+		w, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(parts[name])); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return out.WriteFile(filename, buf.Bytes())
+}
+
+// Cell styles, indexes into cellXfs in stylesXML.
+const (
+	styleDefault = 0
+	styleHeader  = 1
+	styleWrapped = 2
+)
+
+func (g *weeklyGrid) sheetXML(sheet gridSheet) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane xSplit="1" ySplit="1" topLeftCell="B2" activePane="bottomRight" state="frozen"/></sheetView></sheetViews>`)
+	fmt.Fprintf(&b, `<cols><col min="1" max="1" width="8" customWidth="1"/><col min="2" max="%d" width="28" customWidth="1"/></cols>`, len(sheet.days)+1)
+	b.WriteString(`<sheetData>`)
+
+	b.WriteString(`<row r="1">`)
+	writeCell(&b, 0, 1, "Time", styleHeader)
+	for day, date := range sheet.days {
+		writeCell(&b, day+1, 1, date.Format("Mon 02 Jan"), styleHeader)
+	}
+	b.WriteString(`</row>`)
+	for row, cells := range sheet.cells {
+		fmt.Fprintf(&b, `<row r="%d">`, row+2)
+		writeCell(&b, 0, row+2, sheet.days[0].Add(time.Duration(row)*g.slot).Format("15:04"), styleHeader)
+		for day, text := range cells {
+			if text != "" {
+				writeCell(&b, day+1, row+2, text, styleWrapped)
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+func writeCell(b *strings.Builder, col, row int, text string, style int) {
+	fmt.Fprintf(b, `<c r="%s%d" t="inlineStr"`, columnName(col), row)
+	if style != styleDefault {
+		fmt.Fprintf(b, ` s="%d"`, style)
+	}
+	b.WriteString(`><is><t xml:space="preserve">`)
+	xml.EscapeText(b, []byte(text))
+	b.WriteString(`</t></is></c>`)
+}
+
+// columnName turns a zero-based column index into its letters: A, B, … AA.
+func columnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+func contentTypesXML(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+const rootRelsXML = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+func workbookXML(names []string) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, name := range names {
+		b.WriteString(`<sheet name="`)
+		xml.EscapeText(&b, []byte(name))
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func workbookRelsXML(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, sheets+1)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+// stylesXML defines the default style, a bold shaded header and wrapped,
+// top-aligned programme cells.
+const stylesXML = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="3"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill>` +
+	`<fill><patternFill patternType="solid"><fgColor rgb="FFE7E6E6"/><bgColor indexed="64"/></patternFill></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1"/>` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0" applyAlignment="1"><alignment vertical="top" wrapText="1"/></xf></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`